@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+var applyFile string
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply an option profile to every matching socket. Example: sox apply -f profile.yaml",
+	Run: func(cmd *cobra.Command, args []string) {
+		p, err := profile.Load(applyFile)
+		if err != nil {
+			slog.Error("unable to load profile", slog.Any("err", err))
+			exit(1)
+			return
+		}
+
+		results, err := p.Apply()
+		if err != nil {
+			slog.Error("unable to apply profile", slog.Any("err", err))
+			exit(1)
+			return
+		}
+
+		printResults(results, outputFormat)
+
+		if len(results) == 0 {
+			slog.Warn("no socket matches the profile selector")
+		}
+		if n := profile.Failed(results); n > 0 {
+			slog.Error("profile not fully applied", slog.Int("failures", n))
+			exit(1)
+		}
+	},
+}
+
+// printResults prints per-socket and per-option results of apply, restore
+// and undo.
+func printResults(results []profile.SocketResult, format string) {
+	var rows [][]any
+	for _, r := range results {
+		if r.Error != "" {
+			rows = append(rows, []any{r.PID, r.FD, r.Local, r.Remote, "", "", profile.StatusFailed, r.Error})
+			continue
+		}
+		for _, o := range r.Options {
+			val := ""
+			if o.Value != nil {
+				val = sockopt.OptionsMap[o.Option].Format(o.Value)
+			}
+			rows = append(rows, []any{r.PID, r.FD, r.Local, r.Remote, o.Option, val, o.Status, o.Error})
+		}
+	}
+	printTable(results, []string{"PID", "FD", "LOCAL", "REMOTE", "OPTION", "VALUE", "STATUS", "ERROR"}, rows, format)
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "Profile file in YAML or JSON")
+	applyCmd.MarkFlagRequired("file")
+}
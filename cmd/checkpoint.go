@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	checkpointStop bool
+	checkpointFile string
+)
+
+// checkpointCmd represents the checkpoint command
+var checkpointCmd = &cobra.Command{
+	Use:   "checkpoint",
+	Short: "Save the state of an established TCP connection using TCP_REPAIR. Example: sox checkpoint <process pid> <socket fd> -f conn.json",
+	Long: `Save the state of an established TCP connection: sequence numbers, the
+data in the send and receive queues, the window and the options negotiated
+in the handshake (MSS, window scaling, SACK and timestamps). The socket is
+put into TCP repair mode meanwhile, which requires CAP_NET_ADMIN.
+
+With --file the JSON checkpoint is written to that file for use with
+sox restore-conn; otherwise it is printed in the -o format.
+
+By default the socket leaves repair mode afterwards and the connection
+carries on. With --stop it stays in repair mode so that the connection can
+be restored elsewhere: it no longer sends or acknowledges anything, the
+owning process gets errors on it, and closing it sends neither FIN nor RST.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pid, fd, _, err := resolvePidFd(args)
+		if err != nil {
+			slog.Error("unable to select socket", slog.Any("err", err))
+			return
+		}
+
+		s, err := sockopt.Open(pid, fd)
+		if err != nil {
+			slog.Error("unable to get sockopt fd", slog.Any("err", err))
+			return
+		}
+		defer s.Close()
+
+		// The file is opened first: with --stop the connection stays frozen,
+		// so a checkpoint that cannot be saved must not be taken.
+		var out *os.File
+		var reuse any
+		if checkpointFile != "" {
+			if checkpointStop {
+				// leaving repair mode clears SO_REUSEADDR
+				if reuse, err = s.Get("SO_REUSEADDR"); err != nil {
+					slog.Error("unable to get SO_REUSEADDR", slog.Any("err", err))
+					return
+				}
+			}
+			if out, err = os.OpenFile(checkpointFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600); err != nil {
+				slog.Error("unable to write checkpoint", slog.Any("err", err))
+				return
+			}
+			defer out.Close()
+		}
+
+		cp, err := s.CheckpointTCP(checkpointStop)
+		if err != nil {
+			if out != nil {
+				os.Remove(checkpointFile)
+			}
+			slog.Error("unable to checkpoint connection", slog.Any("err", err))
+			return
+		}
+
+		if out == nil {
+			window := ""
+			if cp.Window != nil {
+				window = cp.Window.String()
+			}
+			rows := [][]any{
+				{"local", cp.Local},
+				{"remote", cp.Remote},
+				{"send_seq", cp.SendSeq},
+				{"recv_seq", cp.RecvSeq},
+				{"send_queue", fmt.Sprintf("%d B, %d unsent", len(cp.SendQueue), cp.Unsent)},
+				{"recv_queue", fmt.Sprintf("%d B", len(cp.RecvQueue))},
+				{"options", cp.Options},
+				{"window", window},
+				{"timestamp", cp.Timestamp},
+			}
+			printTable(cp, []string{"FIELD", "VALUE"}, rows, outputFormat)
+			return
+		}
+
+		// the queues hold connection data, hence mode 0600
+		b, err := json.MarshalIndent(cp, "", "  ")
+		if err == nil {
+			_, err = out.Write(append(b, '\n'))
+		}
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			slog.Error("unable to write checkpoint", slog.Any("err", err))
+			if checkpointStop {
+				resumeConnection(s, reuse)
+			}
+			return
+		}
+		slog.Info("checkpoint written", slog.String("file", checkpointFile),
+			slog.String("local", cp.Local), slog.String("remote", cp.Remote), slog.Bool("stopped", checkpointStop))
+	},
+}
+
+// resumeConnection takes a socket stopped by CheckpointTCP out of repair mode
+// again, so that the connection is not left frozen without a checkpoint.
+func resumeConnection(s *sockopt.Socket, reuse any) {
+	err := s.Set("TCP_REPAIR", unix.TCP_REPAIR_OFF)
+	if err == nil && reuse == true {
+		err = s.Set("SO_REUSEADDR", true)
+	}
+	if err != nil {
+		slog.Error("unable to resume connection", slog.Any("err", err))
+		return
+	}
+	slog.Info("connection resumed")
+}
+
+func init() {
+	rootCmd.AddCommand(checkpointCmd)
+	addSelectorFlags(checkpointCmd)
+	checkpointCmd.Flags().BoolVar(&checkpointStop, "stop", false, "Leave the socket in repair mode so the connection can be restored elsewhere")
+	checkpointCmd.Flags().StringVarP(&checkpointFile, "file", "f", "", "Write the checkpoint as JSON to this file")
+}
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"io"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
+
+	"github.com/valexz/sox/pkg/snapshot"
+	"github.com/valexz/sox/pkg/sockets"
 )
 
 // helper to get fd from net.Conn
@@ -47,6 +53,15 @@ func makeSocket(t *testing.T) (net.Conn, func()) {
 	return c, cleanup
 }
 
+// stubExit replaces exit for the rest of the test and returns where the
+// last exit code is stored.
+func stubExit(t *testing.T) *int {
+	code := new(int)
+	exit = func(c int) { *code = c }
+	t.Cleanup(func() { exit = os.Exit })
+	return code
+}
+
 func TestCommands(t *testing.T) {
 	c, cleanup := makeSocket(t)
 	defer cleanup()
@@ -57,18 +72,293 @@ func TestCommands(t *testing.T) {
 	pidStr := strconv.Itoa(os.Getpid())
 	fdStr := strconv.Itoa(fd)
 
+	journalPath = t.TempDir() + "/journal.jsonl"
+
 	getCmd.Run(getCmd, []string{pidStr, fdStr, "TCP_NODELAY"})
 	setCmd.Run(setCmd, []string{pidStr, fdStr, "TCP_NODELAY", "1"})
+	undoCmd.Run(undoCmd, nil)
 	listCmd.Run(listCmd, []string{pidStr, fdStr})
+	queuesCmd.Run(queuesCmd, []string{pidStr, fdStr})
+	socketsCmd.Run(socketsCmd, nil)
+
+	watchCount = 2
+	watchInterval = 10 * time.Millisecond
+	watchCmd.Run(watchCmd, []string{pidStr, fdStr, "TCP_NODELAY", "rtt"})
+
+	applyFile = t.TempDir() + "/profile.yaml"
+	profile := "selector: {pid: " + pidStr + "}\noptions: {TCP_NODELAY: true}\n"
+	if err := os.WriteFile(applyFile, []byte(profile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	applyCmd.Run(applyCmd, nil)
+
+	var code int
+	exit = func(c int) { code = c }
+	applyFile = t.TempDir() + "/missing.yaml"
+	applyCmd.Run(applyCmd, nil)
+	if code != 1 {
+		t.Fatalf("apply of missing profile exited with %d", code)
+	}
+	if err := os.WriteFile(applyFile, []byte("selector: {pid: "+pidStr+"}\noptions: {TCP_KEEPIDLE: 0}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code = 0
+	applyCmd.Run(applyCmd, nil)
+	if code != 1 {
+		t.Fatalf("apply with failures exited with %d", code)
+	}
+	diffCmd.Run(diffCmd, []string{pidStr, fdStr, pidStr, fdStr})
+	if code != diffSame {
+		t.Fatalf("diff of a socket with itself exited with %d", code)
+	}
+	diffCmd.Run(diffCmd, []string{pidStr, fdStr})
+	if code != diffError {
+		t.Fatalf("diff with missing arguments exited with %d", code)
+	}
+	code = 0
+	doctorCmd.Run(doctorCmd, []string{pidStr})
+	if code != 0 {
+		t.Fatalf("doctor of own process exited with %d", code)
+	}
+	doctorCmd.Run(doctorCmd, []string{"bad"})
+	if code != 1 {
+		t.Fatalf("doctor with invalid pid exited with %d", code)
+	}
+
+	snapshotSelector.PID = os.Getpid()
+	snapshotFile = t.TempDir() + "/snap.json"
+	snapshotCmd.Run(snapshotCmd, nil)
+	if _, err := os.Stat(snapshotFile); err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+	restoreCmd.Run(restoreCmd, []string{snapshotFile})
+	snapshotFile = ""
+
+	code = 0
+	restoreCmd.Run(restoreCmd, []string{t.TempDir() + "/missing.json"})
+	if code != 1 {
+		t.Fatalf("restore of missing snapshot exited with %d", code)
+	}
+	code = 0
+	undoCmd.Run(undoCmd, nil)
+	if code != 1 {
+		t.Fatalf("undo with nothing to undo exited with %d", code)
+	}
 
 	// root command execution
 	rootCmd.SetArgs([]string{"get", pidStr, fdStr, "TCP_NODELAY"})
 	if err := rootCmd.Execute(); err != nil {
 		t.Fatal(err)
 	}
+
+	// socket addressed by endpoint instead of pid/fd
+	rootCmd.SetArgs([]string{"get", "--socket", c.LocalAddr().String() + "->" + c.RemoteAddr().String(), "TCP_NODELAY"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sockets of a cgroup, narrowed to the test connection
+	defer func() { selectGroup, selectSocket = sockets.Group{}, "" }()
+	for _, args := range [][]string{{"list"}, {"get", "TCP_NODELAY"}, {"set", "TCP_NODELAY", "1"}} {
+		rootCmd.SetArgs(append(args, "--cgroup", "/", "--socket", c.LocalAddr().String()+"->"+c.RemoteAddr().String()))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, results, err := (snapshot.Journal{Path: journalPath}).Undo(); err != nil || len(results) != 1 {
+		t.Fatalf("undo of group set: %v %v", results, err)
+	}
+}
+
+func TestSetExitCode(t *testing.T) {
+	c, cleanup := makeSocket(t)
+	defer cleanup()
+	fd, err := fdFromConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pidStr, fdStr := strconv.Itoa(os.Getpid()), strconv.Itoa(fd)
+	journalPath = t.TempDir() + "/journal.jsonl"
+	code := stubExit(t)
+
+	for _, args := range [][]string{
+		{pidStr, fdStr, "TCP_NODELAY", "maybe"},
+		{pidStr, fdStr, "SO_NOSUCH", "1"},
+		{pidStr, fdStr, "TCP_NODELAY"},
+		{"bad", fdStr, "TCP_NODELAY", "1"},
+	} {
+		*code = 0
+		setCmd.Run(setCmd, args)
+		if *code != 1 {
+			t.Errorf("set %v exited with %d", args, *code)
+		}
+	}
+	*code = 0
+	setCmd.Run(setCmd, []string{pidStr, fdStr, "TCP_NODELAY", "on"})
+	if *code != 0 {
+		t.Errorf("valid set exited with %d", *code)
+	}
 }
 
 func TestCommandsInvalidArgs(t *testing.T) {
 	getCmd.Run(getCmd, []string{"bad", "fd", "TCP_NODELAY"})
 	listCmd.Run(listCmd, []string{"bad", "fd"})
+	queuesCmd.Run(queuesCmd, []string{"bad", "fd"})
+
+	code := stubExit(t)
+	killCmd.Run(killCmd, []string{"bad", "fd"})
+	if *code != 1 {
+		t.Fatalf("kill with invalid pid exited with %d", *code)
+	}
+}
+
+func TestKill(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	peer := <-accepted
+	defer peer.Close()
+
+	fd, err := fdFromConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{strconv.Itoa(os.Getpid()), strconv.Itoa(fd)}
+	defer func() { killMode, killHow, killDryRun = "shutdown", "rdwr", false }()
+	code := stubExit(t)
+
+	killDryRun = true
+	killCmd.Run(killCmd, args)
+	if _, err := c.Write([]byte("x")); err != nil {
+		t.Fatalf("write after dry run: %v", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := peer.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	killDryRun, killHow = false, "wr"
+	killCmd.Run(killCmd, args)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := peer.Read(buf); n != 0 || err == nil {
+		t.Fatalf("peer read after shutdown: %d %v", n, err)
+	}
+
+	if *code != 0 {
+		t.Fatalf("kill exited with %d", *code)
+	}
+
+	killHow = "bad"
+	killCmd.Run(killCmd, args)
+	if *code != 1 {
+		t.Fatalf("kill with invalid --how exited with %d", *code)
+	}
+}
+
+func TestConfirmKill(t *testing.T) {
+	targets := []sockets.SocketInfo{{PID: "1", FD: "3"}, {PID: "1", FD: "4"}}
+	for answer, want := range map[string]bool{"y\n": true, "YES\n": true, "\n": false, "n\n": false, "": false} {
+		var out strings.Builder
+		if got := confirmKill(strings.NewReader(answer), &out, targets, "destroy"); got != want {
+			t.Errorf("answer %q: got %v, want %v", answer, got, want)
+		}
+		if !strings.Contains(out.String(), "2 sockets match") {
+			t.Errorf("prompt does not list the sockets: %q", out.String())
+		}
+	}
+}
+
+func TestCheckpointRestoreConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	orig := <-accepted
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	fd, err := fdFromConn(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { checkpointFile, checkpointStop = "", false }()
+	// a checkpoint that cannot be saved must not freeze the connection
+	for _, out := range []string{t.TempDir() + "/missing/conn.json", "/dev/full"} {
+		checkpointFile, checkpointStop = out, true
+		checkpointCmd.Run(checkpointCmd, []string{strconv.Itoa(os.Getpid()), strconv.Itoa(fd)})
+		if _, err := orig.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(c, make([]byte, 1)); err != nil {
+			t.Fatalf("connection stopped after failed checkpoint to %s: %v", out, err)
+		}
+	}
+
+	path := t.TempDir() + "/conn.json"
+	checkpointFile, checkpointStop = path, true
+	checkpointCmd.Run(checkpointCmd, []string{strconv.Itoa(os.Getpid()), strconv.Itoa(fd)})
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("no checkpoint written, repair mode needs CAP_NET_ADMIN: %v", err)
+	}
+	orig.Close()
+
+	var out strings.Builder
+	restoreConnCmd.SetIn(strings.NewReader("pong"))
+	restoreConnCmd.SetOut(&out)
+	defer restoreConnCmd.SetIn(nil)
+	defer restoreConnCmd.SetOut(nil)
+	done := make(chan struct{})
+	go func() {
+		restoreConnCmd.Run(restoreConnCmd, []string{path})
+		close(done)
+	}()
+
+	// the peer only reads, since until the restore data sent to the
+	// closed socket would be answered with a RST
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := io.ReadAll(c)
+	if err != nil || string(got) != "pong" {
+		t.Fatalf("peer got %q %v", got, err)
+	}
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("restore-conn did not return after the peer closed")
+	}
+	if out.String() != "hello" {
+		t.Fatalf("restored connection delivered %q", out.String())
+	}
+
+	restoreConnCmd.Run(restoreConnCmd, []string{t.TempDir() + "/missing.json"})
 }
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+var (
+	diffAgainst string
+	diffAll     bool
+)
+
+var errDiffArgs = errors.New("expected <pid A> <fd A> <pid B> <fd B> or --against <file> <pid> <fd>")
+
+// exit is replaced in tests.
+var exit = os.Exit
+
+// Exit codes of sox diff, following diff(1).
+const (
+	diffSame   = 0
+	diffDiffer = 1
+	diffError  = 2
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show options that differ between two sockets. Example: sox diff <pid A> <fd A> <pid B> <fd B> or sox diff --against saved.json <pid> <fd>",
+	Long: `Show options that differ between two sockets, or between a socket and
+the JSON output of an earlier sox list.
+
+The exit status is 0 if the options are the same, 1 if they differ and 2 if
+an error occurred.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		old, new, err := diffSides(args)
+		if err != nil {
+			slog.Error("unable to compare sockets", slog.Any("err", err))
+			exit(diffError)
+			return
+		}
+
+		diffs := sockopt.Diff(old, new, diffAll)
+
+		var rows [][]any
+		for _, d := range diffs {
+			rows = append(rows, []any{d.Name, formatDiffValue(d.Name, d.Old), formatDiffValue(d.Name, d.New)})
+		}
+		printTable(diffs, []string{"OPTION", "OLD", "NEW"}, rows, outputFormat)
+
+		if len(diffs) > 0 {
+			exit(diffDiffer)
+			return
+		}
+		exit(diffSame)
+	},
+}
+
+// diffSides reads the option lists to compare.
+func diffSides(args []string) (old, new []sockopt.OptionRow, err error) {
+	if diffAgainst != "" {
+		b, err := os.ReadFile(diffAgainst)
+		if err != nil {
+			return nil, nil, err
+		}
+		if old, err = sockopt.ParseRows(b); err != nil {
+			return nil, nil, err
+		}
+		pid, fd, _, err := resolvePidFd(args)
+		if err != nil {
+			return nil, nil, err
+		}
+		new, err = listOptions(pid, fd)
+		return old, new, err
+	}
+
+	if len(args) != 4 {
+		return nil, nil, errDiffArgs
+	}
+	var ids [4]int
+	for i, a := range args {
+		if ids[i], err = strconv.Atoi(a); err != nil {
+			return nil, nil, errDiffArgs
+		}
+	}
+	if old, err = listOptions(ids[0], ids[1]); err != nil {
+		return nil, nil, err
+	}
+	new, err = listOptions(ids[2], ids[3])
+	return old, new, err
+}
+
+// listOptions reads all readable options of a socket.
+func listOptions(pid, fd int) ([]sockopt.OptionRow, error) {
+	s, err := sockopt.Open(pid, fd)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	// Options that cannot be read are missing on both sides alike.
+	rows, _ := s.List()
+	return rows, nil
+}
+
+func formatDiffValue(name string, v any) string {
+	if v == nil {
+		return "-"
+	}
+	return formatValue(sockopt.OptionRow{Name: name, Value: v})
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	addSelectorFlags(diffCmd)
+	diffCmd.Flags().StringVar(&diffAgainst, "against", "", "Compare with the JSON output of sox list")
+	diffCmd.Flags().BoolVar(&diffAll, "all", false, "Also compare volatile options such as TCP_INFO and TCP_TIMESTAMP")
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/doctor"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check whether sox can access sockets and explain failures. Example: sox doctor [pid]",
+	Long: `Check the kernel version, the capabilities of sox, the Yama ptrace_scope
+and the availability of the pidfd syscalls. With a pid, also check that the
+sockets of that process can be accessed.
+
+Every failed check comes with a remedy. The exit status is 1 if a check
+failed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pid := 0
+		if len(args) == 1 {
+			var err error
+			if pid, err = strconv.Atoi(args[0]); err != nil || pid <= 0 {
+				slog.Error("invalid pid", slog.String("pid", args[0]))
+				exit(1)
+				return
+			}
+		}
+
+		checks := doctor.Run(pid)
+
+		if outputFormat == "json" || outputFormat == "yaml" {
+			printTable(checks, nil, nil, outputFormat)
+		} else {
+			printChecks(checks)
+		}
+
+		if doctor.Failed(checks) {
+			exit(1)
+		}
+	},
+}
+
+// printChecks prints the report as a table. Unlike printTable, long details
+// and remedies are wrapped rather than truncated.
+func printChecks(checks []doctor.Check) {
+	table := uitable.New()
+	table.MaxColWidth = 50
+	table.Wrap = true
+	table.AddRow("CHECK", "STATUS", "DETAIL", "REMEDY")
+	for _, c := range checks {
+		table.AddRow(c.Name, c.Status, c.Detail, c.Remedy)
+	}
+	fmt.Println(table)
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
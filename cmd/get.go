@@ -5,32 +5,113 @@ Copyright © 2024 Alexander Vysochin <avyssochin@gmail.com>
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/sockets"
 	"github.com/valexz/sox/pkg/sockopt"
 	"log/slog"
-	"strconv"
 )
 
 // getCmd represents the get command
 var getCmd = &cobra.Command{
 	Use:   "get",
-	Short: "Get single parameter of socket. Example: sox get <process pid> <socket fd> <socket option name>",
+	Short: "Get single parameter of socket. Example: sox get <process pid> <socket fd> <socket option name> or sox get --listen :8080 <socket option name>",
 	Run: func(cmd *cobra.Command, args []string) {
-		pid, err := strconv.Atoi(args[0])
+		if matched, ok, err := resolveGroup(); ok {
+			if err == nil && len(args) != 1 {
+				err = fmt.Errorf("expected socket option name")
+			}
+			if err == nil {
+				_, err = lookupOption(args[0])
+			}
+			if err != nil {
+				slog.Error("unable to select sockets", slog.Any("err", err))
+				return
+			}
+			results := getSockets(matched, args[0])
+			printResults(results, outputFormat)
+			if n := profile.Failed(results); n > 0 {
+				slog.Error("unable to get socket option", slog.Int("failures", n))
+			}
+			return
+		}
+
+		pid, fd, args, err := resolvePidFd(args)
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("unable to select socket", slog.Any("err", err))
+			return
 		}
-		fd, err := strconv.Atoi(args[1])
+		if len(args) != 1 {
+			slog.Error("expected socket option name")
+			return
+		}
+
+		option := args[0]
+
+		s, err := sockopt.Open(pid, fd)
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("unable to get sockopt fd", slog.Any("err", err))
+			return
 		}
+		defer s.Close()
 
-		option := args[2]
+		val, err := s.Get(option)
+		if err != nil {
+			slog.Error("unable to get socket option", slog.Any("err", err))
+			return
+		}
 
-		sockopt.GetSocketOption(pid, fd, option, outputFormat)
+		row := sockopt.OptionRow{Name: option, Value: val, Description: sockopt.OptionsMap[option].Description}
+		printOptions(row, []string{"SOCKET_OPTION", "VALUE", "DESCRIPTION"}, outputFormat)
 	},
 }
 
+// getSockets reads option from each socket.
+func getSockets(matched []sockets.SocketInfo, option string) []profile.SocketResult {
+	results := []profile.SocketResult{}
+	for _, s := range matched {
+		res := profile.SocketResult{PID: s.PID, FD: s.FD, Local: s.LocalAddr, Remote: s.RemoteAddr, Options: []profile.OptionResult{}}
+		sock, err := openSocket(s)
+		if err != nil {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		or := profile.OptionResult{Option: option, Status: profile.StatusOK}
+		or.Value, err = sock.Get(option)
+		sock.Close()
+		or.Status, or.Error = optionStatus(err)
+		res.Options = append(res.Options, or)
+		results = append(results, res)
+	}
+	return results
+}
+
+// lookupOption checks an option name before it is used on a group of sockets.
+func lookupOption(name string) (sockopt.SocketOption, error) {
+	so, ok := sockopt.OptionsMap[name]
+	if !ok {
+		return so, fmt.Errorf("%w %s", sockopt.ErrUnknownOption, name)
+	}
+	return so, nil
+}
+
+// optionStatus maps the error of a get or set on one socket of a group to a
+// result status. Options that do not apply to a socket are skipped.
+func optionStatus(err error) (status, msg string) {
+	switch {
+	case err == nil:
+		return profile.StatusOK, ""
+	case errors.Is(err, sockopt.ErrNotApplicable):
+		return profile.StatusSkipped, err.Error()
+	default:
+		return profile.StatusFailed, err.Error()
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(getCmd)
+	addSelectorFlags(getCmd)
 }
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/snapshot"
+	"github.com/valexz/sox/pkg/sockets"
+	"github.com/valexz/sox/pkg/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	killMode   string
+	killHow    string
+	killRST    bool
+	killDryRun bool
+	killYes    bool
+)
+
+// statusDryRun is reported for sockets sox kill would act on.
+const statusDryRun = "dry-run"
+
+// shutdownHow maps the --how values to shutdown(2) arguments.
+var shutdownHow = map[string]int{
+	"rd":   unix.SHUT_RD,
+	"wr":   unix.SHUT_WR,
+	"rdwr": unix.SHUT_RDWR,
+}
+
+// killResult reports what sox kill did to one socket.
+type killResult struct {
+	PID      string `json:"pid" yaml:"pid"`
+	FD       string `json:"fd" yaml:"fd"`
+	Protocol string `json:"protocol" yaml:"protocol"`
+	Local    string `json:"local" yaml:"local"`
+	Remote   string `json:"remote" yaml:"remote"`
+	State    string `json:"state" yaml:"state"`
+	Action   string `json:"action" yaml:"action"`
+	Status   string `json:"status" yaml:"status"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// killCmd represents the kill command
+var killCmd = &cobra.Command{
+	Use:   "kill",
+	Short: "Shut down or destroy a connection from outside the process. Example: sox kill <process pid> <socket fd> or sox kill --socket 10.0.0.5:443->10.0.0.9:51234",
+	Long: `Shut down or destroy the selected sockets without restarting the process
+that owns them.
+
+With --mode shutdown (the default) shutdown(2) is called on the socket with
+--how rd, wr or rdwr. The process sees EOF or EPIPE and is expected to close
+the socket itself. With --mode destroy the socket is closed by the kernel
+with SOCK_DESTROY, which aborts TCP connections with a RST; this requires
+CAP_NET_ADMIN and CONFIG_INET_DIAG_DESTROY.
+
+--rst sets SO_LINGER {on, 0s} first, so that the close which follows sends a
+RST instead of a FIN. With --mode shutdown use --how rd to avoid sending a
+FIN before that.
+
+If more than one socket matches, sox asks for confirmation unless --yes is
+given. --dry-run only reports the sockets that would be affected.
+
+The exit status is 1 if the flags are invalid or a socket could not be
+killed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		action, err := killAction()
+		if err != nil {
+			slog.Error("invalid kill options", slog.Any("err", err))
+			exit(1)
+			return
+		}
+		targets, err := killTargets(args)
+		if err != nil {
+			slog.Error("unable to select sockets", slog.Any("err", err))
+			exit(1)
+			return
+		}
+
+		if killDryRun {
+			printKillResults(killReport(targets, action, statusDryRun), outputFormat)
+			return
+		}
+		if len(targets) > 1 && !killYes && !confirmKill(cmd.InOrStdin(), cmd.ErrOrStderr(), targets, action) {
+			slog.Info("no socket killed")
+			return
+		}
+
+		results := killSockets(targets, action)
+		printKillResults(results, outputFormat)
+		failed := 0
+		for _, r := range results {
+			if r.Status == profile.StatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			slog.Error("unable to kill every socket", slog.Int("failures", failed))
+			exit(1)
+		}
+	},
+}
+
+// killAction validates the flags and describes the action for the report.
+func killAction() (string, error) {
+	var action string
+	switch killMode {
+	case "shutdown":
+		if _, ok := shutdownHow[killHow]; !ok {
+			return "", fmt.Errorf("unknown --how %q, expected rd, wr or rdwr", killHow)
+		}
+		action = "shutdown " + killHow
+	case "destroy":
+		action = "destroy"
+	default:
+		return "", fmt.Errorf("unknown --mode %q, expected shutdown or destroy", killMode)
+	}
+	if killRST {
+		action += " rst"
+	}
+	return action, nil
+}
+
+// killTargets returns the sockets selected by the selector flags, which may
+// match several sockets, or by the <pid> <fd> arguments.
+func killTargets(args []string) ([]sockets.SocketInfo, error) {
+	if matched, ok, err := resolveGroup(); ok {
+		return matched, err
+	}
+	sel, ok, err := socketSelector()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		matched, err := sockets.Select(sel)
+		if err == nil && len(matched) == 0 {
+			err = fmt.Errorf("%w: %s", sockets.ErrNoSocketMatch, sel)
+		}
+		return matched, err
+	}
+
+	pid, fd, _, err := resolvePidFd(args)
+	if err != nil {
+		return nil, err
+	}
+	s, err := sockopt.Open(pid, fd)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	// the report shows what is known even if the lookup fails
+	target, err := snapshot.Lookup(pid, fd, s)
+	if target.Inode == "" {
+		return nil, err
+	}
+	if err != nil {
+		slog.Warn("socket not found with sock_diag", slog.Any("err", err))
+	}
+	return []sockets.SocketInfo{target}, nil
+}
+
+// confirmKill lists the targets on w and asks to go ahead on r.
+func confirmKill(r io.Reader, w io.Writer, targets []sockets.SocketInfo, action string) bool {
+	fmt.Fprintf(w, "%d sockets match:\n", len(targets))
+	for _, s := range targets {
+		fmt.Fprintf(w, "  pid %s fd %s %s %s->%s %s\n", s.PID, s.FD, s.Protocol, s.LocalAddr, s.RemoteAddr, s.State)
+	}
+	fmt.Fprintf(w, "%s all of them? [y/N] ", action)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// killReport lists the targets with the same status.
+func killReport(targets []sockets.SocketInfo, action, status string) []killResult {
+	results := []killResult{}
+	for _, s := range targets {
+		results = append(results, killResult{
+			PID: s.PID, FD: s.FD, Protocol: s.Protocol, Local: s.LocalAddr, Remote: s.RemoteAddr,
+			State: s.State, Action: action, Status: status,
+		})
+	}
+	return results
+}
+
+// killSockets applies the action selected by the flags to each target.
+func killSockets(targets []sockets.SocketInfo, action string) []killResult {
+	results := killReport(targets, action, profile.StatusOK)
+	for i, s := range targets {
+		if err := killSocket(s); err != nil {
+			results[i].Status, results[i].Error = profile.StatusFailed, err.Error()
+		}
+	}
+	return results
+}
+
+// killSocket sets SO_LINGER for --rst and then shuts down or destroys s.
+func killSocket(s sockets.SocketInfo) error {
+	if killRST || killMode == "shutdown" {
+		sock, err := openSocket(s)
+		if err != nil {
+			return err
+		}
+		defer sock.Close()
+		if killRST {
+			if err := sock.Set("SO_LINGER", sockopt.Linger{OnOff: true}); err != nil {
+				return fmt.Errorf("unable to set SO_LINGER: %w", err)
+			}
+		}
+		if killMode == "shutdown" {
+			if err := sock.Shutdown(shutdownHow[killHow]); err != nil {
+				return fmt.Errorf("unable to shut down socket: %w", err)
+			}
+			return nil
+		}
+	}
+	return sockets.Destroy(s)
+}
+
+// printKillResults prints one row per socket.
+func printKillResults(results []killResult, format string) {
+	var rows [][]any
+	for _, r := range results {
+		rows = append(rows, []any{r.PID, r.FD, r.Protocol, r.Local, r.Remote, r.State, r.Action, r.Status, r.Error})
+	}
+	printTable(results, []string{"PID", "FD", "PROTO", "LOCAL", "REMOTE", "STATE", "ACTION", "STATUS", "ERROR"}, rows, format)
+}
+
+func init() {
+	rootCmd.AddCommand(killCmd)
+	addSelectorFlags(killCmd)
+	killCmd.Flags().StringVar(&killMode, "mode", "shutdown", "How to kill the socket: shutdown or destroy (SOCK_DESTROY)")
+	killCmd.Flags().StringVar(&killHow, "how", "rdwr", "Direction to shut down with --mode shutdown: rd, wr or rdwr")
+	killCmd.Flags().BoolVar(&killRST, "rst", false, "Set SO_LINGER {on, 0s} first so the close sends a RST")
+	killCmd.Flags().BoolVar(&killDryRun, "dry-run", false, "Only report the sockets that would be killed")
+	killCmd.Flags().BoolVarP(&killYes, "yes", "y", false, "Do not ask for confirmation when several sockets match")
+}
@@ -5,9 +5,10 @@ Copyright © 2024 Alexander Vysochin <avyssochin@gmail.com>
 package cmd
 
 import (
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/sockets"
 	"github.com/valexz/sox/pkg/sockopt"
 	"log/slog"
-	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -15,21 +16,79 @@ import (
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all socket options, supported by sox. Example: sox list <process pid> <socket fd>",
+	Short: "List all socket options, supported by sox. Example: sox list <process pid> <socket fd> or sox list --socket 10.0.0.5:443->10.0.0.9:51234",
 	Run: func(cmd *cobra.Command, args []string) {
-		pid, err := strconv.Atoi(args[0])
+		if matched, ok, err := resolveGroup(); ok {
+			if err != nil {
+				slog.Error("unable to select sockets", slog.Any("err", err))
+				return
+			}
+			printResults(listSockets(matched), outputFormat)
+			return
+		}
+
+		pid, fd, _, err := resolvePidFd(args)
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("unable to select socket", slog.Any("err", err))
+			return
 		}
-		fd, err := strconv.Atoi(args[1])
+
+		s, err := sockopt.Open(pid, fd)
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("unable to get sockopt fd", slog.Any("err", err))
+			return
 		}
+		defer s.Close()
 
-		sockopt.ListSocketOptions(pid, fd, outputFormat)
+		rows, err := s.List()
+		if err != nil {
+			slog.Error("unable to list socket options", slog.Any("err", err))
+			return
+		}
+		printOptions(rows, []string{"OPTION NAME", "VALUE", "DESCRIPTION"}, outputFormat)
+
+		// Explain options that are unsupported or need privileges; options
+		// that are merely unavailable in the socket's state are only marked.
+		for _, r := range rows {
+			if r.Status == sockopt.StatusUnsupported || r.Status == sockopt.StatusForbidden {
+				slog.Warn("option not readable", slog.String("option", r.Name), slog.String("reason", r.Error))
+			}
+		}
 	},
 }
 
+// listSockets reads every option of each socket. Options that cannot be read
+// are reported with their status.
+func listSockets(matched []sockets.SocketInfo) []profile.SocketResult {
+	results := []profile.SocketResult{}
+	for _, s := range matched {
+		res := profile.SocketResult{PID: s.PID, FD: s.FD, Local: s.LocalAddr, Remote: s.RemoteAddr, Options: []profile.OptionResult{}}
+		rows, err := readOptions(s)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		for _, r := range rows {
+			or := profile.OptionResult{Option: r.Name, Value: r.Value, Status: profile.StatusOK}
+			if r.Status != "" {
+				or.Status, or.Error = r.Status, r.Error
+			}
+			res.Options = append(res.Options, or)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func readOptions(s sockets.SocketInfo) ([]sockopt.OptionRow, error) {
+	sock, err := openSocket(s)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.Close()
+	return sock.List()
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
+	addSelectorFlags(listCmd)
 }
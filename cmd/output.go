@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gosuri/uitable"
+	"github.com/valexz/sox/pkg/sockopt"
+	"gopkg.in/yaml.v3"
+)
+
+// printTable prints data in the requested format. In table mode the headers
+// and rows are rendered; json and yaml marshal data as is.
+func printTable(data any, headers []string, rows [][]any, format string) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(data, "", "  ")
+		if err == nil {
+			fmt.Println(string(b))
+		}
+	case "yaml":
+		b, err := yaml.Marshal(data)
+		if err == nil {
+			fmt.Print(string(b))
+		}
+	default:
+		table := uitable.New()
+		table.MaxColWidth = 50
+		hi := make([]interface{}, len(headers))
+		for i, h := range headers {
+			hi[i] = h
+		}
+		table.AddRow(hi...)
+		for _, r := range rows {
+			table.AddRow(r...)
+		}
+		fmt.Println(table)
+	}
+}
+
+// printOptions prints option values. In table mode values are rendered with
+// the option's kind and a single TCP_INFO or TCP_CC_INFO value is printed
+// field by field.
+func printOptions(data any, headers []string, format string) {
+	var rows [][]any
+	switch v := data.(type) {
+	case sockopt.OptionRow:
+		if ti, ok := v.Value.(sockopt.TCPInfo); ok && format != "json" && format != "yaml" {
+			printTCPInfo(ti)
+			return
+		}
+		if cc, ok := v.Value.(sockopt.CCInfo); ok && format != "json" && format != "yaml" {
+			printCCInfo(cc)
+			return
+		}
+		rows = append(rows, []any{v.Name, formatValue(v), v.Description})
+	case []sockopt.OptionRow:
+		for _, r := range v {
+			rows = append(rows, []any{r.Name, formatValue(r), r.Description})
+		}
+	}
+	printTable(data, headers, rows, format)
+}
+
+// printTCPInfo prints one row per tcp_info field with unit-aware values.
+func printTCPInfo(ti sockopt.TCPInfo) {
+	table := uitable.New()
+	table.AddRow("FIELD", "VALUE")
+	for _, f := range ti.Fields() {
+		table.AddRow(f.Name, f.FormatValue())
+	}
+	fmt.Println(table)
+}
+
+// printCCInfo prints the algorithm and one row per TCP_CC_INFO field.
+func printCCInfo(cc sockopt.CCInfo) {
+	table := uitable.New()
+	table.AddRow("FIELD", "VALUE")
+	table.AddRow("algorithm", cc.Algorithm)
+	for _, f := range cc.Fields {
+		table.AddRow(f.Name, f.FormatValue())
+	}
+	if len(cc.Raw) > 0 {
+		table.AddRow("raw", cc.Raw.String())
+	}
+	fmt.Println(table)
+}
+
+// formatValue renders the value of a row using the option's kind. Options
+// that could not be read show their status instead.
+func formatValue(r sockopt.OptionRow) string {
+	if r.Status != "" {
+		return "(" + r.Status + ")"
+	}
+	if so, ok := sockopt.OptionsMap[r.Name]; ok {
+		return so.Format(r.Value)
+	}
+	return fmt.Sprint(r.Value)
+}
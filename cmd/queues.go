@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+// queuesCmd represents the queues command
+var queuesCmd = &cobra.Command{
+	Use:   "queues",
+	Short: "Show how much data and memory sits in the queues of a socket. Example: sox queues <process pid> <socket fd>",
+	Long: `Show the receive and send queue occupancy of a socket: SIOCINQ, SIOCOUTQ
+and SIOCOUTQNSD, the SO_MEMINFO memory counters and, for TCP listeners, the
+accept queue length and backlog.
+
+Data piling up in inq means the process is not reading, outq_nsd growing
+means the send side is blocked locally (e.g. by cwnd or the peer's window)
+and outq without outq_nsd means data waits for acknowledgement.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pid, fd, _, err := resolvePidFd(args)
+		if err != nil {
+			slog.Error("unable to select socket", slog.Any("err", err))
+			return
+		}
+
+		s, err := sockopt.Open(pid, fd)
+		if err != nil {
+			slog.Error("unable to get sockopt fd", slog.Any("err", err))
+			return
+		}
+		defer s.Close()
+
+		q, err := s.Queues()
+		if err != nil {
+			slog.Error("unable to read socket queues", slog.Any("err", err))
+			return
+		}
+
+		var rows [][]any
+		for _, f := range q.Fields() {
+			rows = append(rows, []any{f.Name, f.FormatValue(), f.Description})
+		}
+		printTable(q, []string{"QUEUE", "VALUE", "DESCRIPTION"}, rows, outputFormat)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queuesCmd)
+	addSelectorFlags(queuesCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/snapshot"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Re-apply option values from a snapshot to the sockets that still exist. Example: sox restore snap.json",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		snap, err := snapshot.Load(args[0])
+		if err != nil {
+			slog.Error("unable to load snapshot", slog.Any("err", err))
+			exit(1)
+			return
+		}
+
+		results, err := snap.Restore()
+		if err != nil {
+			slog.Error("unable to restore snapshot", slog.Any("err", err))
+			exit(1)
+			return
+		}
+
+		printResults(results, outputFormat)
+
+		if n := profile.Failed(results); n > 0 {
+			slog.Error("snapshot not fully restored", slog.Int("failures", n))
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
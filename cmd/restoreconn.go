@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+// restoreConnCmd represents the restore-conn command
+var restoreConnCmd = &cobra.Command{
+	Use:   "restore-conn",
+	Short: "Recreate a TCP connection from a checkpoint using TCP_REPAIR. Example: sox restore-conn conn.json",
+	Long: `Recreate a TCP connection saved with sox checkpoint in a new socket. The
+peer does not notice: the connection continues with the saved sequence
+numbers, and the queued data is delivered and sent again.
+
+The addresses of the connection must be usable in sox's network namespace
+and no other socket may hold them, so take the checkpoint with --stop and
+close the original socket first, or restore in another namespace with
+ip netns exec. Repair mode requires CAP_NET_ADMIN.
+
+The restored connection is relayed to stdin and stdout like netcat: data
+from the peer, starting with the saved receive queue, is written to stdout
+and stdin is sent to the peer until either side closes the connection.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := os.ReadFile(args[0])
+		var cp sockopt.TCPCheckpoint
+		if err == nil {
+			if err = json.Unmarshal(b, &cp); err != nil {
+				err = fmt.Errorf("invalid checkpoint %s: %w", args[0], err)
+			}
+		}
+		if err != nil {
+			slog.Error("unable to load checkpoint", slog.Any("err", err))
+			return
+		}
+
+		s, err := sockopt.RestoreTCP(cp)
+		if err != nil {
+			slog.Error("unable to restore connection", slog.Any("err", err))
+			return
+		}
+		// the file takes over the descriptor of s and is closed once
+		// FileConn has duplicated it
+		f := os.NewFile(uintptr(s.Fd()), cp.Local+"->"+cp.Remote)
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			slog.Error("unable to use restored connection", slog.Any("err", err))
+			return
+		}
+		defer conn.Close()
+		slog.Info("connection restored", slog.String("local", cp.Local), slog.String("remote", cp.Remote))
+
+		go func() {
+			io.Copy(conn, cmd.InOrStdin())
+			conn.(*net.TCPConn).CloseWrite()
+		}()
+		if _, err := io.Copy(cmd.OutOrStdout(), conn); err != nil {
+			slog.Error("connection failed", slog.Any("err", err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreConnCmd)
+}
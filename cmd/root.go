@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockopt"
 	"os"
 )
 
@@ -27,4 +28,5 @@ func Execute() {
 func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json, yaml")
+	rootCmd.PersistentFlags().StringVar(&sockopt.Access, "access", "", "How sockets of other processes are reached: pidfd or ptrace (default: pidfd, ptrace where pidfd_getfd is missing)")
 }
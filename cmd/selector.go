@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockets"
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+var (
+	selectSocket string
+	selectListen string
+	selectInode  string
+	selectNetNS  string
+	selectGroup  sockets.Group
+)
+
+// addSelectorFlags registers the flags that address a socket by endpoint,
+// inode or control group instead of by <pid> <fd>.
+func addSelectorFlags(c *cobra.Command) {
+	c.Flags().StringVar(&selectSocket, "socket", "", "Select socket by endpoints, e.g. 10.0.0.5:443->10.0.0.9:51234")
+	c.Flags().StringVar(&selectListen, "listen", "", "Select listening socket by local endpoint, e.g. :8080")
+	c.Flags().StringVar(&selectInode, "inode", "", "Select socket by inode")
+	c.Flags().StringVar(&selectNetNS, "netns", "", "Look up endpoints in the network namespace of this pid, or of a path such as /run/netns/<name>")
+	c.Flags().StringVar(&selectGroup.Cgroup, "cgroup", "", "Select sockets of processes in this cgroup, e.g. /system.slice/nginx.service")
+	c.Flags().StringVar(&selectGroup.Unit, "unit", "", "Select sockets of processes in this systemd unit, e.g. nginx.service")
+	c.Flags().StringVar(&selectGroup.Container, "container", "", "Select sockets of processes in the container with this ID prefix")
+}
+
+// netnsPath converts a --netns value into a namespace path.
+func netnsPath(s string) string {
+	if pid, err := strconv.Atoi(s); err == nil {
+		return sockets.NetNSPath(pid)
+	}
+	return s
+}
+
+// socketSelector builds a selector from the selector flags. ok is false when
+// none of them is set.
+func socketSelector() (sel sockets.Selector, ok bool, err error) {
+	switch {
+	case selectSocket != "":
+		sel, err = sockets.ParseSocketSelector(selectSocket)
+	case selectListen != "":
+		sel, err = sockets.ParseListenSelector(selectListen)
+	case selectInode == "" && selectGroup.IsZero():
+		return sel, false, nil
+	}
+	sel.Inode = selectInode
+	sel.Group = selectGroup
+	if selectNetNS != "" {
+		sel.NetNS = netnsPath(selectNetNS)
+	}
+	return sel, true, err
+}
+
+// resolvePidFd returns the pid and fd of the target socket together with the
+// remaining positional arguments. The socket is taken from the selector flags
+// if any is set, otherwise from the leading <pid> <fd> arguments.
+func resolvePidFd(args []string) (pid, fd int, rest []string, err error) {
+	sel, ok, err := socketSelector()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	var pidStr, fdStr string
+	if ok {
+		s, err := sockets.Resolve(sel)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		pidStr, fdStr, rest = s.PID, s.FD, args
+	} else {
+		if len(args) < 2 {
+			return 0, 0, nil, fmt.Errorf("expected <pid> <fd> or one of --socket, --listen, --inode, --cgroup, --unit, --container")
+		}
+		pidStr, fdStr, rest = args[0], args[1], args[2:]
+	}
+
+	pid, err = strconv.Atoi(pidStr)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid pid %q: %w", pidStr, err)
+	}
+	fd, err = strconv.Atoi(fdStr)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid fd %q: %w", fdStr, err)
+	}
+	return pid, fd, rest, nil
+}
+
+// resolveGroup returns every socket selected by the selector flags when a
+// control group is selected. ok is false when no group is selected and the
+// command addresses a single socket with resolvePidFd.
+func resolveGroup() (matched []sockets.SocketInfo, ok bool, err error) {
+	if selectGroup.IsZero() {
+		return nil, false, nil
+	}
+	sel, _, err := socketSelector()
+	if err != nil {
+		return nil, true, err
+	}
+	matched, err = sockets.Select(sel)
+	if err == nil && len(matched) == 0 {
+		err = fmt.Errorf("%w: %s", sockets.ErrNoSocketMatch, sel)
+	}
+	return matched, true, err
+}
+
+// openSocket opens a socket returned by the sockets package.
+func openSocket(s sockets.SocketInfo) (*sockopt.Socket, error) {
+	pid, _ := strconv.Atoi(s.PID)
+	fd, _ := strconv.Atoi(s.FD)
+	return sockopt.Open(pid, fd)
+}
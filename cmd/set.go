@@ -5,6 +5,10 @@ Copyright © 2024 Alexander Vysochin <avyssochin@gmail.com>
 package cmd
 
 import (
+	"fmt"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/snapshot"
+	"github.com/valexz/sox/pkg/sockets"
 	"github.com/valexz/sox/pkg/sockopt"
 	"log/slog"
 	"strconv"
@@ -12,31 +16,146 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// setUsage is the syntax of the set command.
+const setUsage = "sox set <pid> <fd> <option> <value>, sox set --inode <inode> <option> <value> or sox set <selector flags> <option> <value>"
+
 // setCmd represents the set command
 var setCmd = &cobra.Command{
 	Use:   "set",
-	Short: "Set value for single socket option. Example: sox set <process pid> <socket fd> <socket option name> <option value>",
+	Short: "Set value for single socket option. Example: sox set <process pid> <socket fd> <socket option name> <option value> or sox set --inode 123456 <socket option name> <option value>",
 	Run: func(cmd *cobra.Command, args []string) {
-		pid, err := strconv.Atoi(args[0])
+		if matched, ok, err := resolveGroup(); ok {
+			if err == nil && len(args) != 2 {
+				err = fmt.Errorf("expected socket option name and value: %s", setUsage)
+			}
+			if err == nil {
+				var so sockopt.SocketOption
+				if so, err = lookupOption(args[0]); err == nil {
+					_, err = so.Parse(args[1])
+				}
+			}
+			if err != nil {
+				slog.Error("unable to select sockets", slog.Any("err", err))
+				exit(1)
+				return
+			}
+			results := setSockets(matched, args[0], args[1])
+			printResults(results, outputFormat)
+			if n := profile.Failed(results); n > 0 {
+				slog.Error("socket option not set on every socket", slog.Int("failures", n))
+				exit(1)
+			}
+			return
+		}
+
+		pid, fd, args, err := resolvePidFd(args)
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("unable to select socket", slog.Any("err", err))
+			exit(1)
+			return
+		}
+		if len(args) != 2 {
+			slog.Error("expected socket option name and value", slog.String("usage", setUsage))
+			exit(1)
+			return
+		}
+
+		option := args[0]
+		so, err := lookupOption(option)
+		if err == nil {
+			_, err = so.Parse(args[1])
 		}
-		fd, err := strconv.Atoi(args[1])
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("invalid socket option value", slog.Any("err", err))
+			exit(1)
+			return
 		}
 
-		option := args[2]
+		s, err := sockopt.Open(pid, fd)
+		if err != nil {
+			slog.Error("unable to get sockopt fd", slog.Any("err", err))
+			exit(1)
+			return
+		}
+		defer s.Close()
+
+		// The identity is taken before the change, which may alter it. A
+		// socket that cannot be looked up is recorded by its inode.
+		id, err := snapshot.Identify(pid, fd, s)
+		if id.Inode == "" {
+			slog.Error("unable to identify socket", slog.Any("err", err))
+			exit(1)
+			return
+		}
+		if err != nil {
+			slog.Warn("socket not found with sock_diag, journal records its inode only", slog.Any("err", err))
+		}
 
-		val, err := strconv.Atoi(args[3])
+		change, err := s.Update(option, args[1])
 		if err != nil {
-			slog.Error("strconv.Atoi err", slog.Any("err", err))
+			slog.Error("unable to set socket option", slog.Any("err", err))
+			exit(1)
+			return
 		}
 
-		sockopt.SetSocketOption(pid, fd, option, val, outputFormat)
+		row := sockopt.OptionRow{Name: option, Value: change.New, Description: so.Description}
+		printOptions(row, []string{"SOCKET_OPTION", "VALUE", "DESCRIPTION"}, outputFormat)
+		if requested, err := so.Parse(args[1]); err == nil {
+			if note := so.BufferNote(requested, change.New); note != "" {
+				slog.Info(note)
+			}
+		}
+
+		if change.Old == nil {
+			slog.Warn(option + " cannot be read back, the change is not journalled and cannot be undone")
+			return
+		}
+		journal := snapshot.Journal{Path: journalPath}
+		if err := journal.Record(snapshot.NewChangeSetID(), id, pid, fd, change); err != nil {
+			slog.Error("unable to record change in journal", slog.Any("err", err))
+			exit(1)
+		}
 	},
 }
 
+// setSockets sets option on each socket and records the changes in the
+// journal as one change set, so that a single sox undo reverts them.
+func setSockets(matched []sockets.SocketInfo, option, value string) []profile.SocketResult {
+	journal := snapshot.Journal{Path: journalPath}
+	changeSet := snapshot.NewChangeSetID()
+
+	results := []profile.SocketResult{}
+	for _, s := range matched {
+		res := profile.SocketResult{PID: s.PID, FD: s.FD, Local: s.LocalAddr, Remote: s.RemoteAddr, Options: []profile.OptionResult{}}
+		sock, err := openSocket(s)
+		if err != nil {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		change, err := sock.Update(option, value)
+		sock.Close()
+
+		or := profile.OptionResult{Option: option, Value: change.New}
+		or.Status, or.Error = optionStatus(err)
+		if err == nil && change.Old == nil {
+			or.Error = "cannot be read back, not undoable"
+		}
+		res.Options = append(res.Options, or)
+		results = append(results, res)
+
+		if err == nil && change.Old != nil {
+			pid, _ := strconv.Atoi(s.PID)
+			fd, _ := strconv.Atoi(s.FD)
+			if err := journal.Record(changeSet, snapshot.IdentityOf(s), pid, fd, change); err != nil {
+				slog.Error("unable to record change in journal", slog.Any("err", err))
+			}
+		}
+	}
+	return results
+}
+
 func init() {
 	rootCmd.AddCommand(setCmd)
+	addSelectorFlags(setCmd)
 }
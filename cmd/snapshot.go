@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/snapshot"
+	"github.com/valexz/sox/pkg/sockets"
+)
+
+var (
+	snapshotSelector profile.Selector
+	snapshotFile     string
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Capture all readable options of the matching sockets. Example: sox snapshot --comm nginx --port 443 -f snap.json",
+	Long: `Capture all readable options of the matching sockets.
+
+Sockets are matched by --pid, --comm, --port and --state, and optionally by
+one of --socket, --listen or --inode and by --cgroup, --unit or --container. With --file the JSON snapshot is
+written to that file for use with sox restore; otherwise it is printed in
+the -o format.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sel, ok, err := socketSelector()
+		if err != nil {
+			slog.Error("unable to select socket", slog.Any("err", err))
+			return
+		}
+		var matched []sockets.SocketInfo
+		if ok {
+			matched, err = sockets.Select(sel)
+			filter := sockets.Filter{PID: snapshotSelector.PID, Comm: snapshotSelector.Comm,
+				Port: snapshotSelector.Port, State: snapshotSelector.State}
+			matched = filter.Apply(matched)
+		} else {
+			matched, err = snapshotSelector.Sockets()
+		}
+		if err != nil {
+			slog.Error("unable to list sockets", slog.Any("err", err))
+			return
+		}
+
+		snap := snapshot.Take(matched)
+
+		if snapshotFile == "" {
+			var rows [][]any
+			for _, s := range snap.Sockets {
+				rows = append(rows, []any{s.PID, s.FD, s.Local, s.Remote, s.Inode, len(s.Options), s.Error})
+			}
+			printTable(snap, []string{"PID", "FD", "LOCAL", "REMOTE", "INODE", "OPTIONS", "ERROR"}, rows, outputFormat)
+			return
+		}
+		if err := snap.Save(snapshotFile); err != nil {
+			slog.Error("unable to write snapshot", slog.Any("err", err))
+			return
+		}
+		slog.Info("snapshot written", slog.String("file", snapshotFile), slog.Int("sockets", len(snap.Sockets)))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	addSelectorFlags(snapshotCmd)
+	snapshotCmd.Flags().IntVar(&snapshotSelector.PID, "pid", 0, "Match sockets of this PID")
+	snapshotCmd.Flags().StringVar(&snapshotSelector.Comm, "comm", "", "Match sockets of processes with this name")
+	snapshotCmd.Flags().IntVar(&snapshotSelector.Port, "port", 0, "Match sockets with this local or remote port")
+	snapshotCmd.Flags().StringVar(&snapshotSelector.State, "state", "", "Match sockets in this state, e.g. ESTABLISHED")
+	snapshotCmd.Flags().StringVarP(&snapshotFile, "file", "f", "", "Write the snapshot as JSON to this file")
+}
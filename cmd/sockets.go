@@ -0,0 +1,124 @@
+/*
+Copyright © 2024 Alexander Vysochin <avyssochin@gmail.com>
+*/
+// Package cmd contains the CLI commands implemented using cobra.
+package cmd
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockets"
+)
+
+var (
+	socketsPID     int
+	socketsState   string
+	socketsPort    int
+	socketsLocal   string
+	socketsRemote  string
+	socketsComm    string
+	socketsInfo    bool
+	socketsBackend string
+	socketsProto   []string
+	socketsNetNS   string
+	socketsAllNS   bool
+)
+
+// socketsCmd represents the sockets command
+var socketsCmd = &cobra.Command{
+	Use:   "sockets",
+	Short: "List TCP, UDP, raw and UNIX sockets with owning process and fd. Example: sox sockets --state LISTEN --port 22",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := sockets.Filter{
+			PID:   socketsPID,
+			State: socketsState,
+			Port:  socketsPort,
+			Comm:  socketsComm,
+		}
+
+		var err error
+		if socketsLocal != "" {
+			filter.Local, err = sockets.ParseCIDR(socketsLocal)
+			if err != nil {
+				slog.Error("invalid --local", slog.Any("err", err))
+				return
+			}
+		}
+		if socketsRemote != "" {
+			filter.Remote, err = sockets.ParseCIDR(socketsRemote)
+			if err != nil {
+				slog.Error("invalid --remote", slog.Any("err", err))
+				return
+			}
+		}
+
+		opts := sockets.Options{
+			Protocols: socketsProto,
+			Port:      socketsPort,
+			Info:      socketsInfo,
+			Backend:   socketsBackend,
+			AllNetNS:  socketsAllNS,
+		}
+		if socketsNetNS != "" {
+			opts.NetNS = netnsPath(socketsNetNS)
+		}
+		if socketsState != "" {
+			opts.States = []string{socketsState}
+		}
+
+		all, err := sockets.Discover(opts)
+		if err != nil {
+			slog.Error("unable to list sockets", slog.Any("err", err))
+			return
+		}
+
+		matched := filter.Apply(all)
+		if matched == nil {
+			matched = []sockets.SocketInfo{}
+		}
+
+		headers := []string{"PROTO", "TYPE", "LOCAL", "REMOTE", "STATE", "INODE", "PID", "FD", "COMM"}
+		if socketsAllNS {
+			headers = append([]string{"NETNS"}, headers...)
+		}
+		if socketsInfo {
+			headers = append(headers, "CONG", "RTT", "CWND")
+		}
+
+		rows := make([][]any, 0, len(matched))
+		for _, s := range matched {
+			row := []any{s.Protocol, s.Type, s.LocalAddr, s.RemoteAddr, s.State, s.Inode, s.PID, s.FD, s.Comm}
+			if socketsAllNS {
+				row = append([]any{s.NetNS}, row...)
+			}
+			if socketsInfo {
+				row = append(row, s.Congestion, "", "")
+				if s.TCPInfo != nil {
+					row[len(row)-2] = time.Duration(s.TCPInfo.Rtt) * time.Microsecond
+					row[len(row)-1] = s.TCPInfo.Snd_cwnd
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		printTable(matched, headers, rows, outputFormat)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(socketsCmd)
+	socketsCmd.Flags().IntVar(&socketsPID, "pid", 0, "Only sockets owned by this pid")
+	socketsCmd.Flags().StringSliceVar(&socketsProto, "proto", nil, "Only these protocols: tcp, udp, udplite, raw, unix (default all)")
+	socketsCmd.Flags().StringVar(&socketsState, "state", "", "Only sockets in this state, e.g. LISTEN or ESTABLISHED")
+	socketsCmd.Flags().IntVar(&socketsPort, "port", 0, "Only sockets with this local or remote port")
+	socketsCmd.Flags().StringVar(&socketsLocal, "local", "", "Only sockets with local address in this CIDR")
+	socketsCmd.Flags().StringVar(&socketsRemote, "remote", "", "Only sockets with remote address in this CIDR")
+	socketsCmd.Flags().StringVar(&socketsComm, "comm", "", "Only sockets owned by processes with this command name")
+	socketsCmd.Flags().BoolVar(&socketsInfo, "info", false, "Include congestion control and tcp_info (netlink backend only)")
+	socketsCmd.Flags().StringVar(&socketsBackend, "backend", "", "Discovery backend: netlink or proc (default: netlink with /proc fallback)")
+	socketsCmd.Flags().StringVar(&socketsNetNS, "netns", "", "List the network namespace of this pid, or of a path such as /run/netns/<name>")
+	socketsCmd.Flags().BoolVar(&socketsAllNS, "all-netns", false, "List sockets of every network namespace, labelled with the namespace ID")
+	socketsCmd.MarkFlagsMutuallyExclusive("netns", "all-netns")
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/snapshot"
+)
+
+var journalPath string
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Roll back the last change set recorded by sox set. Example: sox undo",
+	Run: func(cmd *cobra.Command, args []string) {
+		id, results, err := snapshot.Journal{Path: journalPath}.Undo()
+		if results != nil {
+			printResults(results, outputFormat)
+		}
+		if errors.Is(err, snapshot.ErrIncompleteUndo) {
+			slog.Error("change set not fully rolled back, run sox undo again to retry", slog.String("id", id),
+				slog.Int("failures", profile.Failed(results)))
+		} else if err != nil {
+			slog.Error("unable to undo", slog.Any("err", err))
+		}
+		if err != nil {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	for _, c := range []*cobra.Command{setCmd, undoCmd} {
+		c.Flags().StringVar(&journalPath, "journal", snapshot.DefaultJournalPath(), "Journal of changes made by sox set")
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	"github.com/valexz/sox/pkg/sockopt"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	watchInterval time.Duration
+	watchCount    int
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Sample socket options and TCP_INFO fields over time. Example: sox watch <process pid> <socket fd> [<option or tcp_info field>...] --interval 500ms",
+	Run: func(cmd *cobra.Command, args []string) {
+		pid, fd, names, err := resolvePidFd(args)
+		if err != nil {
+			slog.Error("unable to select socket", slog.Any("err", err))
+			return
+		}
+		if watchInterval <= 0 {
+			slog.Error("interval must be positive", slog.Duration("interval", watchInterval))
+			return
+		}
+
+		w, err := sockopt.NewWatcher(pid, fd, names)
+		if err != nil {
+			slog.Error("unable to watch socket", slog.Any("err", err))
+			return
+		}
+		defer w.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		watch(ctx, w, outputFormat)
+	},
+}
+
+// watch prints a sample on every tick until the socket or process goes away,
+// the sample count is reached or ctx is cancelled.
+func watch(ctx context.Context, w *sockopt.Watcher, format string) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for n := 1; ; n++ {
+		s, err := w.Sample()
+		if len(s.Values) > 0 {
+			printSample(s, format)
+		}
+		switch {
+		case errors.Is(err, sockopt.ErrProcessExited), errors.Is(err, sockopt.ErrSocketClosed):
+			slog.Info("stopped watching", slog.Any("reason", err))
+			return
+		case err != nil:
+			slog.Error("unable to sample socket", slog.Any("err", err))
+			return
+		}
+		if watchCount > 0 && n >= watchCount {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var (
+	changedColor = color.New(color.FgYellow, color.Bold)
+	deltaColor   = color.New(color.FgCyan)
+)
+
+// printSample prints one sample. JSON samples are streamed one per line and
+// YAML samples as separate documents. Tables highlight changed values.
+func printSample(s sockopt.Sample, format string) {
+	switch format {
+	case "json":
+		b, err := json.Marshal(s.Record())
+		if err == nil {
+			fmt.Println(string(b))
+		}
+	case "yaml":
+		b, err := yaml.Marshal(s.Record())
+		if err == nil {
+			fmt.Print("---\n" + string(b))
+		}
+	default:
+		table := uitable.New()
+		table.AddRow("NAME", "VALUE", "DELTA")
+		for _, v := range s.Values {
+			val := v.String()
+			if v.Changed {
+				val = changedColor.Sprint(val)
+			}
+			table.AddRow(v.Name, val, deltaColor.Sprint(v.DeltaString()))
+		}
+		fmt.Println(s.Time.Format("15:04:05.000"))
+		fmt.Println(table)
+		fmt.Println()
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	addSelectorFlags(watchCmd)
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", time.Second, "Sampling interval")
+	watchCmd.Flags().IntVar(&watchCount, "count", 0, "Stop after this many samples (0: until the socket closes)")
+}
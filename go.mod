@@ -3,6 +3,7 @@ module github.com/valexz/sox
 go 1.22.0
 
 require (
+	github.com/fatih/color v1.17.0
 	github.com/gosuri/uitable v0.0.4
 	github.com/oraoto/go-pidfd v0.1.1
 	github.com/spf13/cobra v1.8.1
@@ -11,7 +12,6 @@ require (
 )
 
 require (
-	github.com/fatih/color v1.17.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
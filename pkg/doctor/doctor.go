@@ -0,0 +1,263 @@
+// Package doctor checks whether sox can access sockets of other processes in
+// the current environment and explains how to fix what is missing.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/oraoto/go-pidfd"
+	"github.com/valexz/sox/pkg/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+// Check statuses.
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// minKernel is the release that added pidfd_getfd.
+var minKernel = sockopt.KernelVersion{5, 6, 0}
+
+// Paths read by the checks, replaced in tests.
+var (
+	procRoot        = "/proc"
+	ptraceScopePath = "/proc/sys/kernel/yama/ptrace_scope"
+)
+
+// Check is the result of one environment check. Remedy explains how to fix
+// a failed or warning check.
+type Check struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail" yaml:"detail"`
+	Remedy string `json:"remedy,omitempty" yaml:"remedy,omitempty"`
+}
+
+// Run checks the kernel, the capabilities of sox, Yama and the pidfd
+// syscalls. If pid is not 0 it also checks that the sockets of process pid
+// can be duplicated.
+func Run(pid int) []Check {
+	hasPtrace := sockopt.HasCapability(unix.CAP_SYS_PTRACE)
+	scope := ptraceScope()
+
+	checks := []Check{
+		checkKernel(sockopt.RunningKernel()),
+		checkCapability(unix.CAP_SYS_PTRACE, hasPtrace,
+			"only processes of the same user can be inspected", "run sox as root or grant it CAP_SYS_PTRACE"),
+		checkCapability(unix.CAP_NET_ADMIN, sockopt.HasCapability(unix.CAP_NET_ADMIN),
+			"TCP_REPAIR options cannot be set", "run sox as root or grant it CAP_NET_ADMIN"),
+		checkPtraceScope(scope, hasPtrace),
+		checkPidFd(),
+	}
+	if pid != 0 {
+		checks = append(checks, checkTarget(pid, scope, hasPtrace)...)
+	}
+	return checks
+}
+
+// Failed reports whether any check failed.
+func Failed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func checkKernel(v sockopt.KernelVersion, err error) Check {
+	c := Check{Name: "kernel"}
+	switch {
+	case err != nil:
+		c.Status, c.Detail = StatusWarn, "unable to determine kernel version: "+err.Error()
+	case v.Less(minKernel):
+		c.Status, c.Detail = StatusWarn, fmt.Sprintf("Linux %s, pidfd_getfd requires %s; sox falls back to ptrace", v, minKernel)
+		c.Remedy = "upgrade to Linux 5.6 or later to avoid stopping processes"
+	default:
+		c.Status, c.Detail = StatusPass, "Linux "+v.String()
+	}
+	return c
+}
+
+func checkCapability(capability int, has bool, without, remedy string) Check {
+	c := Check{Name: sockopt.CapabilityName(capability)}
+	if has {
+		c.Status, c.Detail = StatusPass, "effective"
+		return c
+	}
+	c.Status, c.Detail, c.Remedy = StatusWarn, "missing; "+without, remedy
+	return c
+}
+
+// ptraceScope returns the Yama ptrace_scope, or -1 if Yama is not enabled.
+func ptraceScope() int {
+	b, err := os.ReadFile(ptraceScopePath)
+	if err != nil {
+		return -1
+	}
+	scope, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return -1
+	}
+	return scope
+}
+
+func checkPtraceScope(scope int, hasPtrace bool) Check {
+	c := Check{Name: "yama ptrace_scope"}
+	switch {
+	case scope < 0:
+		c.Status, c.Detail = StatusPass, "Yama is not enabled"
+	case scope == 0:
+		c.Status, c.Detail = StatusPass, "0 (classic ptrace permissions)"
+	case scope == 3:
+		c.Status, c.Detail = StatusFail, "3 (attaching is disabled)"
+		c.Remedy = "ptrace_scope 3 cannot be lowered at runtime; reboot with kernel.yama.ptrace_scope set to 1 or less"
+	case hasPtrace:
+		c.Status, c.Detail = StatusPass, fmt.Sprintf("%d (allowed with CAP_SYS_PTRACE)", scope)
+	case scope == 1:
+		c.Status, c.Detail = StatusWarn, "1 (only descendants can be inspected without CAP_SYS_PTRACE)"
+		c.Remedy = "run sox as root or with CAP_SYS_PTRACE, or set kernel.yama.ptrace_scope to 0"
+	default:
+		c.Status, c.Detail = StatusFail, fmt.Sprintf("%d (CAP_SYS_PTRACE is required)", scope)
+		c.Remedy = "run sox as root or with CAP_SYS_PTRACE"
+	}
+	return c
+}
+
+// checkPidFd calls pidfd_open and pidfd_getfd on sox itself.
+func checkPidFd() Check {
+	c := Check{Name: "pidfd syscalls"}
+	pidFd, err := pidfd.Open(os.Getpid(), 0)
+	if err == nil {
+		defer unix.Close(int(pidFd))
+		var fd int
+		if fd, err = pidFd.GetFd(int(pidFd), 0); err == nil {
+			unix.Close(fd)
+		}
+	}
+	switch {
+	case err == nil:
+		c.Status, c.Detail = StatusPass, "pidfd_open and pidfd_getfd are available"
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EPERM):
+		c.Status, c.Detail = StatusFail, err.Error()
+		if seccompFiltered() {
+			c.Detail += "; sox runs under a seccomp filter"
+			c.Remedy = "allow pidfd_open and pidfd_getfd in the seccomp profile, e.g. run the container with --security-opt seccomp=unconfined"
+		} else {
+			c.Status, c.Detail = StatusWarn, err.Error()+"; sox falls back to ptrace"
+			c.Remedy = "upgrade to Linux 5.6 or later to avoid stopping processes"
+		}
+	default:
+		c.Status, c.Detail = StatusFail, err.Error()
+	}
+	return c
+}
+
+// seccompFiltered reports whether sox runs in seccomp filter mode.
+func seccompFiltered() bool {
+	b, err := os.ReadFile(procRoot + "/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, "Seccomp:"); ok {
+			return strings.TrimSpace(v) == "2"
+		}
+	}
+	return false
+}
+
+// checkTarget checks that process pid is visible and that one of its socket
+// descriptors can be opened with sockopt.Open.
+func checkTarget(pid, scope int, hasPtrace bool) []Check {
+	proc := procRoot + "/" + strconv.Itoa(pid)
+	process := Check{Name: "process " + strconv.Itoa(pid)}
+	if _, err := os.Stat(proc); err != nil {
+		process.Status, process.Detail = StatusFail, "no such process in sox's PID namespace"
+		process.Remedy = "use the PID as seen from sox, e.g. run sox in the host PID namespace or enter the container's namespace with nsenter"
+		return []Check{process}
+	}
+	process.Status, process.Detail = StatusPass, comm(proc)
+	if own, err := os.Readlink(procRoot + "/self/ns/pid"); err == nil {
+		if other, err := os.Readlink(proc + "/ns/pid"); err == nil && own != other {
+			process.Detail += ", in a child PID namespace"
+		}
+	}
+
+	access := Check{Name: "socket access"}
+	fd, err := firstSocket(proc)
+	if err != nil {
+		access.Status, access.Detail = StatusFail, "unable to list descriptors: "+err.Error()
+		access.Remedy = accessRemedy(pid, scope, hasPtrace)
+		return []Check{process, access}
+	}
+	if fd < 0 {
+		access.Status, access.Detail = StatusWarn, "the process has no sockets"
+		return []Check{process, access}
+	}
+
+	sock, err := sockopt.Open(pid, fd)
+	switch {
+	case err == nil:
+		access.Status, access.Detail = StatusPass, fmt.Sprintf("duplicated socket fd %d", fd)
+		if sock.Fd() < 0 {
+			access.Detail = fmt.Sprintf("accessed socket fd %d with ptrace", fd)
+		}
+		sock.Close()
+	case errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		access.Status, access.Detail = StatusFail, err.Error()
+		access.Remedy = accessRemedy(pid, scope, hasPtrace)
+	default:
+		access.Status, access.Detail = StatusFail, err.Error()
+	}
+	return []Check{process, access}
+}
+
+// accessRemedy explains why duplicating descriptors of pid was refused.
+func accessRemedy(pid, scope int, hasPtrace bool) string {
+	if hasPtrace {
+		return "the process may be protected by an LSM such as SELinux or AppArmor; check the audit log"
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(procRoot+"/"+strconv.Itoa(pid), &st); err == nil && int(st.Uid) != os.Geteuid() {
+		return fmt.Sprintf("the process belongs to uid %d; run sox as that user, as root or with CAP_SYS_PTRACE", st.Uid)
+	}
+	if scope >= 1 {
+		return fmt.Sprintf("ptrace_scope %d only allows descendants; run sox as root or with CAP_SYS_PTRACE", scope)
+	}
+	return "run sox as root or with CAP_SYS_PTRACE"
+}
+
+// firstSocket returns the lowest socket descriptor of a process, or -1.
+func firstSocket(proc string) (int, error) {
+	entries, err := os.ReadDir(proc + "/fd")
+	if err != nil {
+		return -1, err
+	}
+	first := -1
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		link, err := os.Readlink(proc + "/fd/" + e.Name())
+		if err == nil && strings.HasPrefix(link, "socket:") && (first < 0 || fd < first) {
+			first = fd
+		}
+	}
+	return first, nil
+}
+
+func comm(proc string) string {
+	b, err := os.ReadFile(proc + "/comm")
+	if err != nil {
+		return "running"
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,97 @@
+package doctor
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+func TestCheckKernel(t *testing.T) {
+	for _, tc := range []struct {
+		v    sockopt.KernelVersion
+		err  error
+		want string
+	}{
+		{sockopt.KernelVersion{6, 1, 0}, nil, StatusPass},
+		{sockopt.KernelVersion{5, 6, 0}, nil, StatusPass},
+		{sockopt.KernelVersion{5, 4, 0}, nil, StatusWarn},
+		{sockopt.KernelVersion{}, errors.New("uname"), StatusWarn},
+	} {
+		if c := checkKernel(tc.v, tc.err); c.Status != tc.want {
+			t.Errorf("checkKernel(%v): got %s, want %s", tc.v, c.Status, tc.want)
+		}
+	}
+}
+
+func TestCheckPtraceScope(t *testing.T) {
+	for _, tc := range []struct {
+		scope     int
+		hasPtrace bool
+		want      string
+	}{
+		{-1, false, StatusPass},
+		{0, false, StatusPass},
+		{1, false, StatusWarn},
+		{1, true, StatusPass},
+		{2, false, StatusFail},
+		{2, true, StatusPass},
+		{3, true, StatusFail},
+	} {
+		c := checkPtraceScope(tc.scope, tc.hasPtrace)
+		if c.Status != tc.want {
+			t.Errorf("checkPtraceScope(%d, %v): got %s, want %s", tc.scope, tc.hasPtrace, c.Status, tc.want)
+		}
+		if c.Status != StatusPass && c.Remedy == "" {
+			t.Errorf("checkPtraceScope(%d, %v): no remedy", tc.scope, tc.hasPtrace)
+		}
+	}
+}
+
+func TestPtraceScope(t *testing.T) {
+	defer func(p string) { ptraceScopePath = p }(ptraceScopePath)
+
+	ptraceScopePath = filepath.Join(t.TempDir(), "ptrace_scope")
+	if got := ptraceScope(); got != -1 {
+		t.Fatalf("missing file: got %d", got)
+	}
+	if err := os.WriteFile(ptraceScopePath, []byte("2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ptraceScope(); got != 2 {
+		t.Fatalf("got %d, want 2", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	checks := Run(os.Getpid())
+	byName := make(map[string]Check)
+	for _, c := range checks {
+		byName[c.Name] = c
+	}
+	for _, name := range []string{"kernel", "CAP_SYS_PTRACE", "CAP_NET_ADMIN", "yama ptrace_scope", "pidfd syscalls", "socket access"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("missing check %s", name)
+		}
+	}
+	if c := byName["socket access"]; c.Status != StatusPass {
+		t.Errorf("socket access of own process: %+v", c)
+	}
+
+	checks = Run(1 << 22)
+	if c := checks[len(checks)-1]; c.Status != StatusFail || c.Remedy == "" {
+		t.Errorf("missing process: %+v", c)
+	}
+	if !Failed(checks) {
+		t.Error("expected failed checks")
+	}
+}
@@ -0,0 +1,217 @@
+// Package profile applies a set of socket option values to every socket
+// matched by a selector.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/valexz/sox/pkg/sockets"
+	"github.com/valexz/sox/pkg/sockopt"
+	"gopkg.in/yaml.v3"
+)
+
+// Result statuses of a single option.
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Profile lists option values and the sockets they are applied to. Options
+// are keyed by the names of sockopt.OptionsMap.
+type Profile struct {
+	Selector Selector       `json:"selector" yaml:"selector"`
+	Options  map[string]any `json:"options" yaml:"options"`
+}
+
+// Selector matches the sockets a profile is applied to. Zero values match
+// everything.
+type Selector struct {
+	PID   int    `json:"pid" yaml:"pid"`
+	Comm  string `json:"comm" yaml:"comm"`
+	Port  int    `json:"port" yaml:"port"`
+	State string `json:"state" yaml:"state"`
+}
+
+// Setting is a validated option value.
+type Setting struct {
+	Option sockopt.SocketOption
+	Value  any
+}
+
+// SocketResult reports how a profile was applied to one socket.
+type SocketResult struct {
+	PID     string         `json:"pid" yaml:"pid"`
+	FD      string         `json:"fd" yaml:"fd"`
+	Local   string         `json:"local" yaml:"local"`
+	Remote  string         `json:"remote" yaml:"remote"`
+	Error   string         `json:"error,omitempty" yaml:"error,omitempty"`
+	Options []OptionResult `json:"options" yaml:"options"`
+}
+
+// OptionResult reports how a single option was applied. Value is the value
+// read back after it was set.
+type OptionResult struct {
+	Option string `json:"option" yaml:"option"`
+	Value  any    `json:"value,omitempty" yaml:"value,omitempty"`
+	Status string `json:"status" yaml:"status"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Load reads a YAML or JSON profile from path.
+func Load(path string) (Profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+	return Parse(b)
+}
+
+// Parse decodes a YAML or JSON profile. JSON is accepted as a subset of YAML.
+func Parse(b []byte) (Profile, error) {
+	var p Profile
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return Profile{}, fmt.Errorf("invalid profile: %w", err)
+	}
+	if len(p.Options) == 0 {
+		return Profile{}, fmt.Errorf("invalid profile: no options")
+	}
+	return p, nil
+}
+
+// Settings validates the option names and values of the profile and returns
+// them in the order of sockopt.OptionsList.
+func (p Profile) Settings() ([]Setting, error) {
+	for name := range p.Options {
+		if _, ok := sockopt.OptionsMap[name]; !ok {
+			return nil, fmt.Errorf("%w %s", sockopt.ErrUnknownOption, name)
+		}
+	}
+
+	var settings []Setting
+	for _, name := range sockopt.OptionsList {
+		raw, ok := p.Options[name]
+		if !ok {
+			continue
+		}
+		so := sockopt.OptionsMap[name]
+		if !so.Writable() {
+			return nil, fmt.Errorf("%w: %s", sockopt.ErrReadOnly, name)
+		}
+		val, err := settingValue(so, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %v for %s: %w", raw, name, err)
+		}
+		settings = append(settings, Setting{so, val})
+	}
+	return settings, nil
+}
+
+// settingValue converts a decoded profile value. Strings and scalars are
+// parsed like command line input; maps and lists, such as
+// SO_LINGER: {onoff: true, linger: 0}, are decoded like snapshot values.
+func settingValue(so sockopt.SocketOption, raw any) (any, error) {
+	switch raw.(type) {
+	case map[string]any, []any:
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		return so.Unmarshal(b)
+	}
+	return so.Parse(fmt.Sprint(raw))
+}
+
+// Sockets returns the sockets matched by the selector that are owned by a
+// visible process.
+func (sel Selector) Sockets() ([]sockets.SocketInfo, error) {
+	opts := sockets.Options{Port: sel.Port}
+	if sel.State != "" {
+		opts.States = []string{sel.State}
+	}
+	all, err := sockets.Discover(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := sockets.Filter{PID: sel.PID, Comm: sel.Comm, Port: sel.Port, State: sel.State}
+	var owned []sockets.SocketInfo
+	for _, s := range filter.Apply(all) {
+		if s.PID != "" {
+			owned = append(owned, s)
+		}
+	}
+	return owned, nil
+}
+
+// Apply validates the profile and sets its options on every matched socket.
+// An error is returned only if the profile is invalid or sockets cannot be
+// listed; failures on individual sockets and options are reported in the
+// results.
+func (p Profile) Apply() ([]SocketResult, error) {
+	settings, err := p.Settings()
+	if err != nil {
+		return nil, err
+	}
+	matched, err := p.Selector.Sockets()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SocketResult{}
+	for _, s := range matched {
+		results = append(results, applySocket(s, settings))
+	}
+	return results, nil
+}
+
+func applySocket(s sockets.SocketInfo, settings []Setting) SocketResult {
+	res := SocketResult{PID: s.PID, FD: s.FD, Local: s.LocalAddr, Remote: s.RemoteAddr, Options: []OptionResult{}}
+
+	pid, _ := strconv.Atoi(s.PID)
+	fd, _ := strconv.Atoi(s.FD)
+	sock, err := sockopt.Open(pid, fd)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer sock.Close()
+
+	for _, st := range settings {
+		or := OptionResult{Option: st.Option.Name}
+		err := sock.Set(st.Option.Name, st.Value)
+		switch {
+		case errors.Is(err, sockopt.ErrNotApplicable):
+			or.Status = StatusSkipped
+			or.Error = err.Error()
+		case err != nil:
+			or.Status = StatusFailed
+			or.Error = err.Error()
+		default:
+			or.Status = StatusOK
+			or.Value, _ = sock.Get(st.Option.Name)
+		}
+		res.Options = append(res.Options, or)
+	}
+	return res
+}
+
+// Failed counts the sockets and options that could not be applied.
+func Failed(results []SocketResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Error != "" {
+			n++
+		}
+		for _, o := range r.Options {
+			if o.Status == StatusFailed {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+func TestParseProfile(t *testing.T) {
+	yamlProfile := `
+selector:
+  comm: nginx
+  port: 443
+  state: ESTABLISHED
+options:
+  TCP_NODELAY: true
+  TCP_KEEPIDLE: 60
+  SO_RCVTIMEO: 1.5s
+  SO_LINGER: {onoff: true, linger: 0}
+`
+	jsonProfile := `{"selector": {"comm": "nginx", "port": 443, "state": "ESTABLISHED"},
+		"options": {"TCP_NODELAY": true, "TCP_KEEPIDLE": 60, "SO_RCVTIMEO": "1.5s",
+			"SO_LINGER": {"onoff": true, "linger": 0}}}`
+
+	for _, in := range []string{yamlProfile, jsonProfile} {
+		p, err := Parse([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Selector != (Selector{Comm: "nginx", Port: 443, State: "ESTABLISHED"}) {
+			t.Fatalf("unexpected selector %+v", p.Selector)
+		}
+		settings, err := p.Settings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range settings {
+			names = append(names, s.Option.Name)
+		}
+		if got := strings.Join(names, ","); got != "SO_LINGER,SO_RCVTIMEO,TCP_KEEPIDLE,TCP_NODELAY" {
+			t.Fatalf("unexpected settings order %s", got)
+		}
+		if settings[0].Value != (sockopt.Linger{OnOff: true}) {
+			t.Fatalf("unexpected SO_LINGER value %#v", settings[0].Value)
+		}
+		if settings[3].Value != true {
+			t.Fatalf("unexpected TCP_NODELAY value %#v", settings[3].Value)
+		}
+	}
+}
+
+func TestInvalidProfile(t *testing.T) {
+	for _, in := range []string{
+		"selector: {pid: 1}",
+		"options: {TCP_NOPE: 1}",
+		"options: {TCP_KEEPIDLE: fast}",
+		"options: {SO_TYPE: 1}",
+		"options: [TCP_NODELAY]",
+		"options: {SO_LINGER: {onoff: maybe}}",
+		"options: {TCP_KEEPIDLE: [60]}",
+	} {
+		p, err := Parse([]byte(in))
+		if err == nil {
+			_, err = p.Settings()
+		}
+		if err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	p := Profile{
+		Selector: Selector{PID: os.Getpid(), Port: l.Addr().(*net.TCPAddr).Port, State: "ESTABLISHED"},
+		Options:  map[string]any{"TCP_KEEPIDLE": 42, "UDP_CORK": true},
+	}
+	results, err := p.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Skipf("expected both ends of the connection, got %d sockets (insufficient privileges?)", len(results))
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			t.Skipf("unable to access socket: %s", r.Error)
+		}
+		if len(r.Options) != 2 {
+			t.Fatalf("unexpected results %+v", r.Options)
+		}
+		if o := r.Options[0]; o.Option != "TCP_KEEPIDLE" || o.Status != StatusOK || o.Value != 42 {
+			t.Fatalf("unexpected TCP_KEEPIDLE result %+v", o)
+		}
+		if o := r.Options[1]; o.Option != "UDP_CORK" || o.Status != StatusSkipped {
+			t.Fatalf("unexpected UDP_CORK result %+v", o)
+		}
+	}
+	if n := Failed(results); n != 0 {
+		t.Fatalf("unexpected failures %d", n)
+	}
+}
@@ -0,0 +1,183 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/sockopt"
+)
+
+var (
+	// ErrNothingToUndo is returned by Journal.Undo when every change set in
+	// the journal has been rolled back.
+	ErrNothingToUndo = errors.New("nothing to undo")
+	// ErrIncompleteUndo is returned by Journal.Undo with the results when
+	// part of the change set could not be rolled back.
+	ErrIncompleteUndo = errors.New("change set not fully rolled back")
+)
+
+// Journal is an append-only log of option changes stored as JSON lines.
+type Journal struct {
+	Path string
+}
+
+// Entry is a journal line. It either records one option change of a change
+// set or marks the change set Undo as rolled back.
+type Entry struct {
+	ID     string          `json:"id"`
+	Time   time.Time       `json:"time"`
+	Socket *Identity       `json:"socket,omitempty"`
+	PID    string          `json:"pid,omitempty"`
+	FD     string          `json:"fd,omitempty"`
+	Option string          `json:"option,omitempty"`
+	Old    json.RawMessage `json:"old,omitempty"`
+	New    json.RawMessage `json:"new,omitempty"`
+	Undo   string          `json:"undo,omitempty"`
+}
+
+// DefaultJournalPath returns $XDG_STATE_HOME/sox/journal.jsonl, falling back
+// to ~/.local/state when XDG_STATE_HOME is not set.
+func DefaultJournalPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "sox", "journal.jsonl")
+}
+
+// NewChangeSetID returns an identifier for the changes of one invocation.
+func NewChangeSetID() string {
+	return time.Now().UTC().Format("20060102T150405.000000000Z")
+}
+
+// Record appends the changes made to one socket as change set id.
+func (j Journal) Record(id string, socket Identity, pid, fd int, changes ...sockopt.Change) error {
+	entries := make([]Entry, 0, len(changes))
+	for _, c := range changes {
+		oldVal, err := json.Marshal(c.Old)
+		if err != nil {
+			return err
+		}
+		newVal, err := json.Marshal(c.New)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{ID: id, Time: time.Now(), Socket: &socket,
+			PID: fmt.Sprint(pid), FD: fmt.Sprint(fd), Option: c.Option, Old: oldVal, New: newVal})
+	}
+	return j.append(entries...)
+}
+
+// Entries reads the journal. A missing journal is empty.
+func (j Journal) Entries() ([]Entry, error) {
+	f, err := os.Open(j.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid journal %s line %d: %w", j.Path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Undo rolls back the last change set that has not been undone yet by
+// restoring the old values of its options, and marks it as undone. The id of
+// the change set is returned with the results. If any socket or option
+// fails, the change set is not marked and the next Undo retries it.
+func (j Journal) Undo() (string, []profile.SocketResult, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return "", nil, err
+	}
+
+	undone := make(map[string]bool)
+	for _, e := range entries {
+		if e.Undo != "" {
+			undone[e.Undo] = true
+		}
+	}
+	var id string
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.Undo == "" && !undone[e.ID] {
+			id = e.ID
+			break
+		}
+	}
+	if id == "" {
+		return "", nil, ErrNothingToUndo
+	}
+
+	// Later changes of the same option are rolled back first, so the oldest
+	// value of each option in the change set wins.
+	var targets []target
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.ID != id || e.Socket == nil {
+			continue
+		}
+		t := findTarget(targets, *e.Socket)
+		if t == nil {
+			targets = append(targets, target{id: *e.Socket, pid: e.PID, fd: e.FD, options: map[string]json.RawMessage{}})
+			t = &targets[len(targets)-1]
+		}
+		t.options[e.Option] = e.Old
+	}
+
+	results, err := apply(targets)
+	if err != nil {
+		return id, nil, err
+	}
+	if n := profile.Failed(results); n > 0 {
+		return id, results, fmt.Errorf("%w: %d failures", ErrIncompleteUndo, n)
+	}
+	return id, results, j.append(Entry{ID: NewChangeSetID(), Time: time.Now(), Undo: id})
+}
+
+func findTarget(targets []target, id Identity) *target {
+	for i := range targets {
+		if targets[i].id == id {
+			return &targets[i]
+		}
+	}
+	return nil
+}
+
+func (j Journal) append(entries ...Entry) error {
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,368 @@
+// Package snapshot captures socket option values and re-applies them later,
+// either from a snapshot file or from the journal of changes made by sox set.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/sockets"
+	"github.com/valexz/sox/pkg/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+// StatusUnchanged is reported for options that already have the recorded
+// value and are therefore not set again.
+const StatusUnchanged = "unchanged"
+
+// Identity identifies a socket across processes and descriptors. The inode
+// alone may be reused by a new socket, so the endpoints must match as well.
+// NetNS is the ID of the socket's network namespace; records without it are
+// looked up in the namespace of sox. Sockets that could not be looked up are
+// recorded with the inode only.
+type Identity struct {
+	Inode    string `json:"inode"`
+	Protocol string `json:"protocol"`
+	Local    string `json:"local"`
+	Remote   string `json:"remote"`
+	NetNS    string `json:"netns,omitempty"`
+}
+
+// Snapshot holds the option values of a set of sockets.
+type Snapshot struct {
+	Time    time.Time        `json:"time"`
+	Sockets []SocketSnapshot `json:"sockets"`
+}
+
+// SocketSnapshot holds the option values of one socket. Values are stored as
+// JSON so that they can be decoded with the option's kind on restore.
+type SocketSnapshot struct {
+	Identity
+	PID     string                     `json:"pid"`
+	FD      string                     `json:"fd"`
+	Comm    string                     `json:"comm"`
+	Options map[string]json.RawMessage `json:"options"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+// IdentityOf returns the identity of a discovered socket.
+func IdentityOf(s sockets.SocketInfo) Identity {
+	return Identity{Inode: s.Inode, Protocol: s.Protocol, Local: s.LocalAddr, Remote: s.RemoteAddr, NetNS: s.NetNS}
+}
+
+// same reports whether the socket s still has identity id.
+func (id Identity) same(s sockets.SocketInfo) bool {
+	if id.Protocol == "" {
+		return s.Inode == id.Inode
+	}
+	got := IdentityOf(s)
+	if id.NetNS == "" {
+		got.NetNS = ""
+	}
+	return got == id
+}
+
+// Identify returns the identity of descriptor fd of process pid, which s is
+// open on. If the socket cannot be looked up, e.g. netlink sockets or those
+// of a namespace sox cannot enter, the identity holds only the inode and the
+// error says why.
+func Identify(pid, fd int, s *sockopt.Socket) (Identity, error) {
+	found, err := Lookup(pid, fd, s)
+	if err != nil {
+		return Identity{Inode: found.Inode}, err
+	}
+	return IdentityOf(found), nil
+}
+
+// Lookup returns descriptor fd of process pid, which s is open on. The inode
+// is read from /proc and the socket is looked up by its addresses or inode
+// with sockets.Lookup, which is much cheaper than discovering every socket.
+// If that fails, the result holds the inode, pid and fd only.
+func Lookup(pid, fd int, s *sockopt.Socket) (sockets.SocketInfo, error) {
+	inode, err := sockets.FdInode(pid, fd)
+	if err != nil {
+		return sockets.SocketInfo{}, err
+	}
+	q := sockets.SocketInfo{Inode: inode, PID: strconv.Itoa(pid), FD: strconv.Itoa(fd)}
+
+	domain, _ := s.Domain()
+	sockType, protocol, err := s.Kind()
+	if err != nil {
+		return q, err
+	}
+	name, ok := sockets.ProtocolName(domain, sockType, protocol)
+	if !ok {
+		return q, fmt.Errorf("sock_diag does not list sockets of family %d and type %d", domain, sockType)
+	}
+	query := q
+	query.Protocol, query.LocalAddr, query.RemoteAddr = name, s.Name(), s.PeerName()
+	if name != "unix" {
+		local, err := netip.ParseAddrPort(query.LocalAddr)
+		if err != nil {
+			return q, fmt.Errorf("unable to get local address of socket inode %s", inode)
+		}
+		if sockType == unix.SOCK_RAW {
+			// sock_diag reports the protocol as the port of raw sockets
+			query.LocalAddr = netip.AddrPortFrom(local.Addr(), uint16(protocol)).String()
+		}
+		if query.RemoteAddr == "" {
+			unspecified := netip.IPv4Unspecified()
+			if local.Addr().Is6() {
+				unspecified = netip.IPv6Unspecified()
+			}
+			query.RemoteAddr = netip.AddrPortFrom(unspecified, 0).String()
+		}
+	}
+
+	found, err := sockets.Lookup(sockets.NetNSPath(pid), query)
+	if err != nil {
+		return q, err
+	}
+	return found, nil
+}
+
+// Take captures every readable option of each socket. Sockets that cannot
+// be accessed are recorded with an error.
+func Take(matched []sockets.SocketInfo) Snapshot {
+	snap := Snapshot{Time: time.Now(), Sockets: []SocketSnapshot{}}
+	for _, s := range matched {
+		snap.Sockets = append(snap.Sockets, takeSocket(s))
+	}
+	return snap
+}
+
+func takeSocket(s sockets.SocketInfo) SocketSnapshot {
+	ss := SocketSnapshot{Identity: IdentityOf(s), PID: s.PID, FD: s.FD, Comm: s.Comm,
+		Options: map[string]json.RawMessage{}}
+
+	sock, err := open(s)
+	if err != nil {
+		ss.Error = err.Error()
+		return ss
+	}
+	defer sock.Close()
+
+	rows, _ := sock.List()
+	for _, r := range rows {
+		if r.Status != "" {
+			continue
+		}
+		if b, err := json.Marshal(r.Value); err == nil {
+			ss.Options[r.Name] = b
+		}
+	}
+	return ss
+}
+
+// Save writes the snapshot as JSON to path.
+func (snap Snapshot) Save(path string) error {
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// Load reads a snapshot file.
+func Load(path string) (Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// Restore re-applies the captured values to the sockets that still exist.
+// Options that already have the captured value are left alone.
+func (snap Snapshot) Restore() ([]profile.SocketResult, error) {
+	targets := make([]target, 0, len(snap.Sockets))
+	for _, ss := range snap.Sockets {
+		if ss.Error == "" {
+			targets = append(targets, target{id: ss.Identity, pid: ss.PID, fd: ss.FD, options: ss.Options})
+		}
+	}
+	return apply(targets)
+}
+
+// target is a set of option values recorded for a socket and the descriptor
+// it was recorded at.
+type target struct {
+	id      Identity
+	pid, fd string
+	options map[string]json.RawMessage
+}
+
+// apply sets the recorded values on the sockets that still exist.
+func apply(targets []target) ([]profile.SocketResult, error) {
+	byInode, err := discover(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []profile.SocketResult{}
+	for _, t := range targets {
+		s, ok := byInode[t.id.Inode]
+		if !ok {
+			s, ok = t.recorded()
+		}
+		if !ok || !t.id.same(s) {
+			results = append(results, profile.SocketResult{Local: t.id.Local, Remote: t.id.Remote,
+				Error: "socket inode " + t.id.Inode + " no longer exists", Options: []profile.OptionResult{}})
+			continue
+		}
+		results = append(results, applySocket(s, t.options))
+	}
+	return results, nil
+}
+
+// recorded returns the socket at the descriptor t was recorded at if it is
+// still the socket with t's inode. This only applies to sockets recorded with
+// their inode alone, which discovery may not know.
+func (t target) recorded() (sockets.SocketInfo, bool) {
+	if t.id.Protocol != "" {
+		return sockets.SocketInfo{}, false
+	}
+	pid, err := strconv.Atoi(t.pid)
+	if err != nil {
+		return sockets.SocketInfo{}, false
+	}
+	fd, err := strconv.Atoi(t.fd)
+	if err != nil {
+		return sockets.SocketInfo{}, false
+	}
+	if inode, err := sockets.FdInode(pid, fd); err != nil || inode != t.id.Inode {
+		return sockets.SocketInfo{}, false
+	}
+	return sockets.SocketInfo{Inode: t.id.Inode, PID: t.pid, FD: t.fd}, true
+}
+
+// discover returns the owned sockets of sox's network namespace and of the
+// other namespaces the targets were recorded in, keyed by inode. Namespaces
+// that no longer exist are skipped.
+func discover(targets []target) (map[string]sockets.SocketInfo, error) {
+	all, err := sockets.List()
+	if err != nil {
+		return nil, err
+	}
+	own, err := sockets.OpenNetNS("/proc/self/ns/net")
+	if err != nil {
+		return nil, err
+	}
+
+	need := make(map[string]bool)
+	for _, t := range targets {
+		if t.id.NetNS != "" && t.id.NetNS != own.ID {
+			need[t.id.NetNS] = true
+		}
+	}
+	if len(need) > 0 {
+		namespaces, err := sockets.NetNamespaces()
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaces {
+			if !need[ns.ID] {
+				continue
+			}
+			found, err := sockets.Discover(sockets.Options{NetNS: ns.Path})
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, found...)
+		}
+	}
+
+	byInode := make(map[string]sockets.SocketInfo)
+	for _, s := range all {
+		if s.PID != "" {
+			byInode[s.Inode] = s
+		}
+	}
+	return byInode, nil
+}
+
+func applySocket(s sockets.SocketInfo, values map[string]json.RawMessage) profile.SocketResult {
+	res := profile.SocketResult{PID: s.PID, FD: s.FD, Local: s.LocalAddr, Remote: s.RemoteAddr,
+		Options: []profile.OptionResult{}}
+
+	sock, err := open(s)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer sock.Close()
+
+	for _, name := range sockopt.OptionsList {
+		raw, ok := values[name]
+		if !ok {
+			continue
+		}
+		res.Options = append(res.Options, restoreOption(sock, sockopt.OptionsMap[name], raw))
+	}
+	return res
+}
+
+func restoreOption(sock *sockopt.Socket, so sockopt.SocketOption, raw json.RawMessage) profile.OptionResult {
+	or := profile.OptionResult{Option: so.Name}
+	if so.Volatile || !so.Writable() {
+		or.Status = profile.StatusSkipped
+		or.Error = "not restorable"
+		return or
+	}
+	if string(raw) == "null" {
+		// nothing was read before a write-only option was changed
+		or.Status = profile.StatusSkipped
+		or.Error = "no value recorded"
+		return or
+	}
+	val, err := so.Unmarshal(raw)
+	if err != nil {
+		or.Status = profile.StatusFailed
+		or.Error = err.Error()
+		return or
+	}
+
+	read := so.Name
+	if so.ReadAs != "" {
+		read = so.ReadAs
+	}
+	if cur, err := sock.Get(read); err == nil && fmt.Sprint(cur) == fmt.Sprint(val) {
+		or.Status = StatusUnchanged
+		or.Value = cur
+		return or
+	}
+	if err := sock.Set(so.Name, so.Requested(val)); err != nil {
+		or.Status = profile.StatusFailed
+		or.Error = err.Error()
+		return or
+	}
+	or.Status = profile.StatusOK
+	or.Value, _ = sock.Get(read)
+	return or
+}
+
+// open opens the socket of a discovered socket's owner.
+func open(s sockets.SocketInfo) (*sockopt.Socket, error) {
+	pid, err := strconv.Atoi(s.PID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid %q", s.PID)
+	}
+	fd, err := strconv.Atoi(s.FD)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fd %q", s.FD)
+	}
+	return sockopt.Open(pid, fd)
+}
@@ -0,0 +1,295 @@
+package snapshot
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/valexz/sox/pkg/profile"
+	"github.com/valexz/sox/pkg/sockets"
+	"github.com/valexz/sox/pkg/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+// ownSocket dials a connection and returns the discovered client socket.
+func ownSocket(t *testing.T) (net.Conn, int, sockets.SocketInfo) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	var fd int
+	raw, err := c.(syscall.Conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Control(func(f uintptr) { fd = int(f) })
+
+	inode, err := sockets.FdInode(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := sockets.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range all {
+		if s.Inode == inode && s.PID != "" {
+			return c, fd, s
+		}
+	}
+	t.Skip("own socket not owned by a visible process")
+	return nil, 0, sockets.SocketInfo{}
+}
+
+func TestIdentify(t *testing.T) {
+	c, fd, own := ownSocket(t)
+	identify := func(fd int) (Identity, error) {
+		s, err := sockopt.Open(os.Getpid(), fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		return Identify(os.Getpid(), fd, s)
+	}
+
+	id, err := identify(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != IdentityOf(own) || id.Protocol != "tcp" || id.Local != c.LocalAddr().String() || id.Remote != c.RemoteAddr().String() {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+
+	pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(pair[0])
+	defer unix.Close(pair[1])
+	if id, err := identify(pair[0]); err != nil || id.Protocol != "unix" || id.Inode == "" {
+		t.Fatalf("unix socket: %+v %v", id, err)
+	}
+
+	// sockets that sock_diag does not list are identified by inode
+	nl, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(nl)
+	inode, _ := sockets.FdInode(os.Getpid(), nl)
+	if id, err := identify(nl); err == nil || id != (Identity{Inode: inode}) {
+		t.Fatalf("netlink socket: %+v %v", id, err)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := sockets.FdInode(os.Getpid(), int(f.Fd())); err == nil {
+		t.Fatal("expected error for a regular file")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	_, fd, s := ownSocket(t)
+	idle := sockopt.OptionsMap["TCP_KEEPIDLE"]
+
+	if err := idle.Set(fd, 100); err != nil {
+		t.Fatal(err)
+	}
+	snap := Take([]sockets.SocketInfo{s})
+	if len(snap.Sockets) != 1 || snap.Sockets[0].Error != "" {
+		t.Fatalf("unexpected snapshot %+v", snap.Sockets)
+	}
+	if got := string(snap.Sockets[0].Options["TCP_KEEPIDLE"]); got != "100" {
+		t.Fatalf("unexpected TCP_KEEPIDLE %s", got)
+	}
+
+	path := t.TempDir() + "/snap.json"
+	if err := snap.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idle.Set(fd, 200); err != nil {
+		t.Fatal(err)
+	}
+	results, err := loaded.Restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for _, o := range results[0].Options {
+		switch o.Option {
+		case "TCP_KEEPIDLE":
+			if o.Status != "ok" {
+				t.Fatalf("TCP_KEEPIDLE not restored: %+v", o)
+			}
+		case "TCP_NODELAY":
+			if o.Status != StatusUnchanged {
+				t.Fatalf("TCP_NODELAY unexpectedly set: %+v", o)
+			}
+		}
+	}
+	if v, _ := idle.Get(fd); v != 100 {
+		t.Fatalf("TCP_KEEPIDLE is %v after restore", v)
+	}
+}
+
+func TestJournalUndo(t *testing.T) {
+	_, fd, s := ownSocket(t)
+	j := Journal{Path: t.TempDir() + "/state/journal.jsonl"}
+
+	if _, _, err := j.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expected ErrNothingToUndo, got %v", err)
+	}
+
+	initial, err := unix.GetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := os.Getpid()
+	for i, val := range []string{"30", "40"} {
+		sock, err := sockopt.Open(pid, fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change, err := sock.Update("TCP_KEEPIDLE", val)
+		sock.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := j.Record("set"+strconv.Itoa(i), IdentityOf(s), pid, fd, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []int{30, initial} {
+		if _, _, err := j.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		v, err := unix.GetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != want {
+			t.Fatalf("TCP_KEEPIDLE is %d after undo, want %d", v, want)
+		}
+	}
+	if _, _, err := j.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expected ErrNothingToUndo, got %v", err)
+	}
+}
+
+func TestJournalUndoInode(t *testing.T) {
+	nl, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(nl)
+	pid := os.Getpid()
+	inode, err := sockets.FdInode(pid, nl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock, err := sockopt.Open(pid, nl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := sock.Update("SO_PRIORITY", "5")
+	sock.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := Journal{Path: t.TempDir() + "/journal.jsonl"}
+	if err := j.Record("set", Identity{Inode: inode}, pid, nl, change); err != nil {
+		t.Fatal(err)
+	}
+
+	_, results, err := j.Undo()
+	if err != nil || len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("undo of inode-only entry: %+v %v", results, err)
+	}
+	if v, _ := unix.GetsockoptInt(nl, unix.SOL_SOCKET, unix.SO_PRIORITY); v != 0 {
+		t.Fatalf("SO_PRIORITY is %d after undo, want 0", v)
+	}
+}
+
+func TestJournalUndoWriteOnly(t *testing.T) {
+	nl, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(nl)
+	pid := os.Getpid()
+	inode, err := sockets.FdInode(pid, nl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := unix.GetsockoptInt(nl, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock, err := sockopt.Open(pid, nl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := sock.Update("SO_RCVBUFFORCE", before+4096)
+	sock.Close()
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("SO_RCVBUFFORCE needs CAP_NET_ADMIN")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Old == nil || change.New == nil {
+		t.Fatalf("change of write-only option not read back: %+v", change)
+	}
+	j := Journal{Path: t.TempDir() + "/journal.jsonl"}
+	if err := j.Record("set", Identity{Inode: inode}, pid, nl, change); err != nil {
+		t.Fatal(err)
+	}
+
+	_, results, err := j.Undo()
+	if err != nil || len(results) != 1 || profile.Failed(results) != 0 {
+		t.Fatalf("undo of SO_RCVBUFFORCE: %+v %v", results, err)
+	}
+	if v, _ := unix.GetsockoptInt(nl, unix.SOL_SOCKET, unix.SO_RCVBUF); v != before {
+		t.Fatalf("SO_RCVBUF is %d after undo, want %d", v, before)
+	}
+}
+
+func TestJournalUndoIncomplete(t *testing.T) {
+	_, fd, s := ownSocket(t)
+	j := Journal{Path: t.TempDir() + "/journal.jsonl"}
+	change := sockopt.Change{Option: "TCP_KEEPIDLE", Old: -1, New: 30}
+	if err := j.Record("set", IdentityOf(s), os.Getpid(), fd, change); err != nil {
+		t.Fatal(err)
+	}
+
+	// the change set stays undoable until its rollback succeeds
+	for range 2 {
+		id, results, err := j.Undo()
+		if !errors.Is(err, ErrIncompleteUndo) || id != "set" || profile.Failed(results) != 1 {
+			t.Fatalf("undo of invalid value: %s %+v %v", id, results, err)
+		}
+	}
+}
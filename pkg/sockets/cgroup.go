@@ -0,0 +1,153 @@
+package sockets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrAmbiguousContainer is returned when a container ID prefix matches more
+// than one container.
+var ErrAmbiguousContainer = errors.New("several containers match prefix")
+
+// containerID matches a cgroup path component named after a container, e.g.
+// "<id>", "docker-<id>.scope", "cri-containerd-<id>.scope", "crio-<id>.scope"
+// or "libpod-<id>.scope".
+var containerID = regexp.MustCompile(`^(?:[a-z-]+-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+var hexDigits = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// Group selects processes by control group. Cgroup matches a cgroup and its
+// descendants, Unit a systemd unit and Container the ID prefix of a Docker,
+// Podman, containerd or CRI-O container. Zero fields match every process.
+type Group struct {
+	Cgroup    string `json:"cgroup,omitempty" yaml:"cgroup,omitempty"`
+	Unit      string `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Container string `json:"container,omitempty" yaml:"container,omitempty"`
+}
+
+// IsZero reports whether the group matches every process.
+func (g Group) IsZero() bool {
+	return g == Group{}
+}
+
+func (g Group) String() string {
+	var parts []string
+	if g.Cgroup != "" {
+		parts = append(parts, "cgroup "+g.cgroup())
+	}
+	if g.Unit != "" {
+		parts = append(parts, "unit "+g.unit())
+	}
+	if g.Container != "" {
+		parts = append(parts, "container "+g.Container)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cgroup returns Cgroup relative to the cgroup root. Paths below the cgroup2
+// mount point are accepted as well.
+func (g Group) cgroup() string {
+	p := strings.TrimPrefix(filepath.Clean("/"+g.Cgroup), "/sys/fs/cgroup")
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// unit returns Unit with the ".service" suffix systemctl assumes for names
+// without a unit type.
+func (g Group) unit() string {
+	if strings.Contains(g.Unit, ".") {
+		return g.Unit
+	}
+	return g.Unit + ".service"
+}
+
+// match reports whether a process in the cgroups at paths belongs to the
+// group. The container ID found in paths, if any, is returned as well.
+func (g Group) match(paths []string) (id string, ok bool) {
+	var cgroupOK, unitOK bool
+	for _, p := range paths {
+		if c := g.cgroup(); c == "/" || p == c || strings.HasPrefix(p, c+"/") {
+			cgroupOK = true
+		}
+		for _, name := range strings.Split(p, "/") {
+			if name == g.unit() {
+				unitOK = true
+			}
+			// conmon monitors a container from a scope named after it
+			if m := containerID.FindStringSubmatch(name); m != nil && !strings.Contains(name, "conmon") {
+				id = m[1]
+			}
+		}
+	}
+	if g.Cgroup != "" && !cgroupOK || g.Unit != "" && !unitOK {
+		return "", false
+	}
+	if g.Container != "" && !strings.HasPrefix(id, g.Container) {
+		return "", false
+	}
+	return id, true
+}
+
+// parseCgroup returns the cgroup paths listed in /proc/<pid>/cgroup, one per
+// hierarchy.
+func parseCgroup(b []byte) []string {
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		if f := strings.SplitN(line, ":", 3); len(f) == 3 {
+			paths = append(paths, f[2])
+		}
+	}
+	return paths
+}
+
+// Processes returns the visible processes that belong to the group, in pid
+// order. ErrAmbiguousContainer is returned if Container matches the ID of
+// more than one container.
+func (g Group) Processes() ([]int, error) {
+	if g.Container != "" && !hexDigits.MatchString(g.Container) {
+		return nil, fmt.Errorf("invalid container ID %q, expected hexadecimal digits", g.Container)
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	var ids []string
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join("/proc", proc.Name(), "cgroup"))
+		if err != nil {
+			continue
+		}
+		id, ok := g.match(parseCgroup(b))
+		if !ok {
+			continue
+		}
+		pids = append(pids, pid)
+		if g.Container != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) > 1 {
+		for i, id := range ids {
+			ids[i] = id[:12]
+		}
+		return nil, fmt.Errorf("%w %s: %s", ErrAmbiguousContainer, g.Container, strings.Join(ids, ", "))
+	}
+	slices.Sort(pids)
+	return pids, nil
+}
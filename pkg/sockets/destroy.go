@@ -0,0 +1,104 @@
+package sockets
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Destroy closes an inet socket from outside the owning process by sending
+// SOCK_DESTROY through sock_diag. A TCP connection is aborted with a RST and
+// the owner's next call on the socket fails with ECONNABORTED. s must be a
+// socket returned by Discover: it is looked up by its addresses in its
+// network namespace and destroyed only if its inode still matches.
+//
+// Destroy requires CAP_NET_ADMIN in the socket's network namespace and a
+// kernel built with CONFIG_INET_DIAG_DESTROY (Linux 4.5, UDP 4.6, raw 4.9).
+func Destroy(s SocketInfo) error {
+	req, err := exactRequest(s)
+	if err != nil {
+		return fmt.Errorf("unable to destroy socket: %w", err)
+	}
+	ns, err := socketNetNS(s)
+	if err != nil {
+		return err
+	}
+	own, err := ownNetNS()
+	if err != nil {
+		return err
+	}
+
+	destroy := func() error {
+		fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+		if err != nil {
+			return fmt.Errorf("unable to open sock_diag socket: %w", err)
+		}
+		defer unix.Close(fd)
+
+		// The lookup returns the socket cookie, which makes SOCK_DESTROY
+		// act on that exact socket even if the addresses are reused.
+		msg := make([]byte, sizeofInetDiagReqV2)
+		*(*inetDiagReqV2)(unsafe.Pointer(&msg[0])) = getRequest(req)
+		b, err := diagGet(fd, msg)
+		if err != nil {
+			return err
+		}
+		if len(b) < sizeofInetDiagMsg {
+			return fmt.Errorf("%w: %s %s->%s is gone", ErrNoSocketMatch, s.Protocol, s.LocalAddr, s.RemoteAddr)
+		}
+		m := *(*inetDiagMsg)(unsafe.Pointer(&b[0]))
+		inode := strconv.FormatUint(uint64(m.Inode), 10)
+		req.ID.Cookie = m.ID.Cookie
+		if s.Inode != "" && inode != s.Inode {
+			return fmt.Errorf("%w: %s %s->%s is now inode %s, not %s", ErrNoSocketMatch, s.Protocol, s.LocalAddr, s.RemoteAddr, inode, s.Inode)
+		}
+
+		*(*inetDiagReqV2)(unsafe.Pointer(&msg[0])) = req
+		err = diagRequest(fd, unix.SOCK_DESTROY, unix.NLM_F_ACK, msg, nil, func([]byte) {})
+		if err != nil {
+			return fmt.Errorf("unable to destroy socket: %w%s", err, destroyHint(err))
+		}
+		return nil
+	}
+	if ns.ID == own.ID {
+		return destroy()
+	}
+	return inNetNS(ns, destroy)
+}
+
+// socketNetNS finds the network namespace of s. It is usually that of the
+// owning process; otherwise every namespace on the host is searched.
+func socketNetNS(s SocketInfo) (NetNS, error) {
+	if s.NetNS == "" {
+		return ownNetNS()
+	}
+	if pid, err := strconv.Atoi(s.PID); err == nil {
+		if ns, err := OpenNetNS(NetNSPath(pid)); err == nil && ns.ID == s.NetNS {
+			return ns, nil
+		}
+	}
+	all, err := NetNamespaces()
+	if err != nil {
+		return NetNS{}, err
+	}
+	for _, ns := range all {
+		if ns.ID == s.NetNS {
+			return ns, nil
+		}
+	}
+	return NetNS{}, fmt.Errorf("network namespace %s not found", s.NetNS)
+}
+
+// destroyHint suggests a remedy for a SOCK_DESTROY errno.
+func destroyHint(err error) string {
+	switch {
+	case errors.Is(err, unix.EPERM):
+		return "; SOCK_DESTROY requires CAP_NET_ADMIN"
+	case errors.Is(err, unix.EOPNOTSUPP):
+		return "; the kernel is built without CONFIG_INET_DIAG_DESTROY"
+	}
+	return ""
+}
@@ -0,0 +1,417 @@
+package sockets
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants from linux/inet_diag.h that are not exported by x/sys/unix.
+const (
+	inetDiagReqBytecode = 1
+
+	inetDiagInfo = 2
+	inetDiagCong = 4
+
+	inetDiagBcJmp = 1
+	inetDiagBcSGe = 2
+	inetDiagBcSLe = 3
+	inetDiagBcDGe = 4
+	inetDiagBcDLe = 5
+
+	sizeofInetDiagReqV2 = 56
+	sizeofInetDiagMsg   = 72
+)
+
+// inetDiagSockID mirrors struct inet_diag_sockid. Ports and addresses are in
+// network byte order.
+type inetDiagSockID struct {
+	SPort  [2]byte
+	DPort  [2]byte
+	Src    [16]byte
+	Dst    [16]byte
+	If     uint32
+	Cookie [2]uint32
+}
+
+// inetDiagReqV2 mirrors struct inet_diag_req_v2.
+type inetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       inetDiagSockID
+}
+
+// inetDiagMsg mirrors struct inet_diag_msg.
+type inetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      inetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// diagProtocols maps the protocol names used in SocketInfo to IPPROTO values.
+var diagProtocols = map[string]uint8{
+	"tcp":     unix.IPPROTO_TCP,
+	"udp":     unix.IPPROTO_UDP,
+	"udplite": unix.IPPROTO_UDPLITE,
+	"raw":     unix.IPPROTO_RAW,
+}
+
+// diagDump lists the sockets of one protocol family with a single
+// NETLINK_SOCK_DIAG dump request per address family.
+func diagDump(protocol string, states uint32, port int, info bool) ([]SocketInfo, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sock_diag socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if protocol == "unix" {
+		return unixDiagDump(fd, states)
+	}
+
+	var all []SocketInfo
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		req := inetDiagReqV2{
+			Family:   family,
+			Protocol: diagProtocols[protocol],
+			States:   states,
+		}
+		if protocol == "raw" {
+			// sdiag_raw_protocol shares the pad byte; IPPROTO_RAW matches
+			// raw sockets of any protocol.
+			req.Pad = unix.IPPROTO_RAW
+		}
+		if info && protocol == "tcp" {
+			req.Ext = 1<<(inetDiagInfo-1) | 1<<(inetDiagCong-1)
+		}
+
+		var bytecode []byte
+		if port != 0 {
+			bytecode = portBytecode(uint16(port))
+		}
+
+		name := protocol
+		if family == unix.AF_INET6 {
+			name += "6"
+		}
+
+		msg := make([]byte, sizeofInetDiagReqV2)
+		*(*inetDiagReqV2)(unsafe.Pointer(&msg[0])) = req
+
+		err := diagRequest(fd, unix.SOCK_DIAG_BY_FAMILY, unix.NLM_F_DUMP, msg, bytecode, func(b []byte) {
+			if s, ok := parseDiagMsg(name, b); ok {
+				all = append(all, s)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// portBytecode builds an inet_diag filter program accepting sockets whose
+// source or destination port equals port. GE/LE pairs are used instead of the
+// newer EQ ops so the program is accepted by old kernels as well.
+func portBytecode(port uint16) []byte {
+	// Each comparison takes two ops: the comparison and an op whose "no"
+	// field carries the port. The kernel audits the program along the "yes"
+	// jumps, so the two halves of the OR are joined with a JMP (which always
+	// takes "no") like iproute2 does. Jumping len+4 bytes rejects.
+	ops := [][3]uint16{
+		{inetDiagBcSGe, 8, 20},
+		{0, 0, port},
+		{inetDiagBcSLe, 8, 12},
+		{0, 0, port},
+		{inetDiagBcJmp, 4, 20},
+		{inetDiagBcDGe, 8, 20},
+		{0, 0, port},
+		{inetDiagBcDLe, 8, 12},
+		{0, 0, port},
+	}
+
+	b := make([]byte, 0, 4*len(ops))
+	for _, op := range ops {
+		// struct inet_diag_bc_op { u8 code; u8 yes; u16 no; }
+		b = append(b, byte(op[0]), byte(op[1]))
+		b = binary.NativeEndian.AppendUint16(b, op[2])
+	}
+	return b
+}
+
+// diagRequest sends one request of type typ with an optional bytecode
+// attribute and passes every answer to fn. flags are added to NLM_F_REQUEST
+// and must include NLM_F_DUMP or NLM_F_ACK so that the answer is terminated.
+func diagRequest(fd int, typ, flags uint16, req []byte, bytecode []byte, fn func([]byte)) error {
+	msgLen := unix.NLMSG_HDRLEN + len(req)
+	if bytecode != nil {
+		msgLen += unix.SizeofRtAttr + len(bytecode)
+	}
+
+	msg := make([]byte, msgLen)
+	hdr := (*unix.NlMsghdr)(unsafe.Pointer(&msg[0]))
+	hdr.Len = uint32(msgLen)
+	hdr.Type = typ
+	hdr.Flags = unix.NLM_F_REQUEST | flags
+	copy(msg[unix.NLMSG_HDRLEN:], req)
+
+	if bytecode != nil {
+		off := unix.NLMSG_HDRLEN + len(req)
+		attr := (*unix.RtAttr)(unsafe.Pointer(&msg[off]))
+		attr.Len = uint16(unix.SizeofRtAttr + len(bytecode))
+		attr.Type = inetDiagReqBytecode
+		copy(msg[off+unix.SizeofRtAttr:], bytecode)
+	}
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("unable to send sock_diag request: %w", err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("unable to receive sock_diag response: %w", err)
+		}
+
+		for b := buf[:n]; len(b) >= unix.NLMSG_HDRLEN; {
+			h := (*unix.NlMsghdr)(unsafe.Pointer(&b[0]))
+			if int(h.Len) < unix.NLMSG_HDRLEN || int(h.Len) > len(b) {
+				return errors.New("malformed sock_diag response")
+			}
+			payload := b[unix.NLMSG_HDRLEN:h.Len]
+
+			switch h.Type {
+			case unix.NLMSG_DONE, unix.NLMSG_ERROR:
+				// Both carry a negative errno when the request failed,
+				// e.g. ENOENT if the kernel lacks the diag module, and
+				// NLMSG_ERROR with 0 acknowledges a request.
+				if len(payload) >= 4 {
+					if errno := -int32(binary.NativeEndian.Uint32(payload)); errno > 0 {
+						return fmt.Errorf("sock_diag request failed: %w", unix.Errno(errno))
+					}
+				}
+				return nil
+			case unix.SOCK_DIAG_BY_FAMILY:
+				fn(payload)
+			}
+
+			next := nlmAlign(int(h.Len))
+			if next > len(b) {
+				break
+			}
+			b = b[next:]
+		}
+	}
+}
+
+// parseDiagMsg converts an inet_diag_msg with its attributes into SocketInfo.
+func parseDiagMsg(protocol string, b []byte) (SocketInfo, bool) {
+	if len(b) < sizeofInetDiagMsg {
+		return SocketInfo{}, false
+	}
+	m := *(*inetDiagMsg)(unsafe.Pointer(&b[0]))
+
+	s := SocketInfo{
+		Protocol:   protocol,
+		Type:       inetSocketType(protocol),
+		LocalAddr:  diagAddr(m.Family, m.ID.Src, m.ID.SPort, m.ID.If),
+		RemoteAddr: diagAddr(m.Family, m.ID.Dst, m.ID.DPort, m.ID.If),
+		Inode:      strconv.FormatUint(uint64(m.Inode), 10),
+	}
+	if int(m.State) < len(tcpStates) {
+		s.State = tcpStates[m.State]
+	}
+
+	for attrs := b[nlmAlign(sizeofInetDiagMsg):]; len(attrs) >= unix.SizeofRtAttr; {
+		a := (*unix.RtAttr)(unsafe.Pointer(&attrs[0]))
+		if int(a.Len) < unix.SizeofRtAttr || int(a.Len) > len(attrs) {
+			break
+		}
+		data := attrs[unix.SizeofRtAttr:a.Len]
+
+		switch a.Type {
+		case inetDiagInfo:
+			var info unix.TCPInfo
+			raw := unsafe.Slice((*byte)(unsafe.Pointer(&info)), unix.SizeofTCPInfo)
+			copy(raw, data)
+			s.TCPInfo = &info
+		case inetDiagCong:
+			s.Congestion = unix.ByteSliceToString(data)
+		}
+
+		next := nlmAlign(int(a.Len))
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+
+	return s, true
+}
+
+// diagAddr formats an address and port taken from inet_diag_sockid. Link-local
+// IPv6 addresses get the zone of the socket's bound interface.
+func diagAddr(family uint8, addr [16]byte, port [2]byte, ifindex uint32) string {
+	var ip netip.Addr
+	if family == unix.AF_INET {
+		ip = netip.AddrFrom4([4]byte(addr[:net.IPv4len]))
+	} else {
+		ip = netip.AddrFrom16(addr)
+		if ifindex != 0 && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) {
+			ip = ip.WithZone(zoneName(int(ifindex)))
+		}
+	}
+	return formatAddr(ip, binary.BigEndian.Uint16(port[:]))
+}
+
+// zoneName returns the interface name for an index, or the index itself if
+// the interface is not known.
+func zoneName(index int) string {
+	if ifi, err := net.InterfaceByIndex(index); err == nil {
+		return ifi.Name
+	}
+	return strconv.Itoa(index)
+}
+
+func nlmAlign(n int) int {
+	return (n + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+}
+
+// Constants from linux/unix_diag.h.
+const (
+	udiagShowName = 0x1
+	udiagShowPeer = 0x4
+
+	unixDiagName = 0
+	unixDiagPeer = 2
+
+	sizeofUnixDiagMsg = 16
+)
+
+// unixDiagReq mirrors struct unix_diag_req.
+type unixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie   [2]uint32
+}
+
+// unixDiagMsg mirrors struct unix_diag_msg.
+type unixDiagMsg struct {
+	Family uint8
+	Type   uint8
+	State  uint8
+	Pad    uint8
+	Ino    uint32
+	Cookie [2]uint32
+}
+
+// unixDiagDump lists UNIX domain sockets. The remote address of a connected
+// socket is the path of its peer, when the peer is bound to one.
+func unixDiagDump(fd int, states uint32) ([]SocketInfo, error) {
+	req := unixDiagReq{
+		Family: unix.AF_UNIX,
+		States: states,
+		Show:   udiagShowName | udiagShowPeer,
+	}
+	msg := make([]byte, unsafe.Sizeof(req))
+	*(*unixDiagReq)(unsafe.Pointer(&msg[0])) = req
+
+	var all []SocketInfo
+	peers := make(map[int]uint32)
+	err := diagRequest(fd, unix.SOCK_DIAG_BY_FAMILY, unix.NLM_F_DUMP, msg, nil, func(b []byte) {
+		s, peer, ok := parseUnixDiagMsg(b)
+		if !ok {
+			return
+		}
+		if peer != 0 {
+			peers[len(all)] = peer
+		}
+		all = append(all, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string, len(all))
+	for _, s := range all {
+		paths[s.Inode] = s.LocalAddr
+	}
+	for i, peer := range peers {
+		all[i].RemoteAddr = paths[strconv.FormatUint(uint64(peer), 10)]
+	}
+	return all, nil
+}
+
+// parseUnixDiagMsg converts a unix_diag_msg with its attributes into
+// SocketInfo. The inode of the peer is returned separately, 0 if there is
+// none.
+func parseUnixDiagMsg(b []byte) (SocketInfo, uint32, bool) {
+	if len(b) < sizeofUnixDiagMsg {
+		return SocketInfo{}, 0, false
+	}
+	m := *(*unixDiagMsg)(unsafe.Pointer(&b[0]))
+
+	s := SocketInfo{
+		Protocol: "unix",
+		Type:     unixSocketType(int(m.Type)),
+		Inode:    strconv.FormatUint(uint64(m.Ino), 10),
+	}
+	if int(m.State) < len(tcpStates) {
+		s.State = tcpStates[m.State]
+	}
+
+	var peer uint32
+	for attrs := b[nlmAlign(sizeofUnixDiagMsg):]; len(attrs) >= unix.SizeofRtAttr; {
+		a := (*unix.RtAttr)(unsafe.Pointer(&attrs[0]))
+		if int(a.Len) < unix.SizeofRtAttr || int(a.Len) > len(attrs) {
+			break
+		}
+		data := attrs[unix.SizeofRtAttr:a.Len]
+
+		switch a.Type {
+		case unixDiagName:
+			s.LocalAddr = unixPath(data)
+		case unixDiagPeer:
+			if len(data) >= 4 {
+				peer = binary.NativeEndian.Uint32(data)
+			}
+		}
+
+		next := nlmAlign(int(a.Len))
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	return s, peer, true
+}
+
+// unixPath formats a sun_path, showing abstract names with a leading '@' like
+// /proc/net/unix does.
+func unixPath(b []byte) string {
+	if len(b) > 0 && b[0] == 0 {
+		return "@" + string(b[1:])
+	}
+	return unix.ByteSliceToString(b)
+}
@@ -0,0 +1,102 @@
+package sockets
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Filter selects sockets by owner and endpoint. Zero values match everything.
+type Filter struct {
+	PID    int
+	State  string
+	Port   int
+	Local  netip.Prefix
+	Remote netip.Prefix
+	Comm   string
+}
+
+// Match reports whether the socket satisfies every criterion of the filter.
+// Port matches either the local or the remote port.
+func (f Filter) Match(s SocketInfo) bool {
+	if f.PID != 0 && s.PID != strconv.Itoa(f.PID) {
+		return false
+	}
+	if f.State != "" && !strings.EqualFold(s.State, f.State) {
+		return false
+	}
+	if f.Comm != "" && s.Comm != f.Comm {
+		return false
+	}
+
+	if f.Port == 0 && !f.Local.IsValid() && !f.Remote.IsValid() {
+		return true
+	}
+
+	// Endpoint criteria never match UNIX sockets, whose addresses are paths.
+	local, err := splitAddr(s.LocalAddr)
+	if err != nil {
+		return false
+	}
+	remote, err := splitAddr(s.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	if f.Port != 0 && int(local.Port()) != f.Port && int(remote.Port()) != f.Port {
+		return false
+	}
+	if f.Local.IsValid() && !prefixContains(f.Local, local.Addr()) {
+		return false
+	}
+	if f.Remote.IsValid() && !prefixContains(f.Remote, remote.Addr()) {
+		return false
+	}
+
+	return true
+}
+
+// Apply returns the sockets matching the filter.
+func (f Filter) Apply(sockets []SocketInfo) []SocketInfo {
+	var matched []SocketInfo
+	for _, s := range sockets {
+		if f.Match(s) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// ParseCIDR parses a network in CIDR notation. A bare IP address is accepted
+// and treated as a single host network.
+func ParseCIDR(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid address %q: %w", s, err)
+		}
+		return netip.PrefixFrom(ip.WithZone(""), ip.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid network %q: %w", s, err)
+	}
+	return prefix.Masked(), nil
+}
+
+// prefixContains reports whether the network contains ip. Zones are ignored
+// and IPv4-mapped IPv6 addresses match IPv4 networks.
+func prefixContains(prefix netip.Prefix, ip netip.Addr) bool {
+	ip = ip.WithZone("")
+	if prefix.Addr().Is4() {
+		ip = ip.Unmap()
+	}
+	return prefix.Contains(ip)
+}
+
+// splitAddr parses an address produced by formatAddr.
+func splitAddr(addr string) (netip.AddrPort, error) {
+	return netip.ParseAddrPort(addr)
+}
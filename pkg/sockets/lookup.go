@@ -0,0 +1,236 @@
+package sockets
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// FdInode returns the inode of the socket at descriptor fd of process pid.
+func FdInode(pid, fd int) (string, error) {
+	link, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "fd", strconv.Itoa(fd)))
+	if err != nil {
+		return "", err
+	}
+	inode, ok := strings.CutPrefix(link, "socket:[")
+	if !ok {
+		return "", fmt.Errorf("fd %d of process %d is not a socket", fd, pid)
+	}
+	return strings.TrimSuffix(inode, "]"), nil
+}
+
+// ProtocolName returns the name Discover reports for sockets with these
+// SO_DOMAIN, SO_TYPE and SO_PROTOCOL values, e.g. tcp6. It returns false for
+// sockets that Discover does not list.
+func ProtocolName(domain, sockType, protocol int) (string, bool) {
+	if domain == unix.AF_UNIX {
+		return "unix", true
+	}
+	if domain != unix.AF_INET && domain != unix.AF_INET6 {
+		return "", false
+	}
+
+	var name string
+	switch {
+	case sockType == unix.SOCK_RAW:
+		name = "raw"
+	case sockType == unix.SOCK_STREAM && protocol == unix.IPPROTO_TCP:
+		name = "tcp"
+	case sockType == unix.SOCK_DGRAM && protocol == unix.IPPROTO_UDP:
+		name = "udp"
+	case sockType == unix.SOCK_DGRAM && protocol == unix.IPPROTO_UDPLITE:
+		name = "udplite"
+	default:
+		return "", false
+	}
+	if domain == unix.AF_INET6 {
+		name += "6"
+	}
+	return name, true
+}
+
+// Lookup finds a single socket with a sock_diag request for that socket
+// instead of a dump of all of them. q.Inode must be set: inet sockets are
+// looked up by q.Protocol, q.LocalAddr and q.RemoteAddr and UNIX sockets by
+// inode, and the socket found must have q.Inode. The request is made in the
+// network namespace at netns, see Options.NetNS.
+//
+// The result keeps PID and FD of q, since the owner is not searched for. It
+// returns ErrNoSocketMatch if the socket does not exist.
+func Lookup(netns string, q SocketInfo) (SocketInfo, error) {
+	own, err := ownNetNS()
+	if err != nil {
+		return SocketInfo{}, err
+	}
+	ns := own
+	if netns != "" {
+		if ns, err = OpenNetNS(netns); err != nil {
+			return SocketInfo{}, err
+		}
+	}
+
+	var found SocketInfo
+	var ok bool
+	lookup := func() error {
+		fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+		if err != nil {
+			return fmt.Errorf("unable to open sock_diag socket: %w", err)
+		}
+		defer unix.Close(fd)
+
+		if q.Protocol == "unix" {
+			found, ok, err = unixDiagGet(fd, q.Inode)
+			return err
+		}
+		req, err := exactRequest(q)
+		if err != nil {
+			return err
+		}
+		msg := make([]byte, sizeofInetDiagReqV2)
+		*(*inetDiagReqV2)(unsafe.Pointer(&msg[0])) = getRequest(req)
+		b, err := diagGet(fd, msg)
+		if err == nil && b != nil {
+			found, ok = parseDiagMsg(q.Protocol, b)
+		}
+		return err
+	}
+	if ns.ID == own.ID {
+		err = lookup()
+	} else {
+		err = inNetNS(ns, lookup)
+	}
+	if err != nil {
+		return SocketInfo{}, err
+	}
+	if !ok || found.Inode != q.Inode {
+		return SocketInfo{}, fmt.Errorf("%w: %s inode %s", ErrNoSocketMatch, q.Protocol, q.Inode)
+	}
+
+	found.NetNS, found.PID, found.FD = ns.ID, q.PID, q.FD
+	if q.PID != "" {
+		found.Comm = readComm(q.PID)
+	}
+	return found, nil
+}
+
+// diagGet sends a request for a single socket and returns the answer, or nil
+// if there is no such socket.
+func diagGet(fd int, req []byte) ([]byte, error) {
+	var answer []byte
+	err := diagRequest(fd, unix.SOCK_DIAG_BY_FAMILY, unix.NLM_F_ACK, req, nil, func(b []byte) {
+		answer = slices.Clone(b)
+	})
+	if errors.Is(err, unix.ENOENT) {
+		return nil, nil
+	}
+	return answer, err
+}
+
+// exactRequest builds the inet_diag_req_v2 that looks up s by protocol and
+// addresses. The cookie is left as INET_DIAG_NOCOOKIE.
+func exactRequest(s SocketInfo) (inetDiagReqV2, error) {
+	name := strings.TrimSuffix(s.Protocol, "6")
+	protocol, ok := diagProtocols[name]
+	if !ok {
+		return inetDiagReqV2{}, fmt.Errorf("%s sockets cannot be looked up by address, only tcp, udp, udplite and raw sockets", s.Protocol)
+	}
+	local, err := splitAddr(s.LocalAddr)
+	if err != nil {
+		return inetDiagReqV2{}, fmt.Errorf("invalid local address %q: %w", s.LocalAddr, err)
+	}
+	remote, err := splitAddr(s.RemoteAddr)
+	if err != nil {
+		return inetDiagReqV2{}, fmt.Errorf("invalid remote address %q: %w", s.RemoteAddr, err)
+	}
+
+	req := inetDiagReqV2{
+		Family:   unix.AF_INET,
+		Protocol: protocol,
+		States:   ^uint32(0),
+		ID: inetDiagSockID{
+			If:     zoneIndex(local.Addr().Zone()),
+			Cookie: [2]uint32{^uint32(0), ^uint32(0)},
+		},
+	}
+	if s.Protocol != name {
+		req.Family = unix.AF_INET6
+		req.ID.Src, req.ID.Dst = local.Addr().As16(), remote.Addr().As16()
+	} else {
+		src, dst := local.Addr().Unmap().As4(), remote.Addr().Unmap().As4()
+		copy(req.ID.Src[:], src[:])
+		copy(req.ID.Dst[:], dst[:])
+	}
+	if name == "raw" {
+		// the local port of a raw socket is its protocol
+		req.Pad = uint8(local.Port())
+	}
+	req.ID.SPort = [2]byte{byte(local.Port() >> 8), byte(local.Port())}
+	req.ID.DPort = [2]byte{byte(remote.Port() >> 8), byte(remote.Port())}
+	return req, nil
+}
+
+// getRequest adapts a request from exactRequest for looking up the socket.
+// The UDP lookup takes the addresses as those of a received packet, so
+// source and destination are swapped, unlike for SOCK_DESTROY.
+func getRequest(req inetDiagReqV2) inetDiagReqV2 {
+	if req.Protocol == unix.IPPROTO_UDP || req.Protocol == unix.IPPROTO_UDPLITE {
+		req.ID.Src, req.ID.Dst = req.ID.Dst, req.ID.Src
+		req.ID.SPort, req.ID.DPort = req.ID.DPort, req.ID.SPort
+	}
+	return req
+}
+
+// zoneIndex converts the zone of a link-local address back into the index
+// of the interface, which the kernel matches against the bound device.
+func zoneIndex(zone string) uint32 {
+	if zone == "" {
+		return 0
+	}
+	if ifi, err := net.InterfaceByName(zone); err == nil {
+		return uint32(ifi.Index)
+	}
+	n, _ := strconv.ParseUint(zone, 10, 32)
+	return uint32(n)
+}
+
+// unixDiagGet looks up a UNIX domain socket by inode. The remote address is
+// the path of its peer, which is looked up as well.
+func unixDiagGet(fd int, inode string) (SocketInfo, bool, error) {
+	get := func(ino uint64) (SocketInfo, uint32, bool, error) {
+		req := unixDiagReq{
+			Family: unix.AF_UNIX,
+			Ino:    uint32(ino),
+			Show:   udiagShowName | udiagShowPeer,
+			Cookie: [2]uint32{^uint32(0), ^uint32(0)},
+		}
+		msg := make([]byte, unsafe.Sizeof(req))
+		*(*unixDiagReq)(unsafe.Pointer(&msg[0])) = req
+		b, err := diagGet(fd, msg)
+		if err != nil || b == nil {
+			return SocketInfo{}, 0, false, err
+		}
+		s, peer, ok := parseUnixDiagMsg(b)
+		return s, peer, ok, nil
+	}
+
+	ino, err := strconv.ParseUint(inode, 10, 32)
+	if err != nil {
+		return SocketInfo{}, false, fmt.Errorf("invalid inode %q", inode)
+	}
+	s, peer, ok, err := get(ino)
+	if err != nil || !ok || peer == 0 {
+		return s, ok, err
+	}
+	if p, _, ok, err := get(uint64(peer)); err == nil && ok {
+		s.RemoteAddr = p.LocalAddr
+	}
+	return s, true, nil
+}
@@ -0,0 +1,116 @@
+package sockets
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetNS is a network namespace. ID is its inode number as shown by
+// readlink /proc/<pid>/ns/net, and Path a file referring to it.
+type NetNS struct {
+	ID   string `json:"id" yaml:"id"`
+	Path string `json:"path" yaml:"path"`
+}
+
+// NetNSPath returns the path of the network namespace of process pid.
+func NetNSPath(pid int) string {
+	return "/proc/" + strconv.Itoa(pid) + "/ns/net"
+}
+
+// OpenNetNS identifies the network namespace at path, e.g. NetNSPath(pid) or
+// /run/netns/<name>.
+func OpenNetNS(path string) (NetNS, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return NetNS{}, fmt.Errorf("unable to open network namespace %s: %w", path, err)
+	}
+	return NetNS{ID: strconv.FormatUint(st.Ino, 10), Path: path}, nil
+}
+
+// NetNamespaces returns every network namespace on the host that is used by
+// a visible thread or bound under /run/netns, ordered by ID.
+func NetNamespaces() ([]NetNS, error) {
+	var paths []string
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		// Threads can enter a namespace on their own, so every task is
+		// checked rather than only the main thread.
+		tasks, _ := filepath.Glob(filepath.Join("/proc", proc.Name(), "task", "*", "ns", "net"))
+		paths = append(paths, tasks...)
+	}
+	if named, err := os.ReadDir("/run/netns"); err == nil {
+		for _, e := range named {
+			paths = append(paths, filepath.Join("/run/netns", e.Name()))
+		}
+	}
+
+	seen := make(map[string]bool)
+	var all []NetNS
+	for _, path := range paths {
+		ns, err := OpenNetNS(path)
+		if err != nil || seen[ns.ID] {
+			continue
+		}
+		seen[ns.ID] = true
+		all = append(all, ns)
+	}
+	slices.SortFunc(all, func(a, b NetNS) int {
+		x, _ := strconv.ParseUint(a.ID, 10, 64)
+		y, _ := strconv.ParseUint(b.ID, 10, 64)
+		return cmp.Compare(x, y)
+	})
+	return all, nil
+}
+
+// ownNetNS returns the network namespace of sox.
+func ownNetNS() (NetNS, error) {
+	return OpenNetNS("/proc/thread-self/ns/net")
+}
+
+// inNetNS runs fn on a thread that has entered namespace ns. Sockets created
+// by fn belong to ns, and /proc/thread-self/net shows the sockets of ns. If
+// the thread cannot return to the original namespace it is discarded.
+func inNetNS(ns NetNS, fn func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		orig, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer orig.Close()
+		target, err := os.Open(ns.Path)
+		if err != nil {
+			errc <- fmt.Errorf("unable to open network namespace %s: %w", ns.Path, err)
+			return
+		}
+		defer target.Close()
+
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			errc <- fmt.Errorf("unable to enter network namespace %s: %w", ns.ID, err)
+			return
+		}
+		err = fn()
+		if unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+		errc <- err
+	}()
+	return <-errc
+}
@@ -0,0 +1,272 @@
+package sockets
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoSocketMatch is returned by Resolve when no socket owned by a
+	// visible process matches the selector.
+	ErrNoSocketMatch = errors.New("no socket matches selector")
+	// ErrAmbiguousSocket is returned by Resolve when more than one socket
+	// matches the selector.
+	ErrAmbiguousSocket = errors.New("several sockets match selector")
+)
+
+// Endpoint is an address/port pair used by selectors. An invalid (zero) IP
+// matches any address and a zero Port matches any port.
+type Endpoint struct {
+	IP   netip.Addr
+	Port int
+}
+
+// Selector identifies a socket by its endpoints or by inode. Endpoints are
+// looked up in the network namespace at NetNS, see Options.NetNS. Group
+// restricts the selector to the sockets of a control group; it is resolved by
+// Select and Resolve, not by Match.
+type Selector struct {
+	Local  *Endpoint
+	Remote *Endpoint
+	Listen bool
+	Inode  string
+	NetNS  string
+	Group  Group
+}
+
+// ParseEndpoint parses "ip:port", "[ipv6%zone]:port", ":port" or "*:port".
+func ParseEndpoint(s string) (Endpoint, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("invalid endpoint %q: %w", s, err)
+	}
+
+	var ep Endpoint
+	if host != "" && host != "*" {
+		ep.IP, err = netip.ParseAddr(host)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("invalid endpoint address %q: %w", host, err)
+		}
+	}
+	if port != "" && port != "*" {
+		ep.Port, err = strconv.Atoi(port)
+		if err != nil || ep.Port < 0 || ep.Port > 65535 {
+			return Endpoint{}, fmt.Errorf("invalid endpoint port %q", port)
+		}
+	}
+	return ep, nil
+}
+
+// ParseSocketSelector parses a "local->remote" selector, for example
+// "10.0.0.5:443->10.0.0.9:51234".
+func ParseSocketSelector(s string) (Selector, error) {
+	local, remote, ok := strings.Cut(s, "->")
+	if !ok {
+		return Selector{}, fmt.Errorf("invalid socket selector %q, expected <local>-><remote>", s)
+	}
+	l, err := ParseEndpoint(local)
+	if err != nil {
+		return Selector{}, err
+	}
+	r, err := ParseEndpoint(remote)
+	if err != nil {
+		return Selector{}, err
+	}
+	return Selector{Local: &l, Remote: &r}, nil
+}
+
+// ParseListenSelector parses the local endpoint of a listening socket, for
+// example ":8080" or "127.0.0.1:8080".
+func ParseListenSelector(s string) (Selector, error) {
+	l, err := ParseEndpoint(s)
+	if err != nil {
+		return Selector{}, err
+	}
+	return Selector{Local: &l, Listen: true}, nil
+}
+
+// Match reports whether the socket is described by the selector.
+func (sel Selector) Match(s SocketInfo) bool {
+	if sel.Inode != "" && s.Inode != sel.Inode {
+		return false
+	}
+	if sel.Listen && s.State != "LISTEN" {
+		return false
+	}
+	if sel.Local != nil && !sel.Local.match(s.LocalAddr) {
+		return false
+	}
+	if sel.Remote != nil && !sel.Remote.match(s.RemoteAddr) {
+		return false
+	}
+	return true
+}
+
+func (sel Selector) String() string {
+	var parts []string
+	if sel.Inode != "" {
+		parts = append(parts, "inode "+sel.Inode)
+	}
+	if sel.Listen {
+		parts = append(parts, "listening on "+sel.Local.String())
+	} else if sel.Local != nil || sel.Remote != nil {
+		parts = append(parts, sel.Local.String()+"->"+sel.Remote.String())
+	}
+	if !sel.Group.IsZero() {
+		parts = append(parts, sel.Group.String())
+	}
+	if sel.NetNS != "" {
+		parts = append(parts, "in "+sel.NetNS)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// match compares the endpoint with a formatted socket address. IPv4 and
+// IPv4-mapped IPv6 addresses are equal, and zones are only compared when both
+// sides carry one.
+func (ep *Endpoint) match(addr string) bool {
+	ap, err := splitAddr(addr)
+	if err != nil {
+		return false
+	}
+	if ep.Port != 0 && ep.Port != int(ap.Port()) {
+		return false
+	}
+	if !ep.IP.IsValid() {
+		return true
+	}
+
+	want, got := ep.IP, ap.Addr()
+	if want.Zone() == "" || got.Zone() == "" {
+		want, got = want.WithZone(""), got.WithZone("")
+	}
+	return want.Unmap() == got.Unmap()
+}
+
+func (ep *Endpoint) String() string {
+	if ep == nil {
+		return "*:*"
+	}
+	host, port := "*", "*"
+	if ep.IP.IsValid() {
+		host = ep.IP.String()
+	}
+	if ep.Port != 0 {
+		port = strconv.Itoa(ep.Port)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Resolve finds the single socket described by the selector. Only sockets
+// owned by a visible process are considered, so the result always carries a
+// pid and fd.
+func Resolve(sel Selector) (SocketInfo, error) {
+	matched, err := Select(sel)
+	if err != nil {
+		return SocketInfo{}, err
+	}
+
+	switch len(matched) {
+	case 0:
+		return SocketInfo{}, fmt.Errorf("%w: %s", ErrNoSocketMatch, sel)
+	case 1:
+		return matched[0], nil
+	}
+
+	candidates := make([]string, len(matched))
+	for i, s := range matched {
+		candidates[i] = fmt.Sprintf("pid %s fd %s %s->%s %s", s.PID, s.FD, s.LocalAddr, s.RemoteAddr, s.State)
+	}
+	return SocketInfo{}, fmt.Errorf("%w: %s: %s", ErrAmbiguousSocket, sel, strings.Join(candidates, "; "))
+}
+
+// Select returns every socket described by the selector that is owned by a
+// visible process. Unless NetNS is set, the sockets of a Group are looked up
+// in the network namespaces of its processes, so that containers are found
+// from the host. The kernel filters the sockets by state and port where the
+// selector allows it.
+func Select(sel Selector) ([]SocketInfo, error) {
+	var procs []int
+	var pids map[string]bool
+	if !sel.Group.IsZero() {
+		var err error
+		if procs, err = sel.Group.Processes(); err != nil {
+			return nil, err
+		}
+		if len(procs) == 0 {
+			return nil, fmt.Errorf("%w: no process in %s", ErrNoSocketMatch, sel.Group)
+		}
+		pids = make(map[string]bool, len(procs))
+		for _, pid := range procs {
+			pids[strconv.Itoa(pid)] = true
+		}
+	}
+
+	var namespaces []NetNS
+	switch {
+	case sel.NetNS != "":
+		ns, err := OpenNetNS(sel.NetNS)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = []NetNS{ns}
+	case pids != nil:
+		namespaces = processNetNS(procs)
+	default:
+		ns, err := ownNetNS()
+		if err != nil {
+			return nil, err
+		}
+		namespaces = []NetNS{ns}
+	}
+
+	all, err := discoverNetNS(sel.options(), namespaces)
+	if err != nil {
+		return nil, err
+	}
+	setOwners(all)
+
+	var matched []SocketInfo
+	for _, s := range all {
+		if s.PID != "" && sel.Match(s) && (pids == nil || pids[s.PID]) {
+			matched = append(matched, s)
+		}
+	}
+	return matched, nil
+}
+
+// options returns the discovery options that narrow a dump down to the
+// sockets the selector can match. Match still checks every socket.
+func (sel Selector) options() Options {
+	var opts Options
+	if sel.Listen {
+		opts.States = []string{"LISTEN"}
+	}
+	switch {
+	case sel.Local != nil && sel.Local.Port != 0:
+		opts.Port = sel.Local.Port
+	case sel.Remote != nil && sel.Remote.Port != 0:
+		opts.Port = sel.Remote.Port
+	}
+	return opts
+}
+
+// processNetNS returns the distinct network namespaces of procs. Processes
+// that exited are skipped.
+func processNetNS(procs []int) []NetNS {
+	seen := make(map[string]bool)
+	var namespaces []NetNS
+	for _, pid := range procs {
+		ns, err := OpenNetNS(NetNSPath(pid))
+		if err != nil || seen[ns.ID] {
+			continue
+		}
+		seen[ns.ID] = true
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
@@ -3,33 +3,293 @@ package sockets
 
 import (
 	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+
+	"golang.org/x/sys/unix"
 )
 
-// SocketInfo holds information about a network socket discovered in /proc.
+// SocketInfo holds information about a network socket discovered via
+// sock_diag or /proc.
 type SocketInfo struct {
-	Protocol   string
-	LocalAddr  string
-	RemoteAddr string
-	State      string
-	Inode      string
-	PID        string
-	FD         string
+	Protocol   string `json:"protocol" yaml:"protocol"`
+	Type       string `json:"type" yaml:"type"`
+	LocalAddr  string `json:"local" yaml:"local"`
+	RemoteAddr string `json:"remote" yaml:"remote"`
+	State      string `json:"state" yaml:"state"`
+	Inode      string `json:"inode" yaml:"inode"`
+	PID        string `json:"pid" yaml:"pid"`
+	FD         string `json:"fd" yaml:"fd"`
+	Comm       string `json:"comm" yaml:"comm"`
+	// NetNS is the ID of the network namespace the socket belongs to.
+	NetNS string `json:"netns,omitempty" yaml:"netns,omitempty"`
+	// Congestion and TCPInfo are only filled in by the netlink backend when
+	// requested with Options.Info.
+	Congestion string        `json:"congestion,omitempty" yaml:"congestion,omitempty"`
+	TCPInfo    *unix.TCPInfo `json:"tcp_info,omitempty" yaml:"tcp_info,omitempty"`
+}
+
+// Protocols lists the protocol families sox can discover. IPv6 sockets are
+// reported with a "6" suffix, e.g. tcp6.
+var Protocols = []string{"tcp", "udp", "udplite", "raw", "unix"}
+
+// Options controls socket discovery. Zero values select everything.
+type Options struct {
+	// Protocols restricts discovery to these entries of Protocols.
+	Protocols []string
+	// States restricts the result to sockets in these states, e.g. LISTEN.
+	// UDP, raw and UNIX sockets use the same state names as TCP.
+	States []string
+	// Port restricts the result to sockets with this local or remote port.
+	// UNIX sockets have no ports and are skipped when it is set.
+	Port int
+	// Info requests tcp_info and the congestion control algorithm for every
+	// TCP socket. It is only honoured by the netlink backend.
+	Info bool
+	// Backend forces "netlink" or "proc". By default netlink is tried first and
+	// /proc is used as a fallback.
+	Backend string
+	// NetNS is the path of the network namespace to discover sockets in, see
+	// NetNSPath. By default the namespace of sox is used.
+	NetNS string
+	// AllNetNS discovers the sockets of every namespace in NetNamespaces.
+	AllNetNS bool
+}
+
+// List returns all sockets with the owning pid, fd and process name resolved
+// where possible. Sockets that are not owned by any visible process (e.g.
+// TIME_WAIT) are returned without them.
+func List() ([]SocketInfo, error) {
+	return Discover(Options{})
+}
+
+// Discover returns the sockets selected by opts. State and port filters are
+// evaluated by the kernel when the netlink backend is used. Discovery in
+// another network namespace requires CAP_SYS_ADMIN.
+func Discover(opts Options) ([]SocketInfo, error) {
+	var namespaces []NetNS
+	var err error
+	switch {
+	case opts.AllNetNS:
+		if namespaces, err = NetNamespaces(); err != nil {
+			return nil, err
+		}
+	case opts.NetNS != "":
+		ns, err := OpenNetNS(opts.NetNS)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = []NetNS{ns}
+	default:
+		ns, err := ownNetNS()
+		if err != nil {
+			return nil, err
+		}
+		namespaces = []NetNS{ns}
+	}
+
+	all, err := discoverNetNS(opts, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	setOwners(all)
+	return all, nil
+}
+
+// discoverNetNS lists the sockets selected by opts in each of namespaces,
+// without their owners. Namespaces that disappear during an AllNetNS
+// discovery are skipped.
+func discoverNetNS(opts Options, namespaces []NetNS) ([]SocketInfo, error) {
+	states, err := stateMask(opts.States)
+	if err != nil {
+		return nil, err
+	}
+	own, err := ownNetNS()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []SocketInfo
+	for _, ns := range namespaces {
+		var found []SocketInfo
+		discover := func() (err error) {
+			found, err = discover(opts, states)
+			return err
+		}
+		if ns.ID == own.ID {
+			err = discover()
+		} else {
+			err = inNetNS(ns, discover)
+		}
+		if opts.AllNetNS && errors.Is(err, os.ErrNotExist) {
+			// the only thread in the namespace exited after the scan
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			found[i].NetNS = ns.ID
+		}
+		all = append(all, found...)
+	}
+	return all, nil
+}
+
+// setOwners fills in the pid, fd and process name of the sockets that are
+// owned by a visible process. /proc is walked once for all of them.
+func setOwners(all []SocketInfo) {
+	owners := inodeOwners()
+	for i, connection := range all {
+		owner, ok := owners[connection.Inode]
+		if !ok {
+			continue
+		}
+		all[i].PID = owner.pid
+		all[i].FD = owner.fd
+		all[i].Comm = readComm(owner.pid)
+	}
+}
+
+// discover lists the sockets of the current network namespace.
+func discover(opts Options, states uint32) ([]SocketInfo, error) {
+	protocols := opts.Protocols
+	if len(protocols) == 0 {
+		protocols = Protocols
+	}
+
+	var all []SocketInfo
+	var err error
+	for _, protocol := range protocols {
+		if !slices.Contains(Protocols, protocol) {
+			return nil, fmt.Errorf("unknown protocol %q, expected one of %s", protocol, strings.Join(Protocols, ", "))
+		}
+		if protocol == "unix" && opts.Port != 0 {
+			continue
+		}
+
+		var found []SocketInfo
+		switch opts.Backend {
+		case "", "netlink":
+			found, err = diagDump(protocol, states, opts.Port, opts.Info)
+			if err != nil && opts.Backend == "" {
+				found, err = procDump(protocol, states, opts.Port)
+			}
+		case "proc":
+			found, err = procDump(protocol, states, opts.Port)
+		default:
+			err = fmt.Errorf("unknown backend %q, expected netlink or proc", opts.Backend)
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, found...)
+	}
+	return all, nil
+}
+
+// procDump reads the sockets of one protocol family from /proc/net and
+// filters them by the state mask and port in userspace.
+func procDump(protocol string, states uint32, port int) ([]SocketInfo, error) {
+	var files []string
+	if protocol == "unix" {
+		files = []string{"unix"}
+	} else {
+		files = []string{protocol, protocol + "6"}
+	}
+
+	var all []SocketInfo
+	for _, file := range files {
+		connections, err := parseProcNet(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range connections {
+			if states&(1<<stateByName[c.State]) == 0 {
+				continue
+			}
+			if port != 0 && !(Filter{Port: port}).Match(c) {
+				continue
+			}
+			all = append(all, c)
+		}
+	}
+	return all, nil
+}
+
+type owner struct {
+	pid string
+	fd  string
+}
+
+// inodeOwners maps socket inodes to the first pid/fd referring to them. It
+// walks /proc/*/fd once, so it should be built once per run.
+func inodeOwners() map[string]owner {
+	owners := make(map[string]owner)
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+	for _, proc := range procs {
+		pid := proc.Name()
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join("/proc", pid, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join("/proc", pid, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, ok := owners[inode]; !ok {
+				owners[inode] = owner{pid: pid, fd: fd.Name()}
+			}
+		}
+	}
+	return owners
+}
+
+// readComm returns the command name of the process, or an empty string if it
+// cannot be read.
+func readComm(pid string) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%s/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
 }
 
-// parseProcNet reads and parses /proc/net/tcp or /proc/net/tcp6.
+// parseProcNet reads and parses a /proc/net file such as tcp, udp6 or unix.
 func parseProcNet(protocol string) ([]SocketInfo, error) {
-	file, err := os.Open(fmt.Sprintf("/proc/net/%s", protocol))
+	file, err := os.Open(fmt.Sprintf("/proc/thread-self/net/%s", protocol))
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	if protocol == "unix" {
+		return parseProcUnixReader(file)
+	}
+	return parseProcNetReader(protocol, file)
+}
+
+// parseProcNetReader parses the contents of a /proc/net/{tcp,udp,udplite,raw}
+// file or of its IPv6 counterpart. They all share the same layout.
+func parseProcNetReader(protocol string, r io.Reader) ([]SocketInfo, error) {
+	scanner := bufio.NewScanner(r)
 	// Skip the first line (header)
 	scanner.Scan()
 
@@ -48,6 +308,7 @@ func parseProcNet(protocol string) ([]SocketInfo, error) {
 
 		connection := SocketInfo{
 			Protocol:   protocol,
+			Type:       inetSocketType(protocol),
 			LocalAddr:  localAddr,
 			RemoteAddr: remoteAddr,
 			State:      state,
@@ -59,45 +320,190 @@ func parseProcNet(protocol string) ([]SocketInfo, error) {
 	return connections, scanner.Err()
 }
 
-// parseAddress parses an address in the form IP:PORT from the proc files.
+// parseProcUnixReader parses the contents of /proc/net/unix:
+//
+//	Num       RefCount Protocol Flags    Type St Inode Path
+//	0000000000000000: 00000002 00000000 00010000 0001 01 23456 /run/app.sock
+func parseProcUnixReader(r io.Reader) ([]SocketInfo, error) {
+	scanner := bufio.NewScanner(r)
+	// Skip the first line (header)
+	scanner.Scan()
+
+	var connections []SocketInfo
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		sockType, _ := strconv.ParseUint(fields[4], 16, 16)
+		st, _ := strconv.ParseUint(fields[5], 16, 8)
+
+		// Map the socket_state to the TCP-like sk_state reported by
+		// unix_diag so that both backends agree.
+		state := "CLOSE"
+		switch {
+		case flags&unixAcceptCon != 0:
+			state = "LISTEN"
+		case st == unixSSConnected:
+			state = "ESTABLISHED"
+		case st == unixSSConnecting:
+			state = "SYN_SENT"
+		}
+
+		var path string
+		if len(fields) > 7 {
+			path = fields[7]
+		}
+
+		connections = append(connections, SocketInfo{
+			Protocol:  "unix",
+			Type:      unixSocketType(int(sockType)),
+			LocalAddr: path,
+			State:     state,
+			Inode:     fields[6],
+		})
+	}
+
+	return connections, scanner.Err()
+}
+
+// Values of the Flags and St columns of /proc/net/unix.
+const (
+	unixAcceptCon    = 0x10000
+	unixSSConnecting = 2
+	unixSSConnected  = 3
+)
+
+// inetSocketType returns the socket type implied by an inet protocol name.
+func inetSocketType(protocol string) string {
+	switch strings.TrimSuffix(protocol, "6") {
+	case "tcp":
+		return "stream"
+	case "raw":
+		return "raw"
+	}
+	return "dgram"
+}
+
+// unixSocketType names a SOCK_* constant.
+func unixSocketType(t int) string {
+	switch t {
+	case unix.SOCK_STREAM:
+		return "stream"
+	case unix.SOCK_DGRAM:
+		return "dgram"
+	case unix.SOCK_SEQPACKET:
+		return "seqpacket"
+	}
+	return strconv.Itoa(t)
+}
+
+// parseAddress parses an address in the form IP:PORT from the proc files and
+// formats it as ip:port or [ipv6]:port.
 func parseAddress(addr string) string {
-	parts := strings.Split(addr, ":")
-	if len(parts) != 2 {
+	ip, port, ok := strings.Cut(addr, ":")
+	if !ok {
+		return ""
+	}
+	parsedIP, err := decodeHexIP(ip)
+	if err != nil {
 		return ""
 	}
-	ip := parts[0]
-	port := parts[1]
-	parsedIP := parseHexIP(ip)
-	parsedPort, _ := strconv.ParseInt(port, 16, 64)
-	return fmt.Sprintf("%s:%d", parsedIP, parsedPort)
+	parsedPort, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return ""
+	}
+	return formatAddr(parsedIP, uint16(parsedPort))
 }
 
-// parseHexIP converts a hex encoded IPv4 address to the dotted form.
+// parseHexIP converts a hex encoded IPv4 or IPv6 address to its textual form.
 func parseHexIP(hexIP string) string {
-	bytes := make([]byte, len(hexIP)/2)
-	for i := 0; i < len(bytes); i++ {
-		b, _ := strconv.ParseUint(hexIP[i*2:i*2+2], 16, 8)
-		bytes[len(bytes)-1-i] = byte(b)
+	ip, err := decodeHexIP(hexIP)
+	if err != nil {
+		return ""
 	}
-	return fmt.Sprintf("%d.%d.%d.%d", bytes[0], bytes[1], bytes[2], bytes[3])
+	return ip.String()
 }
 
+// decodeHexIP decodes an address as printed by the kernel in /proc/net. The
+// address is printed as 32-bit words in host byte order, one word for IPv4
+// and four for IPv6.
+func decodeHexIP(hexIP string) (netip.Addr, error) {
+	if len(hexIP) != 8 && len(hexIP) != 32 {
+		return netip.Addr{}, fmt.Errorf("invalid hex address %q", hexIP)
+	}
+
+	b := make([]byte, 0, len(hexIP)/2)
+	for i := 0; i < len(hexIP); i += 8 {
+		word, err := strconv.ParseUint(hexIP[i:i+8], 16, 32)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid hex address %q: %w", hexIP, err)
+		}
+		b = binary.NativeEndian.AppendUint32(b, uint32(word))
+	}
+
+	ip, _ := netip.AddrFromSlice(b)
+	return ip, nil
+}
+
+// formatAddr formats an address and port as ip:port, or [ipv6%zone]:port for
+// IPv6. IPv4-mapped addresses keep their ::ffff: prefix like ss shows them.
+func formatAddr(ip netip.Addr, port uint16) string {
+	return netip.AddrPortFrom(ip, port).String()
+}
+
+// tcpStates lists the kernel TCP states indexed by their numeric value.
+var tcpStates = []string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+}
+
+// stateByName maps a TCP state name to its numeric value.
+var stateByName = func() map[string]int {
+	m := make(map[string]int, len(tcpStates))
+	for i, name := range tcpStates {
+		if name != "" {
+			m[name] = i
+		}
+	}
+	return m
+}()
+
 // parseState converts the numeric TCP state into a human readable string.
 func parseState(state string) string {
-	states := map[string]string{
-		"01": "ESTABLISHED",
-		"02": "SYN_SENT",
-		"03": "SYN_RECV",
-		"04": "FIN_WAIT1",
-		"05": "FIN_WAIT2",
-		"06": "TIME_WAIT",
-		"07": "CLOSE",
-		"08": "CLOSE_WAIT",
-		"09": "LAST_ACK",
-		"0A": "LISTEN",
-		"0B": "CLOSING",
-	}
-	return states[state]
+	n, err := strconv.ParseUint(state, 16, 8)
+	if err != nil || int(n) >= len(tcpStates) {
+		return ""
+	}
+	return tcpStates[n]
+}
+
+// stateMask converts state names into the bitmask used by inet_diag. An empty
+// list selects all states.
+func stateMask(states []string) (uint32, error) {
+	if len(states) == 0 {
+		return 0xffffffff, nil
+	}
+	var mask uint32
+	for _, name := range states {
+		n, ok := stateByName[strings.ToUpper(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown TCP state %q", name)
+		}
+		mask |= 1 << n
+	}
+	return mask, nil
 }
 
 // findPidFdFromInode attempts to resolve a socket inode to pid and fd.
@@ -129,30 +535,12 @@ func findPidFdFromInode(inode string) (string, string, error) {
 // getConnections prints all sockets with resolved pid/fd. It is primarily
 // used for debugging purposes.
 func getConnections() {
-	tcp4Connections, err := parseProcNet("tcp")
+	allConnections, err := List()
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	tcp6Connections, err := parseProcNet("tcp6")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	allConnections := append(tcp4Connections, tcp6Connections...)
-
-	for i, connection := range allConnections {
-		pid, fd, err := findPidFdFromInode(connection.Inode)
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-		allConnections[i].PID = pid
-		allConnections[i].FD = fd
-	}
-
 	for _, conn := range allConnections {
 		fmt.Printf("Protocol: %s, Local: %s, Remote: %s, State: %s, Inode: %s, PID: %s, FD: %s\n",
 			conn.Protocol, conn.LocalAddr, conn.RemoteAddr, conn.State, conn.Inode, conn.PID, conn.FD)
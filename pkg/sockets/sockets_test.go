@@ -1,12 +1,17 @@
 package sockets
 
 import (
+	"errors"
 	"net"
 	"os"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 // helper similar to sockopt tests
@@ -84,3 +89,603 @@ func TestFindPidFdFromInode(t *testing.T) {
 func TestGetConnections(t *testing.T) {
 	getConnections()
 }
+
+func TestListFindsOwnSocket(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	all, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched := Filter{PID: os.Getpid(), State: "listen", Port: port}.Apply(all)
+	if len(matched) != 1 {
+		t.Fatalf("expected one listener, got %v", matched)
+	}
+	if matched[0].FD == "" || matched[0].Comm == "" {
+		t.Fatalf("fd or comm not resolved: %+v", matched[0])
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	s := SocketInfo{
+		Protocol:   "tcp",
+		LocalAddr:  "10.0.0.5:443",
+		RemoteAddr: "10.0.1.9:51234",
+		State:      "ESTABLISHED",
+		PID:        "42",
+		FD:         "7",
+		Comm:       "nginx",
+	}
+	local, _ := ParseCIDR("10.0.0.0/24")
+	remote, _ := ParseCIDR("10.0.1.9")
+	other, _ := ParseCIDR("192.168.0.0/16")
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"pid", Filter{PID: 42}, true},
+		{"wrong pid", Filter{PID: 43}, false},
+		{"state", Filter{State: "established"}, true},
+		{"wrong state", Filter{State: "LISTEN"}, false},
+		{"local port", Filter{Port: 443}, true},
+		{"remote port", Filter{Port: 51234}, true},
+		{"wrong port", Filter{Port: 80}, false},
+		{"local cidr", Filter{Local: local}, true},
+		{"remote host", Filter{Remote: remote}, true},
+		{"wrong remote", Filter{Remote: other}, false},
+		{"comm", Filter{Comm: "nginx"}, true},
+		{"wrong comm", Filter{Comm: "sshd"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(s); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ParseCIDR("not-an-ip"); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	s := SocketInfo{
+		LocalAddr:  "10.0.0.5:443",
+		RemoteAddr: "10.0.0.9:51234",
+		State:      "ESTABLISHED",
+		Inode:      "123456",
+	}
+
+	tests := []struct {
+		spec   string
+		listen bool
+		want   bool
+	}{
+		{"10.0.0.5:443->10.0.0.9:51234", false, true},
+		{":443->10.0.0.9:*", false, true},
+		{"*:443->*:*", false, true},
+		{"10.0.0.5:443->10.0.0.9:1", false, false},
+		{":443", true, false},
+	}
+	for _, tt := range tests {
+		var sel Selector
+		var err error
+		if tt.listen {
+			sel, err = ParseListenSelector(tt.spec)
+		} else {
+			sel, err = ParseSocketSelector(tt.spec)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := sel.Match(s); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	if !(Selector{Inode: "123456"}).Match(s) {
+		t.Error("inode selector did not match")
+	}
+	for _, bad := range []string{"10.0.0.5:443", "nope->10.0.0.9:1", "10.0.0.5:99999->:1"} {
+		if _, err := ParseSocketSelector(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestSelectorOptions(t *testing.T) {
+	tests := []struct {
+		spec   string
+		listen bool
+		port   int
+		states []string
+	}{
+		{":8080", true, 8080, []string{"LISTEN"}},
+		{"10.0.0.5:443->10.0.0.9:51234", false, 443, nil},
+		{"10.0.0.5:*->10.0.0.9:51234", false, 51234, nil},
+		{"10.0.0.5:*->*:*", false, 0, nil},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSocketSelector(tt.spec)
+		if tt.listen {
+			sel, err = ParseListenSelector(tt.spec)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		opts := sel.options()
+		if opts.Port != tt.port || !slices.Equal(opts.States, tt.states) {
+			t.Errorf("%s: got port %d states %v", tt.spec, opts.Port, opts.States)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	sel, err := ParseListenSelector(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Resolve(sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PID != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("unexpected pid %s", s.PID)
+	}
+
+	if _, err := Resolve(Selector{Inode: "0"}); !errors.Is(err, ErrNoSocketMatch) {
+		t.Fatalf("expected ErrNoSocketMatch, got %v", err)
+	}
+}
+
+func TestGroupMatch(t *testing.T) {
+	id := strings.Repeat("ab12", 16)
+	other := strings.Repeat("cd34", 16)
+	tests := []struct {
+		group Group
+		cg    string
+		match bool
+	}{
+		{Group{Cgroup: "/system.slice/nginx.service"}, "0::/system.slice/nginx.service", true},
+		{Group{Cgroup: "/sys/fs/cgroup/system.slice/"}, "0::/system.slice/nginx.service/worker", true},
+		{Group{Cgroup: "/system.slice/nginx"}, "0::/system.slice/nginx.service", false},
+		{Group{Unit: "nginx"}, "0::/system.slice/nginx.service", true},
+		{Group{Unit: "nginx.service"}, "1:name=systemd:/system.slice/nginx.service\n0::/", true},
+		{Group{Unit: "app.scope"}, "0::/user.slice/user-1000.slice/app.scope", true},
+		{Group{Unit: "nginx"}, "0::/system.slice/nginx-exporter.service", false},
+		{Group{Container: "ab12"}, "0::/system.slice/docker-" + id + ".scope", true},
+		{Group{Container: "ab12"}, "12:pids:/docker/" + id, true},
+		{Group{Container: "ab12"}, "0::/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + id + ".scope", true},
+		{Group{Container: "ab12"}, "0::/machine.slice/libpod-conmon-" + id + ".scope", false},
+		{Group{Container: "ab12"}, "0::/system.slice/docker-" + other + ".scope", false},
+		{Group{Container: "ab12", Unit: "docker"}, "0::/system.slice/docker-" + id + ".scope", false},
+	}
+	for _, tt := range tests {
+		if _, ok := tt.group.match(parseCgroup([]byte(tt.cg))); ok != tt.match {
+			t.Errorf("%s matching %q: got %v", tt.group, tt.cg, ok)
+		}
+	}
+
+	if _, err := (Group{Container: "xyz"}).Processes(); err == nil {
+		t.Error("expected error for invalid container ID")
+	}
+}
+
+func TestSelectGroup(t *testing.T) {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		t.Skip(err)
+	}
+	own := parseCgroup(b)[0]
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	procs, err := Group{Cgroup: own}.Processes()
+	if err != nil || !slices.Contains(procs, os.Getpid()) {
+		t.Fatalf("own process not in cgroup %s: %v %v", own, procs, err)
+	}
+
+	sel, err := ParseListenSelector(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel.Group = Group{Cgroup: own}
+	matched, err := Select(sel)
+	if err != nil || len(matched) != 1 || matched[0].PID != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("unexpected sockets %+v: %v", matched, err)
+	}
+
+	sel.Group = Group{Unit: "sox-test-missing"}
+	if _, err := Select(sel); !errors.Is(err, ErrNoSocketMatch) {
+		t.Fatalf("expected ErrNoSocketMatch, got %v", err)
+	}
+}
+
+func TestBackendsAgree(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	for _, backend := range []string{"netlink", "proc"} {
+		found, err := Discover(Options{Protocols: []string{"tcp"}, States: []string{"LISTEN"}, Port: port, Info: true, Backend: backend})
+		if err != nil {
+			if backend == "netlink" {
+				t.Skipf("sock_diag unavailable: %v", err)
+			}
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].LocalAddr != l.Addr().String() {
+			t.Fatalf("%s: unexpected sockets %+v", backend, found)
+		}
+		if found[0].PID != strconv.Itoa(os.Getpid()) {
+			t.Fatalf("%s: pid not resolved: %+v", backend, found[0])
+		}
+		if backend == "netlink" && (found[0].TCPInfo == nil || found[0].Congestion == "") {
+			t.Fatalf("netlink: extensions missing: %+v", found[0])
+		}
+	}
+
+	if _, err := Discover(Options{States: []string{"BOGUS"}}); err == nil {
+		t.Fatal("expected error for unknown state")
+	}
+}
+
+func TestParseProcNetTCP6(t *testing.T) {
+	header := "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	tests := []struct {
+		name   string
+		line   string
+		local  string
+		remote string
+		state  string
+		inode  string
+	}{
+		{
+			name:   "wildcard listener",
+			line:   "   0: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 31337 1 0000000000000000 100 0 0 10 0",
+			local:  "[::]:8080",
+			remote: "[::]:0",
+			state:  "LISTEN",
+			inode:  "31337",
+		},
+		{
+			name:   "loopback",
+			line:   "   1: 00000000000000000000000001000000:0016 00000000000000000000000001000000:C350 01 00000000:00000000 02:00098E3C 00000000     0        0 40001 1 0000000000000000 20 4 30 10 -1",
+			local:  "[::1]:22",
+			remote: "[::1]:50000",
+			state:  "ESTABLISHED",
+			inode:  "40001",
+		},
+		{
+			name:   "ipv4-mapped",
+			line:   "   2: 0000000000000000FFFF00000100007F:01BB 0000000000000000FFFF00000501000A:D431 01 00000000:00000000 00:00000000 00000000    33        0 40002 1 0000000000000000 20 4 30 10 -1",
+			local:  "[::ffff:127.0.0.1]:443",
+			remote: "[::ffff:10.0.1.5]:54321",
+			state:  "ESTABLISHED",
+			inode:  "40002",
+		},
+		{
+			name:   "global and link-local",
+			line:   "   3: B80D0120000000000000000005000000:0050 000080FE000000000000000001000000:9C40 06 00000000:00000000 03:00001770 00000000     0        0 0 3 0000000000000000",
+			local:  "[2001:db8::5]:80",
+			remote: "[fe80::1]:40000",
+			state:  "TIME_WAIT",
+			inode:  "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcNetReader("tcp6", strings.NewReader(header+tt.line+"\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected one socket, got %d", len(got))
+			}
+			s := got[0]
+			if s.LocalAddr != tt.local || s.RemoteAddr != tt.remote || s.State != tt.state || s.Inode != tt.inode {
+				t.Fatalf("got %+v", s)
+			}
+		})
+	}
+}
+
+func TestIPv6FilterAndSelector(t *testing.T) {
+	mapped := SocketInfo{LocalAddr: "[::ffff:127.0.0.1]:443", RemoteAddr: "[::ffff:10.0.1.5]:54321", State: "ESTABLISHED"}
+	linkLocal := SocketInfo{LocalAddr: "[fe80::2%eth0]:22", RemoteAddr: "[fe80::1%eth0]:40000", State: "ESTABLISHED"}
+
+	v4net, _ := ParseCIDR("10.0.0.0/8")
+	if !(Filter{Remote: v4net}).Match(mapped) {
+		t.Error("IPv4 network should match IPv4-mapped address")
+	}
+	llnet, _ := ParseCIDR("fe80::/10")
+	if !(Filter{Local: llnet}).Match(linkLocal) {
+		t.Error("link-local network should match zoned address")
+	}
+
+	tests := []struct {
+		spec string
+		s    SocketInfo
+		want bool
+	}{
+		{"127.0.0.1:443->10.0.1.5:54321", mapped, true},
+		{"[::ffff:127.0.0.1]:443->*:*", mapped, true},
+		{"[fe80::2]:22->[fe80::1]:40000", linkLocal, true},
+		{"[fe80::2%eth0]:22->*:*", linkLocal, true},
+		{"[fe80::2%eth1]:22->*:*", linkLocal, false},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSocketSelector(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := sel.Match(tt.s); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseProcUnix(t *testing.T) {
+	data := `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 23456 /run/app.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 23457 /run/app.sock
+0000000000000000: 00000002 00000000 00000000 0002 01 23458 @abstract
+0000000000000000: 00000003 00000000 00000000 0005 03 23459
+`
+	got, err := parseProcUnixReader(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SocketInfo{
+		{Protocol: "unix", Type: "stream", LocalAddr: "/run/app.sock", State: "LISTEN", Inode: "23456"},
+		{Protocol: "unix", Type: "stream", LocalAddr: "/run/app.sock", State: "ESTABLISHED", Inode: "23457"},
+		{Protocol: "unix", Type: "dgram", LocalAddr: "@abstract", State: "CLOSE", Inode: "23458"},
+		{Protocol: "unix", Type: "seqpacket", State: "ESTABLISHED", Inode: "23459"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sockets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got %+v want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiscoverUDPAndUnix(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	path := t.TempDir() + "/sox.sock"
+	ul, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ul.Close()
+
+	for _, backend := range []string{"", "proc"} {
+		found, err := Discover(Options{Protocols: []string{"udp", "unix"}, Backend: backend})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mine := Filter{PID: os.Getpid()}.Apply(found)
+
+		var sawUDP, sawUnix bool
+		for _, s := range mine {
+			if s.Protocol == "udp" && s.LocalAddr == udp.LocalAddr().String() && s.Type == "dgram" {
+				sawUDP = true
+			}
+			if s.Protocol == "unix" && s.LocalAddr == path && s.State == "LISTEN" {
+				sawUnix = true
+			}
+		}
+		if !sawUDP || !sawUnix {
+			t.Fatalf("backend %q: udp %v unix %v in %+v", backend, sawUDP, sawUnix, mine)
+		}
+	}
+}
+
+func TestDiscoverInNetNS(t *testing.T) {
+	// Create a listener in a new network namespace from a locked thread.
+	type result struct {
+		path string
+		fd   int
+		err  error
+	}
+	done := make(chan result)
+	release := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			done <- result{err: err}
+			return
+		}
+		fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+		if err == nil {
+			if err = unix.Bind(fd, &unix.SockaddrInet4{}); err == nil {
+				err = unix.Listen(fd, 1)
+			}
+		}
+		done <- result{"/proc/" + strconv.Itoa(os.Getpid()) + "/task/" + strconv.Itoa(unix.Gettid()) + "/ns/net", fd, err}
+		// The thread stays in the namespace and is discarded on return.
+		<-release
+	}()
+	r := <-done
+	defer close(release)
+	if errors.Is(r.err, unix.EPERM) {
+		t.Skipf("unable to create network namespace: %v", r.err)
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	defer unix.Close(r.fd)
+
+	ns, err := OpenNetNS(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := ownNetNS()
+	if err != nil || own.ID == ns.ID {
+		t.Fatalf("namespace not created: %v", err)
+	}
+
+	for _, backend := range []string{"netlink", "proc"} {
+		all, err := Discover(Options{Protocols: []string{"tcp"}, States: []string{"LISTEN"}, Backend: backend, NetNS: r.path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 1 || all[0].NetNS != ns.ID || all[0].FD != strconv.Itoa(r.fd) {
+			t.Fatalf("%s: unexpected sockets %+v", backend, all)
+		}
+	}
+
+	all, err := Discover(Options{Protocols: []string{"tcp"}, AllNetNS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, s := range all {
+		found[s.NetNS] = true
+	}
+	if !found[ns.ID] || !found[own.ID] {
+		t.Fatalf("sockets of both namespaces expected, got %v", found)
+	}
+
+	// the namespace of the test process is unchanged
+	if after, _ := ownNetNS(); after.ID != own.ID {
+		t.Fatalf("left namespace %s", own.ID)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		addr := "127.0.0.1:0"
+		if network == "tcp6" {
+			addr = "[::1]:0"
+		}
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			t.Skip(err)
+		}
+		defer l.Close()
+		c, err := net.Dial(network, l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		port := c.LocalAddr().(*net.TCPAddr).Port
+
+		found, err := Discover(Options{Protocols: []string{"tcp"}, Port: port, Backend: "netlink"})
+		if err != nil {
+			t.Skipf("sock_diag unavailable: %v", err)
+		}
+		i := slices.IndexFunc(found, func(s SocketInfo) bool { return s.LocalAddr == c.LocalAddr().String() })
+		if i < 0 {
+			t.Fatalf("%s: socket not found in %+v", network, found)
+		}
+
+		stale := found[i]
+		stale.Inode = "1"
+		if err := Destroy(stale); !errors.Is(err, ErrNoSocketMatch) {
+			t.Fatalf("%s: destroy with stale inode: %v", network, err)
+		}
+
+		if err := Destroy(found[i]); errors.Is(err, unix.EPERM) || errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skip(err)
+		} else if err != nil {
+			t.Fatalf("%s: %v", network, err)
+		}
+		if _, err := c.Read(make([]byte, 1)); !errors.Is(err, unix.ECONNABORTED) {
+			t.Fatalf("%s: read after destroy: %v", network, err)
+		}
+		if err := Destroy(found[i]); !errors.Is(err, ErrNoSocketMatch) {
+			t.Fatalf("%s: destroy of a destroyed socket: %v", network, err)
+		}
+	}
+
+	if err := Destroy(SocketInfo{Protocol: "unix"}); err == nil {
+		t.Fatal("expected error for a unix socket")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	u, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(pair[0])
+	defer unix.Close(pair[1])
+
+	found, err := Discover(Options{Protocols: []string{"tcp", "udp"}, Backend: "netlink"})
+	if err != nil {
+		t.Skipf("sock_diag unavailable: %v", err)
+	}
+	for _, addr := range []string{c.LocalAddr().String(), u.LocalAddr().String()} {
+		i := slices.IndexFunc(found, func(s SocketInfo) bool { return s.LocalAddr == addr })
+		if i < 0 {
+			t.Fatalf("%s not discovered", addr)
+		}
+		want := found[i]
+		q := SocketInfo{Protocol: want.Protocol, LocalAddr: want.LocalAddr, RemoteAddr: want.RemoteAddr, Inode: want.Inode, PID: "1", FD: "3"}
+		got, err := Lookup("", q)
+		if err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+		if got.Inode != want.Inode || got.State != want.State || got.NetNS != want.NetNS || got.PID != "1" || got.FD != "3" {
+			t.Fatalf("%s: got %+v, want %+v", addr, got, want)
+		}
+
+		q.Inode = "1"
+		if _, err := Lookup("", q); !errors.Is(err, ErrNoSocketMatch) {
+			t.Fatalf("%s: lookup with stale inode: %v", addr, err)
+		}
+	}
+
+	inode, err := FdInode(os.Getpid(), pair[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Lookup("", SocketInfo{Protocol: "unix", Inode: inode})
+	if err != nil || got.Inode != inode || got.State != "ESTABLISHED" {
+		t.Fatalf("unix socket: %+v %v", got, err)
+	}
+}
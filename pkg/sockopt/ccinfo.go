@@ -0,0 +1,156 @@
+package sockopt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
+)
+
+// CCInfo is the congestion control state reported by TCP_CC_INFO. The
+// kernel returns a union whose member depends on the algorithm, so it is
+// decoded according to the socket's TCP_CONGESTION: tcp_bbr_info for BBR,
+// tcp_dctcp_info for DCTCP and tcpvegas_info for Vegas, Westwood and
+// Illinois. Fields is empty for algorithms such as cubic that report
+// nothing; Raw holds the bytes of algorithms sox cannot decode.
+type CCInfo struct {
+	Algorithm string
+	Fields    []TCPInfoField
+	Raw       Bytes
+}
+
+// ccInfoField is a field of a union tcp_cc_info member with its unit and
+// size in bytes.
+type ccInfoField struct {
+	name, unit string
+	size       int
+}
+
+var (
+	bbrInfoFields = []ccInfoField{
+		{"bw", "rate", 8}, {"min_rtt", "us", 4}, {"pacing_gain", "gain", 4}, {"cwnd_gain", "gain", 4},
+	}
+	dctcpInfoFields = []ccInfoField{
+		{"enabled", "", 2}, {"ce_state", "", 2}, {"alpha", "alpha", 4}, {"ab_ecn", "bytes", 4}, {"ab_tot", "bytes", 4},
+	}
+	vegasInfoFields = []ccInfoField{
+		{"enabled", "", 4}, {"rttcnt", "", 4}, {"rtt", "us", 4}, {"minrtt", "us", 4},
+	}
+)
+
+// ccInfoLayouts maps algorithm names to the union member they report.
+var ccInfoLayouts = map[string][]ccInfoField{
+	"bbr":      bbrInfoFields,
+	"dctcp":    dctcpInfoFields,
+	"vegas":    vegasInfoFields,
+	"westwood": vegasInfoFields,
+	"illinois": vegasInfoFields,
+}
+
+// ccInfoType describes TCP_CC_INFO. The buffer is larger than the union so
+// that members added by newer kernels are not truncated.
+var ccInfoType = &StructType{
+	Size: 64,
+	get: func(so SocketOption, c conn) (any, error) {
+		name, err := getsockoptString(c, unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get TCP_CONGESTION: %w", err)
+		}
+		b, err := getsockoptBytes(c, so.Level, so.Option, so.Struct.Size)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeCCInfo(name, b), nil
+	},
+}
+
+// DecodeCCInfo decodes the TCP_CC_INFO bytes reported by algorithm.
+// tcp_bbr_info splits the bandwidth into bw_lo and bw_hi, which are joined
+// into the bw field.
+func DecodeCCInfo(algorithm string, b []byte) CCInfo {
+	info := CCInfo{Algorithm: algorithm}
+	layout, ok := ccInfoLayouts[algorithm]
+	if !ok {
+		if len(b) > 0 {
+			info.Raw = Bytes(b)
+		}
+		return info
+	}
+	off := 0
+	for _, f := range layout {
+		if off+f.size > len(b) {
+			break
+		}
+		var val uint64
+		switch f.size {
+		case 2:
+			val = uint64(binary.NativeEndian.Uint16(b[off:]))
+		case 4:
+			val = uint64(binary.NativeEndian.Uint32(b[off:]))
+		case 8:
+			val = uint64(binary.NativeEndian.Uint32(b[off:])) | uint64(binary.NativeEndian.Uint32(b[off+4:]))<<32
+		}
+		info.Fields = append(info.Fields, TCPInfoField{Name: f.name, Value: val, Unit: f.unit})
+		off += f.size
+	}
+	return info
+}
+
+// String summarises the state on a single line, e.g.
+// "bbr bw=94.51 Mbit/s min_rtt=1.2ms pacing_gain=2.89 cwnd_gain=2".
+func (cc CCInfo) String() string {
+	parts := []string{cc.Algorithm}
+	for _, f := range cc.Fields {
+		parts = append(parts, f.Name+"="+f.FormatValue())
+	}
+	if len(cc.Raw) > 0 {
+		parts = append(parts, "raw="+cc.Raw.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// MarshalJSON encodes the algorithm and the fields as raw numbers, like
+// TCPInfo.
+func (cc CCInfo) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	name, _ := json.Marshal(cc.Algorithm)
+	buf.WriteString(`{"algorithm":`)
+	buf.Write(name)
+	for _, f := range cc.Fields {
+		name, _ := json.Marshal(f.Name)
+		buf.WriteByte(',')
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatUint(f.Value, 10))
+	}
+	if len(cc.Raw) > 0 {
+		buf.WriteString(`,"raw":"` + cc.Raw.String() + `"`)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalYAML encodes the algorithm and the fields as raw numbers, like
+// TCPInfo.
+func (cc CCInfo) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "algorithm"},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: cc.Algorithm})
+	for _, f := range cc.Fields {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: f.Name},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatUint(f.Value, 10)})
+	}
+	if len(cc.Raw) > 0 {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "raw"},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: cc.Raw.String()})
+	}
+	return node, nil
+}
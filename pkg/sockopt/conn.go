@@ -0,0 +1,155 @@
+package sockopt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// conn performs the socket calls sox needs on one socket, either on a
+// duplicated descriptor or inside the owning process.
+type conn interface {
+	// getsockopt reads an option value into buf and returns its length.
+	// Options such as TCP_RECV_ZEROCOPY also read their request from buf.
+	getsockopt(level, opt int, buf []byte) (int, error)
+	setsockopt(level, opt int, val []byte) error
+	// name returns the local address, see GetSocketName.
+	name() string
+	// ioctl issues a socket ioctl that returns an int, such as SIOCINQ.
+	ioctl(req uint) (int, error)
+	// shutdown shuts down part of a full-duplex connection, see
+	// shutdown(2). It affects every descriptor of the socket.
+	shutdown(how int) error
+	// peek copies the start of the receive queue into buf without
+	// consuming it. In repair mode it reads the queue selected with
+	// TCP_REPAIR_QUEUE.
+	peek(buf []byte) (int, error)
+	// session runs fn with the socket prepared for several calls.
+	session(fn func() error) error
+	close() error
+}
+
+// fdConn is a socket descriptor of this process.
+type fdConn int
+
+func (c fdConn) getsockopt(level, opt int, buf []byte) (int, error) {
+	l := uint32(len(buf))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(c), uintptr(level), uintptr(opt),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&l)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(l), nil
+}
+
+func (c fdConn) setsockopt(level, opt int, val []byte) error {
+	var p unsafe.Pointer
+	if len(val) > 0 {
+		p = unsafe.Pointer(&val[0])
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(c), uintptr(level), uintptr(opt),
+		uintptr(p), uintptr(len(val)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (c fdConn) ioctl(req uint) (int, error) {
+	return unix.IoctlGetInt(int(c), req)
+}
+
+func (c fdConn) shutdown(how int) error {
+	return unix.Shutdown(int(c), how)
+}
+
+func (c fdConn) peek(buf []byte) (int, error) {
+	n, _, err := unix.Recvfrom(int(c), buf, unix.MSG_PEEK|unix.MSG_DONTWAIT)
+	return n, err
+}
+
+func (c fdConn) name() string {
+	return GetSocketName(int(c))
+}
+
+func (c fdConn) session(fn func() error) error {
+	return fn()
+}
+
+func (c fdConn) close() error {
+	return unix.Close(int(c))
+}
+
+// getsockoptBytes reads up to size bytes of an option value and returns the
+// part filled in by the kernel.
+func getsockoptBytes(c conn, level, opt, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := c.getsockopt(level, opt, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// getsockoptInt reads an int option. Some options are reported in a single
+// byte.
+func getsockoptInt(c conn, level, opt int) (int, error) {
+	b, err := getsockoptBytes(c, level, opt, 4)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < 4 {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return int(b[0]), nil
+	}
+	return int(int32(binary.NativeEndian.Uint32(b))), nil
+}
+
+func setsockoptInt(c conn, level, opt, v int) error {
+	return c.setsockopt(level, opt, binary.NativeEndian.AppendUint32(nil, uint32(int32(v))))
+}
+
+func getsockoptTimeval(c conn, level, opt int) (unix.Timeval, error) {
+	var tv unix.Timeval
+	b, err := getsockoptBytes(c, level, opt, int(unsafe.Sizeof(tv)))
+	if err != nil {
+		return tv, err
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&tv)), unsafe.Sizeof(tv)), b)
+	return tv, nil
+}
+
+func setsockoptTimeval(c conn, level, opt int, tv unix.Timeval) error {
+	return c.setsockopt(level, opt, unsafe.Slice((*byte)(unsafe.Pointer(&tv)), unsafe.Sizeof(tv)))
+}
+
+// getsockoptString reads a NUL terminated string option.
+func getsockoptString(c conn, level, opt int) (string, error) {
+	b, err := getsockoptBytes(c, level, opt, 256)
+	if err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(b), nil
+}
+
+// socketKind returns the SO_TYPE, SO_PROTOCOL and SO_DOMAIN of a socket.
+func socketKind(c conn) (sockType, protocol, domain int, err error) {
+	err = c.session(func() error {
+		var err error
+		if sockType, err = getsockoptInt(c, unix.SOL_SOCKET, unix.SO_TYPE); err != nil {
+			return fmt.Errorf("unable to get SO_TYPE: %w", err)
+		}
+		if protocol, err = getsockoptInt(c, unix.SOL_SOCKET, unix.SO_PROTOCOL); err != nil {
+			return fmt.Errorf("unable to get SO_PROTOCOL: %w", err)
+		}
+		if domain, err = getsockoptInt(c, unix.SOL_SOCKET, unix.SO_DOMAIN); err != nil {
+			return fmt.Errorf("unable to get SO_DOMAIN: %w", err)
+		}
+		return nil
+	})
+	return sockType, protocol, domain, err
+}
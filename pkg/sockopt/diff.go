@@ -0,0 +1,97 @@
+package sockopt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// OptionDiff is an option whose value differs between two sockets. A nil
+// value means that the option was not reported on that side.
+type OptionDiff struct {
+	Name string `json:"name" yaml:"name"`
+	Old  any    `json:"old" yaml:"old"`
+	New  any    `json:"new" yaml:"new"`
+}
+
+// Diff compares two option lists as returned by Socket.List and returns the
+// differing options in the order of OptionsList. Volatile options are only
+// compared if volatile is set.
+func Diff(old, new []OptionRow, volatile bool) []OptionDiff {
+	// Rows with a status have no value and count as not reported.
+	oldVals := make(map[string]any, len(old))
+	for _, r := range old {
+		if r.Status == "" {
+			oldVals[r.Name] = r.Value
+		}
+	}
+	newVals := make(map[string]any, len(new))
+	for _, r := range new {
+		if r.Status == "" {
+			newVals[r.Name] = r.Value
+		}
+	}
+
+	names := slices.Clone(OptionsList)
+	for _, rows := range [][]OptionRow{old, new} {
+		for _, r := range rows {
+			if !slices.Contains(names, r.Name) {
+				names = append(names, r.Name)
+			}
+		}
+	}
+
+	diffs := []OptionDiff{}
+	for _, name := range names {
+		if OptionsMap[name].Volatile && !volatile {
+			continue
+		}
+		o, inOld := oldVals[name]
+		n, inNew := newVals[name]
+		if !inOld && !inNew {
+			continue
+		}
+		if inOld && inNew && reflect.DeepEqual(o, n) {
+			continue
+		}
+		diffs = append(diffs, OptionDiff{Name: name, Old: o, New: n})
+	}
+	return diffs
+}
+
+// ParseRows decodes the JSON output of sox list. Values of known options are
+// decoded into the option's kind so that they compare equal to values
+// returned by Socket.List.
+func ParseRows(b []byte) ([]OptionRow, error) {
+	var raw []struct {
+		Name        string          `json:"name"`
+		Value       json.RawMessage `json:"value"`
+		Description string          `json:"description"`
+		Status      string          `json:"status"`
+		Error       string          `json:"error"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("invalid option list: %w", err)
+	}
+
+	rows := make([]OptionRow, 0, len(raw))
+	for _, r := range raw {
+		if r.Status != "" {
+			rows = append(rows, OptionRow{Name: r.Name, Description: r.Description, Status: r.Status, Error: r.Error})
+			continue
+		}
+		var val any
+		if so, ok := OptionsMap[r.Name]; ok && so.decodable() {
+			v, err := so.Unmarshal(r.Value)
+			if err != nil {
+				return nil, err
+			}
+			val = v
+		} else if err := json.Unmarshal(r.Value, &val); err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", r.Name, err)
+		}
+		rows = append(rows, OptionRow{Name: r.Name, Value: val, Description: r.Description})
+	}
+	return rows, nil
+}
@@ -3,17 +3,19 @@ package sockopt
 
 import (
 	"errors"
+	"fmt"
+
 	"github.com/oraoto/go-pidfd"
+	"golang.org/x/sys/unix"
 )
 
 var (
-	// ErrUnableToGetPidFd is returned when pidfd.Open fails.  The operation
-	// requires either root privileges or the CAP_SYS_PTRACE capability.
-	ErrUnableToGetPidFd = errors.New("unable to get pid fd; run as root or with CAP_SYS_PTRACE")
+	// ErrUnableToGetPidFd is returned when pidfd.Open fails. The error wraps
+	// the errno returned by pidfd_open.
+	ErrUnableToGetPidFd = errors.New("unable to get pid fd")
 	// ErrUnableToGetSocketFd is returned when the file descriptor cannot be
-	// duplicated.  The operation requires either root privileges or the
-	// CAP_SYS_PTRACE capability.
-	ErrUnableToGetSocketFd = errors.New("unable to get fd of pid; run as root or with CAP_SYS_PTRACE")
+	// duplicated. The error wraps the errno returned by pidfd_getfd.
+	ErrUnableToGetSocketFd = errors.New("unable to get fd of pid")
 )
 
 // GetSocketFd returns a duplicate of file descriptor fd from the given process.
@@ -21,13 +23,30 @@ var (
 func GetSocketFd(pid, fd int) (int, error) {
 	pidFD, err := pidfd.Open(pid, 0)
 	if err != nil {
-		return 0, ErrUnableToGetPidFd
+		return 0, fmt.Errorf("%w %d: %w%s", ErrUnableToGetPidFd, pid, err, pidFdHint(err, fd))
 	}
 
+	defer unix.Close(int(pidFD))
+
 	socketFD, err := pidFD.GetFd(fd, 0)
 	if err != nil {
-		return 0, ErrUnableToGetSocketFd
+		return 0, fmt.Errorf("%w %d: %w%s", ErrUnableToGetSocketFd, pid, err, pidFdHint(err, fd))
 	}
 
 	return socketFD, nil
 }
+
+// pidFdHint suggests a remedy for a pidfd_open or pidfd_getfd errno.
+func pidFdHint(err error, fd int) string {
+	switch {
+	case errors.Is(err, unix.ESRCH):
+		return "; no such process in sox's PID namespace"
+	case errors.Is(err, unix.EBADF):
+		return fmt.Sprintf("; the process has no descriptor %d", fd)
+	case errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		return "; run as root or with CAP_SYS_PTRACE, see sox doctor"
+	case errors.Is(err, unix.ENOSYS):
+		return "; pidfd requires Linux 5.6 or is blocked by a seccomp filter, see sox doctor"
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Statuses of options in Socket.List that could not be read.
+const (
+	// StatusUnsupported marks options the running kernel does not know.
+	StatusUnsupported = "unsupported"
+	// StatusForbidden marks options sox lacks the privileges for.
+	StatusForbidden = "forbidden"
+	// StatusWriteOnly marks options that cannot be read back.
+	StatusWriteOnly = "write-only"
+	// StatusUnavailable marks options that cannot be read in the socket's
+	// current state, e.g. TCP_REPAIR_QUEUE outside repair mode.
+	StatusUnavailable = "unavailable"
+	// StatusNotRead marks options whose value is lost when read, such as
+	// SO_ERROR. They are only read by Get.
+	StatusNotRead = "not read"
+)
+
+// KernelVersion is a Linux release such as 5.10.0.
+type KernelVersion [3]int
+
+// ParseKernelVersion parses the leading numbers of a release string such as
+// "6.1.0-18-amd64" or "3.5".
+func ParseKernelVersion(s string) (KernelVersion, error) {
+	var v KernelVersion
+	parts := strings.SplitN(s, ".", 3)
+	for i, p := range parts {
+		end := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' })
+		if end == 0 {
+			break
+		}
+		if end > 0 {
+			p = p[:end]
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return KernelVersion{}, fmt.Errorf("invalid kernel version %q", s)
+		}
+		v[i] = n
+		if end > 0 {
+			break
+		}
+	}
+	if v[0] == 0 {
+		return KernelVersion{}, fmt.Errorf("invalid kernel version %q", s)
+	}
+	return v, nil
+}
+
+// Less reports whether v is an older release than w.
+func (v KernelVersion) Less(w KernelVersion) bool {
+	for i := range v {
+		if v[i] != w[i] {
+			return v[i] < w[i]
+		}
+	}
+	return false
+}
+
+func (v KernelVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// RunningKernel returns the version of the running kernel.
+var RunningKernel = sync.OnceValues(func() (KernelVersion, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return KernelVersion{}, err
+	}
+	return ParseKernelVersion(unix.ByteSliceToString(uts.Release[:]))
+})
+
+var capabilityNames = map[int]string{
+	unix.CAP_NET_ADMIN:          "CAP_NET_ADMIN",
+	unix.CAP_NET_RAW:            "CAP_NET_RAW",
+	unix.CAP_SYS_PTRACE:         "CAP_SYS_PTRACE",
+	unix.CAP_SYS_ADMIN:          "CAP_SYS_ADMIN",
+	unix.CAP_CHECKPOINT_RESTORE: "CAP_CHECKPOINT_RESTORE",
+}
+
+// CapabilityName returns the name of a capability, e.g. CAP_NET_ADMIN.
+func CapabilityName(c int) string {
+	if name, ok := capabilityNames[c]; ok {
+		return name
+	}
+	return "capability " + strconv.Itoa(c)
+}
+
+// HasCapability reports whether the calling process has capability c in its
+// effective set.
+func HasCapability(c int) bool {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return false
+	}
+	return data[c/32].Effective&(1<<(c%32)) != 0
+}
+
+// supported returns an ErrUnsupported error if the running kernel is older
+// than MinKernel.
+func (so SocketOption) supported() error {
+	if so.MinKernel == "" {
+		return nil
+	}
+	running, err := RunningKernel()
+	if err != nil {
+		return nil
+	}
+	min, err := ParseKernelVersion(so.MinKernel)
+	if err == nil && running.Less(min) {
+		return fmt.Errorf("%w: %s requires Linux %s or later, running %s", ErrUnsupported, so.Name, so.MinKernel, running)
+	}
+	return nil
+}
+
+// permitted returns an ErrForbidden error naming the first required
+// capability sox does not have.
+func (so SocketOption) permitted() error {
+	for _, c := range so.Capabilities {
+		if !HasCapability(c) {
+			return fmt.Errorf("%w: %s requires %s; run as root or grant sox %s",
+				ErrForbidden, so.Name, CapabilityName(c), CapabilityName(c))
+		}
+	}
+	return nil
+}
+
+// classify explains a getsockopt or setsockopt failure with the option's
+// metadata. Missing protocol support is wrapped in ErrUnsupported and
+// permission errors in ErrForbidden; other errors are returned unchanged.
+func (so SocketOption) classify(err error) error {
+	var errno unix.Errno
+	if !errors.As(err, &errno) {
+		return err
+	}
+	switch errno {
+	case unix.ENOPROTOOPT, unix.EOPNOTSUPP:
+		if sErr := so.supported(); sErr != nil {
+			return sErr
+		}
+		return fmt.Errorf("%w: %s is not supported by the running kernel: %w", ErrUnsupported, so.Name, err)
+	case unix.EPERM, unix.EACCES:
+		if pErr := so.permitted(); pErr != nil {
+			return pErr
+		}
+		return fmt.Errorf("%w: %s: %w; run as root", ErrForbidden, so.Name, err)
+	}
+	return err
+}
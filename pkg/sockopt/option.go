@@ -1,30 +1,181 @@
-// Package sockopt contains low level wrappers around various TCP socket options.
+// Package sockopt contains low level wrappers around various socket options.
 package sockopt
 
 import (
+	"encoding/json"
 	"fmt"
 	"golang.org/x/sys/unix"
+	"math"
+	"reflect"
+	"slices"
 )
 
 // SocketOption describes a single socket option.
-// MinVal and MaxVal are used for basic range validation when setting values.
 type SocketOption struct {
-	Name        string
-	Option      int
-	Level       int
-	MinVal      int
-	MaxVal      int
-	Unsigned    bool
+	Name   string
+	Option int
+	Level  int
+	// Kind selects how the value is read, written, formatted and parsed.
+	Kind ValueKind
+	// Struct describes the value of KindStruct options.
+	Struct *StructType
+	// Size is the buffer size of byte-blob options.
+	Size int
+	// MinVal and MaxVal are used for basic range validation when setting
+	// values.
+	MinVal int
+	MaxVal int
+	// Types, Protocols and Domains restrict the option to sockets with these
+	// SO_TYPE, SO_PROTOCOL and SO_DOMAIN values; an empty list matches any
+	// socket.
+	Types     []int
+	Protocols []int
+	Domains   []int
+	// Variant names the equivalent option of the other IP family, which
+	// Socket uses in its place on sockets of that family.
+	Variant string
+	// Volatile options report the state of a connection rather than its
+	// configuration; they are never restored and are left out of diffs by
+	// default.
+	Volatile bool
+	// MinKernel is the Linux release that introduced the option, empty for
+	// options older than any supported kernel.
+	MinKernel string
+	// Capabilities are required to set the option.
+	Capabilities []int
+	// WriteOnly options cannot be read back with getsockopt.
+	WriteOnly bool
+	// ReadAs names the option that reads back the value a WriteOnly option
+	// sets, e.g. SO_RCVBUF for SO_RCVBUFFORCE.
+	ReadAs string
+	// ReadOnly options cannot be set.
+	ReadOnly bool
+	// Doubled options are stored by the kernel as twice the value set.
+	Doubled bool
+	// ClearedOnRead options lose their value when read, so List leaves them
+	// alone.
+	ClearedOnRead bool
+	// Unit is the unit of an integer option.
+	Unit Unit
+	// Names maps special values to the names that are accepted on input and
+	// shown instead of the number.
+	Names       map[int]string
 	Description string
 }
 
-// Set changes the value of the socket option for the given socket file descriptor.
-func (so SocketOption) Set(socketFD int, value int) error {
-	if so.MaxVal != so.MinVal && (value < so.MinVal || value > so.MaxVal) {
-		return fmt.Errorf("value %d out of range [%d,%d] for %s", value, so.MinVal, so.MaxVal, so.Name)
+// tcpTypes and tcpProtocols restrict options to TCP sockets, udpTypes and
+// udpProtocols to UDP and UDP-Lite sockets.
+var (
+	tcpTypes     = []int{unix.SOCK_STREAM}
+	tcpProtocols = []int{unix.IPPROTO_TCP}
+	udpTypes     = []int{unix.SOCK_DGRAM}
+	udpProtocols = []int{unix.IPPROTO_UDP, unix.IPPROTO_UDPLITE}
+)
+
+// pmtudiscNames are the IP_PMTUDISC_* and IPV6_PMTUDISC_* modes.
+var pmtudiscNames = map[int]string{
+	unix.IP_PMTUDISC_DONT:      "dont",
+	unix.IP_PMTUDISC_WANT:      "want",
+	unix.IP_PMTUDISC_DO:        "do",
+	unix.IP_PMTUDISC_PROBE:     "probe",
+	unix.IP_PMTUDISC_INTERFACE: "interface",
+	unix.IP_PMTUDISC_OMIT:      "omit",
+}
+
+// ipDomains, ip6Domains and inetDomains restrict options to IPv4, IPv6 or
+// both kinds of sockets.
+var (
+	ipDomains   = []int{unix.AF_INET}
+	ip6Domains  = []int{unix.AF_INET6}
+	inetDomains = []int{unix.AF_INET, unix.AF_INET6}
+)
+
+// UDP-Lite checksum coverage options from linux/udp.h, not exported by
+// x/sys/unix.
+const (
+	solUDPLite       = 136
+	udpliteSendCsCov = 10
+	udpliteRecvCsCov = 11
+)
+
+// AppliesTo reports whether the option makes sense for a socket with the
+// given SO_TYPE and SO_PROTOCOL.
+func (so SocketOption) AppliesTo(sockType, protocol int) bool {
+	if len(so.Types) > 0 && !slices.Contains(so.Types, sockType) {
+		return false
+	}
+	if len(so.Protocols) > 0 && !slices.Contains(so.Protocols, protocol) {
+		return false
 	}
+	return true
+}
+
+// AppliesToDomain reports whether the option makes sense for a socket of
+// the given SO_DOMAIN.
+func (so SocketOption) AppliesToDomain(domain int) bool {
+	return len(so.Domains) == 0 || slices.Contains(so.Domains, domain)
+}
+
+// DomainName returns the name of a SO_DOMAIN address family, e.g. "inet6".
+func DomainName(domain int) string {
+	if name, ok := domainNames[domain]; ok {
+		return name
+	}
+	return fmt.Sprintf("family %d", domain)
+}
+
+// KindName formats a SO_TYPE/SO_PROTOCOL pair, e.g. "stream/tcp".
+func KindName(sockType, protocol int) string {
+	t, ok := sockTypeNames[sockType]
+	if !ok {
+		t = fmt.Sprintf("type %d", sockType)
+	}
+	p, ok := protocolNames[protocol]
+	if !ok {
+		p = fmt.Sprintf("protocol %d", protocol)
+	}
+	return t + "/" + p
+}
+
+var sockTypeNames = map[int]string{
+	unix.SOCK_STREAM:    "stream",
+	unix.SOCK_DGRAM:     "dgram",
+	unix.SOCK_RAW:       "raw",
+	unix.SOCK_SEQPACKET: "seqpacket",
+}
+
+var domainNames = map[int]string{
+	unix.AF_UNIX:    "unix",
+	unix.AF_INET:    "inet",
+	unix.AF_INET6:   "inet6",
+	unix.AF_NETLINK: "netlink",
+	unix.AF_PACKET:  "packet",
+}
+
+var protocolNames = map[int]string{
+	0:                    "default",
+	unix.IPPROTO_ICMP:    "icmp",
+	unix.IPPROTO_TCP:     "tcp",
+	unix.IPPROTO_UDP:     "udp",
+	unix.IPPROTO_ICMPV6:  "icmpv6",
+	unix.IPPROTO_UDPLITE: "udplite",
+	unix.IPPROTO_RAW:     "raw",
+}
 
-	err := unix.SetsockoptInt(socketFD, so.Level, so.Option, value)
+// SocketKind returns the SO_TYPE and SO_PROTOCOL of a socket.
+func SocketKind(socketFD int) (sockType, protocol int, err error) {
+	sockType, protocol, _, err = socketKind(fdConn(socketFD))
+	return sockType, protocol, err
+}
+
+// Set changes the value of the socket option for the given socket file descriptor.
+// The value must be of the option's kind; integer kinds also accept int.
+func (so SocketOption) Set(socketFD int, value any) error {
+	return so.set(fdConn(socketFD), value)
+}
+
+func (so SocketOption) set(c conn, value any) error {
+	err := codecs[so.Kind].set(so, c, value)
 	if err != nil {
 		err = fmt.Errorf("unable to set sockopt option %s: %w", so.Name, err)
 	}
@@ -34,8 +185,12 @@ func (so SocketOption) Set(socketFD int, value int) error {
 }
 
 // Get returns the current value of the socket option for the given socket file descriptor.
-func (so SocketOption) Get(socketFD int) (int, error) {
-	val, err := unix.GetsockoptInt(socketFD, so.Level, so.Option)
+func (so SocketOption) Get(socketFD int) (any, error) {
+	return so.get(fdConn(socketFD))
+}
+
+func (so SocketOption) get(c conn) (any, error) {
+	val, err := codecs[so.Kind].get(so, c)
 	if err != nil {
 		err = fmt.Errorf("unable to get value of sockopt option %s: %w", so.Name, err)
 	}
@@ -43,9 +198,124 @@ func (so SocketOption) Get(socketFD int) (int, error) {
 	return val, err
 }
 
+// Format renders a value of the option for table output.
+func (so SocketOption) Format(value any) string {
+	return codecs[so.Kind].format(so, value)
+}
+
+// Parse converts command line input into a value of the option's kind.
+func (so SocketOption) Parse(s string) (any, error) {
+	val, err := codecs[so.Kind].parse(so, s)
+	if err != nil {
+		err = fmt.Errorf("%w: %s value %q for %s: %w", ErrInvalidValue, so.Kind, s, so.Name, err)
+	}
+
+	return val, err
+}
+
+// Unmarshal decodes a JSON value, as produced by marshalling a value returned
+// by Get, into a value of the option's kind.
+func (so SocketOption) Unmarshal(data []byte) (any, error) {
+	ptr := codecs[so.Kind].new(so)
+	if ptr == nil {
+		return nil, fmt.Errorf("%s can only be read", so.Name)
+	}
+	if err := json.Unmarshal(data, ptr); err != nil {
+		return nil, fmt.Errorf("invalid %s value %s for %s: %w", so.Kind, data, so.Name, err)
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
+}
+
+// Writable reports whether values of the option can be decoded and set.
+func (so SocketOption) Writable() bool {
+	return !so.ReadOnly && so.decodable()
+}
+
+// decodable reports whether JSON values of the option can be decoded.
+func (so SocketOption) decodable() bool {
+	return codecs[so.Kind].new(so) != nil
+}
+
+// Requested converts a value returned by Get into the value that has to be
+// passed to Set to get it back. The kernel doubles the buffer sizes that
+// are set, so values of Doubled options are halved.
+func (so SocketOption) Requested(value any) any {
+	if n, ok := value.(int); ok && so.Doubled {
+		return n / 2
+	}
+	return value
+}
+
+// BufferNote explains the size the kernel stored for a Doubled option after
+// requested was set. It returns "" for other options and unknown sizes.
+func (so SocketOption) BufferNote(requested, stored any) string {
+	req, ok := requested.(int)
+	got, ok2 := stored.(int)
+	if !so.Doubled || !ok || !ok2 {
+		return ""
+	}
+	limit, force := "net.core.rmem_max", "SO_RCVBUFFORCE"
+	if so.Option == unix.SO_SNDBUF {
+		limit, force = "net.core.wmem_max", "SO_SNDBUFFORCE"
+	}
+	switch {
+	case got == 2*req:
+		return fmt.Sprintf("the kernel stores twice the %s set to leave room for bookkeeping overhead", so.formatInt(req))
+	case got < 2*req:
+		return fmt.Sprintf("%s is capped at twice %s; %s bypasses the limit with CAP_NET_ADMIN", so.Name, limit, force)
+	default:
+		return fmt.Sprintf("%s was raised to the kernel's minimum", so.Name)
+	}
+}
+
+// checkRange validates an integer value against MinVal and MaxVal.
+func (so SocketOption) checkRange(value int) error {
+	if so.MaxVal != so.MinVal && (value < so.MinVal || value > so.MaxVal) {
+		return fmt.Errorf("%w: %d out of range [%d,%d] for %s", ErrInvalidValue, value, so.MinVal, so.MaxVal, so.Name)
+	}
+	return nil
+}
+
 // OptionsList provides a stable order for the list command output.
 var OptionsList = []string{
 	"SO_KEEPALIVE",
+	"SO_LINGER",
+	"SO_RCVTIMEO",
+	"SO_SNDTIMEO",
+	"SO_RCVBUF",
+	"SO_SNDBUF",
+	"SO_RCVBUFFORCE",
+	"SO_SNDBUFFORCE",
+	"SO_RCVLOWAT",
+	"SO_SNDLOWAT",
+	"SO_PRIORITY",
+	"SO_MARK",
+	"SO_REUSEADDR",
+	"SO_REUSEPORT",
+	"SO_BINDTODEVICE",
+	"SO_TYPE",
+	"SO_PROTOCOL",
+	"SO_DOMAIN",
+	"SO_ERROR",
+	"SO_ACCEPTCONN",
+	"SO_INCOMING_CPU",
+	"SO_BUSY_POLL",
+	"SO_MAX_PACING_RATE",
+	"SO_MEMINFO",
+	"IP_TOS",
+	"IP_TTL",
+	"IP_MTU",
+	"IP_MTU_DISCOVER",
+	"IP_FREEBIND",
+	"IP_TRANSPARENT",
+	"IP_BIND_ADDRESS_NO_PORT",
+	"IPV6_TCLASS",
+	"IPV6_UNICAST_HOPS",
+	"IPV6_MTU",
+	"IPV6_MTU_DISCOVER",
+	"IPV6_FREEBIND",
+	"IPV6_TRANSPARENT",
+	"IPV6_V6ONLY",
 	"TCP_KEEPIDLE",
 	"TCP_KEEPINTVL",
 	"TCP_KEEPCNT",
@@ -60,30 +330,425 @@ var OptionsList = []string{
 	"TCP_INFO",
 	"TCP_QUICKACK",
 	"TCP_CONGESTION",
+	"TCP_CC_INFO",
 	"TCP_REPAIR",
 	"TCP_REPAIR_QUEUE",
 	"TCP_QUEUE_SEQ",
 	"TCP_REPAIR_OPTIONS",
+	"TCP_REPAIR_WINDOW",
 	"TCP_FASTOPEN",
 	"TCP_TIMESTAMP",
+	"TCP_NOTSENT_LOWAT",
+	"TCP_THIN_LINEAR_TIMEOUTS",
+	"TCP_THIN_DUPACK",
+	"TCP_TX_DELAY",
+	"TCP_ULP",
+	"TCP_SAVE_SYN",
+	"TCP_SAVED_SYN",
+	"TCP_FASTOPEN_CONNECT",
+	"TCP_FASTOPEN_NO_COOKIE",
+	"TCP_INQ",
+	"TCP_ZEROCOPY_RECEIVE",
+	"UDP_CORK",
+	"UDP_SEGMENT",
+	"UDP_GRO",
+	"UDPLITE_SEND_CSCOV",
+	"UDPLITE_RECV_CSCOV",
 }
 
 // OptionsMap maps the option name to its description and numeric identifiers.
 var OptionsMap = map[string]SocketOption{
 	"SO_KEEPALIVE": {
 		Level:       unix.SOL_SOCKET,
+		Kind:        KindBool,
 		Option:      unix.SO_KEEPALIVE,
 		Name:        "SO_KEEPALIVE",
 		MinVal:      0,
 		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
 		Description: "Enable or disable TCP keepalive",
 	},
+	"SO_LINGER": {
+		Name:        "SO_LINGER",
+		Option:      unix.SO_LINGER,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindStruct,
+		Struct:      lingerType,
+		Description: "Linger on close if data is present",
+	},
+	"SO_RCVTIMEO": {
+		Name:        "SO_RCVTIMEO",
+		Option:      unix.SO_RCVTIMEO,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindDuration,
+		MinKernel:   "2.3.41",
+		Description: "Receive timeout (0: none)",
+	},
+	"SO_SNDTIMEO": {
+		Name:        "SO_SNDTIMEO",
+		Option:      unix.SO_SNDTIMEO,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindDuration,
+		MinKernel:   "2.3.41",
+		Description: "Send timeout (0: none)",
+	},
+	"SO_RCVBUF": {
+		Name:        "SO_RCVBUF",
+		Option:      unix.SO_RCVBUF,
+		Level:       unix.SOL_SOCKET,
+		Unit:        UnitBytes,
+		Doubled:     true,
+		Description: "Receive buffer size (twice the value set)",
+	},
+	"SO_SNDBUF": {
+		Name:        "SO_SNDBUF",
+		Option:      unix.SO_SNDBUF,
+		Level:       unix.SOL_SOCKET,
+		Unit:        UnitBytes,
+		Doubled:     true,
+		Description: "Send buffer size (twice the value set)",
+	},
+	"SO_RCVBUFFORCE": {
+		Name:         "SO_RCVBUFFORCE",
+		Option:       unix.SO_RCVBUFFORCE,
+		Level:        unix.SOL_SOCKET,
+		Unit:         UnitBytes,
+		Doubled:      true,
+		WriteOnly:    true,
+		ReadAs:       "SO_RCVBUF",
+		MinKernel:    "2.6.14",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Set SO_RCVBUF beyond net.core.rmem_max",
+	},
+	"SO_SNDBUFFORCE": {
+		Name:         "SO_SNDBUFFORCE",
+		Option:       unix.SO_SNDBUFFORCE,
+		Level:        unix.SOL_SOCKET,
+		Unit:         UnitBytes,
+		Doubled:      true,
+		WriteOnly:    true,
+		ReadAs:       "SO_SNDBUF",
+		MinKernel:    "2.6.14",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Set SO_SNDBUF beyond net.core.wmem_max",
+	},
+	"SO_RCVLOWAT": {
+		Name:        "SO_RCVLOWAT",
+		Option:      unix.SO_RCVLOWAT,
+		Level:       unix.SOL_SOCKET,
+		MinVal:      0,
+		MaxVal:      math.MaxInt32,
+		Unit:        UnitBytes,
+		Description: "Minimum number of bytes to wake up a reader",
+	},
+	"SO_SNDLOWAT": {
+		Name:        "SO_SNDLOWAT",
+		Option:      unix.SO_SNDLOWAT,
+		Level:       unix.SOL_SOCKET,
+		Unit:        UnitBytes,
+		ReadOnly:    true,
+		Description: "Send low-water mark, fixed at 1 on Linux",
+	},
+	"SO_PRIORITY": {
+		Name:        "SO_PRIORITY",
+		Option:      unix.SO_PRIORITY,
+		Level:       unix.SOL_SOCKET,
+		MinVal:      0,
+		MaxVal:      math.MaxInt32,
+		Description: "Priority of sent packets (0-6 unprivileged)",
+	},
+	"SO_MARK": {
+		Name:         "SO_MARK",
+		Option:       unix.SO_MARK,
+		Level:        unix.SOL_SOCKET,
+		Kind:         KindUint32,
+		MinKernel:    "2.6.25",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Firewall mark of sent packets",
+	},
+	"SO_REUSEADDR": {
+		Name:        "SO_REUSEADDR",
+		Option:      unix.SO_REUSEADDR,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Description: "Allow binding to an address in TIME_WAIT",
+	},
+	"SO_REUSEPORT": {
+		Name:        "SO_REUSEPORT",
+		Option:      unix.SO_REUSEPORT,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		MinKernel:   "3.9",
+		Description: "Allow several sockets to bind the same port",
+	},
+	"SO_BINDTODEVICE": {
+		Name:        "SO_BINDTODEVICE",
+		Option:      unix.SO_BINDTODEVICE,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindString,
+		MinKernel:   "3.8",
+		Description: "Interface the socket is bound to (empty: any)",
+	},
+	"SO_TYPE": {
+		Name:        "SO_TYPE",
+		Option:      unix.SO_TYPE,
+		Level:       unix.SOL_SOCKET,
+		Names:       sockTypeNames,
+		ReadOnly:    true,
+		Description: "Socket type",
+	},
+	"SO_PROTOCOL": {
+		Name:        "SO_PROTOCOL",
+		Option:      unix.SO_PROTOCOL,
+		Level:       unix.SOL_SOCKET,
+		Names:       protocolNames,
+		ReadOnly:    true,
+		MinKernel:   "2.6.32",
+		Description: "Socket protocol",
+	},
+	"SO_DOMAIN": {
+		Name:        "SO_DOMAIN",
+		Option:      unix.SO_DOMAIN,
+		Level:       unix.SOL_SOCKET,
+		Names:       domainNames,
+		ReadOnly:    true,
+		MinKernel:   "2.6.32",
+		Description: "Socket address family",
+	},
+	"SO_ERROR": {
+		Name:          "SO_ERROR",
+		Option:        unix.SO_ERROR,
+		Level:         unix.SOL_SOCKET,
+		Unit:          UnitErrno,
+		Names:         map[int]string{0: "none"},
+		ReadOnly:      true,
+		Volatile:      true,
+		ClearedOnRead: true,
+		Description:   "Pending socket error, cleared when read",
+	},
+	"SO_ACCEPTCONN": {
+		Name:        "SO_ACCEPTCONN",
+		Option:      unix.SO_ACCEPTCONN,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindBool,
+		ReadOnly:    true,
+		Description: "Whether the socket is listening",
+	},
+	"SO_INCOMING_CPU": {
+		Name:        "SO_INCOMING_CPU",
+		Option:      unix.SO_INCOMING_CPU,
+		Level:       unix.SOL_SOCKET,
+		Names:       map[int]string{-1: "none"},
+		MinKernel:   "3.19",
+		Description: "CPU that processes received packets",
+	},
+	"SO_BUSY_POLL": {
+		Name:        "SO_BUSY_POLL",
+		Option:      unix.SO_BUSY_POLL,
+		Level:       unix.SOL_SOCKET,
+		MinVal:      0,
+		MaxVal:      math.MaxInt32,
+		Unit:        UnitMicroseconds,
+		Names:       map[int]string{0: "off"},
+		MinKernel:   "3.11",
+		Description: "Busy poll time on receive",
+	},
+	"SO_MAX_PACING_RATE": {
+		Name:        "SO_MAX_PACING_RATE",
+		Option:      unix.SO_MAX_PACING_RATE,
+		Level:       unix.SOL_SOCKET,
+		Unit:        UnitRate,
+		Names:       map[int]string{-1: "unlimited"},
+		MinKernel:   "3.13",
+		Description: "Maximum pacing rate",
+	},
+	"SO_MEMINFO": {
+		Name:        "SO_MEMINFO",
+		Option:      unix.SO_MEMINFO,
+		Level:       unix.SOL_SOCKET,
+		Kind:        KindStruct,
+		Struct:      memInfoType,
+		Volatile:    true,
+		MinKernel:   "4.12",
+		Description: "Memory used by the socket's queues",
+	},
+	"IP_TOS": {
+		Name:        "IP_TOS",
+		Option:      unix.IP_TOS,
+		Level:       unix.IPPROTO_IP,
+		MinVal:      0,
+		MaxVal:      255,
+		Domains:     ipDomains,
+		Variant:     "IPV6_TCLASS",
+		Unit:        UnitTOS,
+		Description: "Type of service byte (DSCP and ECN) of sent packets",
+	},
+	"IP_TTL": {
+		Name:        "IP_TTL",
+		Option:      unix.IP_TTL,
+		Level:       unix.IPPROTO_IP,
+		MinVal:      -1,
+		MaxVal:      255,
+		Domains:     ipDomains,
+		Variant:     "IPV6_UNICAST_HOPS",
+		Names:       map[int]string{-1: "default"},
+		Description: "Time to live of sent packets",
+	},
+	"IP_MTU": {
+		Name:        "IP_MTU",
+		Option:      unix.IP_MTU,
+		Level:       unix.IPPROTO_IP,
+		Domains:     ipDomains,
+		Variant:     "IPV6_MTU",
+		Unit:        UnitBytes,
+		ReadOnly:    true,
+		Volatile:    true,
+		Description: "Path MTU of a connected socket",
+	},
+	"IP_MTU_DISCOVER": {
+		Name:        "IP_MTU_DISCOVER",
+		Option:      unix.IP_MTU_DISCOVER,
+		Level:       unix.IPPROTO_IP,
+		MinVal:      0,
+		MaxVal:      5,
+		Domains:     ipDomains,
+		Variant:     "IPV6_MTU_DISCOVER",
+		Names:       pmtudiscNames,
+		Description: "Path MTU discovery mode",
+	},
+	"IP_FREEBIND": {
+		Name:        "IP_FREEBIND",
+		Option:      unix.IP_FREEBIND,
+		Level:       unix.IPPROTO_IP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Domains:     ipDomains,
+		Variant:     "IPV6_FREEBIND",
+		Description: "Allow binding to addresses that are not local (yet)",
+	},
+	"IP_TRANSPARENT": {
+		Name:         "IP_TRANSPARENT",
+		Option:       unix.IP_TRANSPARENT,
+		Level:        unix.IPPROTO_IP,
+		Kind:         KindBool,
+		MinVal:       0,
+		MaxVal:       1,
+		Domains:      ipDomains,
+		Variant:      "IPV6_TRANSPARENT",
+		MinKernel:    "2.6.24",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Transparent proxying (TPROXY)",
+	},
+	"IP_BIND_ADDRESS_NO_PORT": {
+		Name:        "IP_BIND_ADDRESS_NO_PORT",
+		Option:      unix.IP_BIND_ADDRESS_NO_PORT,
+		Level:       unix.IPPROTO_IP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Domains:     inetDomains,
+		MinKernel:   "4.2",
+		Description: "Defer picking the source port until connect",
+	},
+	"IPV6_TCLASS": {
+		Name:        "IPV6_TCLASS",
+		Option:      unix.IPV6_TCLASS,
+		Level:       unix.IPPROTO_IPV6,
+		MinVal:      -1,
+		MaxVal:      255,
+		Domains:     ip6Domains,
+		Variant:     "IP_TOS",
+		Unit:        UnitTOS,
+		Names:       map[int]string{-1: "default"},
+		MinKernel:   "2.6.14",
+		Description: "Traffic class (DSCP and ECN) of sent packets",
+	},
+	"IPV6_UNICAST_HOPS": {
+		Name:        "IPV6_UNICAST_HOPS",
+		Option:      unix.IPV6_UNICAST_HOPS,
+		Level:       unix.IPPROTO_IPV6,
+		MinVal:      -1,
+		MaxVal:      255,
+		Domains:     ip6Domains,
+		Variant:     "IP_TTL",
+		Names:       map[int]string{-1: "default"},
+		Description: "Hop limit of sent unicast packets",
+	},
+	"IPV6_MTU": {
+		Name:        "IPV6_MTU",
+		Option:      unix.IPV6_MTU,
+		Level:       unix.IPPROTO_IPV6,
+		MinVal:      0,
+		MaxVal:      math.MaxInt32,
+		Domains:     ip6Domains,
+		Variant:     "IP_MTU",
+		Unit:        UnitBytes,
+		Names:       map[int]string{0: "path"},
+		Volatile:    true,
+		Description: "Path MTU of a connected socket; setting caps the fragment size",
+	},
+	"IPV6_MTU_DISCOVER": {
+		Name:        "IPV6_MTU_DISCOVER",
+		Option:      unix.IPV6_MTU_DISCOVER,
+		Level:       unix.IPPROTO_IPV6,
+		MinVal:      0,
+		MaxVal:      5,
+		Domains:     ip6Domains,
+		Variant:     "IP_MTU_DISCOVER",
+		Names:       pmtudiscNames,
+		Description: "Path MTU discovery mode",
+	},
+	"IPV6_FREEBIND": {
+		Name:        "IPV6_FREEBIND",
+		Option:      unix.IPV6_FREEBIND,
+		Level:       unix.IPPROTO_IPV6,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Domains:     ip6Domains,
+		Variant:     "IP_FREEBIND",
+		MinKernel:   "4.15",
+		Description: "Allow binding to addresses that are not local (yet)",
+	},
+	"IPV6_TRANSPARENT": {
+		Name:         "IPV6_TRANSPARENT",
+		Option:       unix.IPV6_TRANSPARENT,
+		Level:        unix.IPPROTO_IPV6,
+		Kind:         KindBool,
+		MinVal:       0,
+		MaxVal:       1,
+		Domains:      ip6Domains,
+		Variant:      "IP_TRANSPARENT",
+		MinKernel:    "2.6.37",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Transparent proxying (TPROXY)",
+	},
+	"IPV6_V6ONLY": {
+		Name:        "IPV6_V6ONLY",
+		Option:      unix.IPV6_V6ONLY,
+		Level:       unix.IPPROTO_IPV6,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Domains:     ip6Domains,
+		Description: "Refuse IPv4-mapped addresses (set before bind)",
+	},
 	"TCP_KEEPIDLE": {
 		Name:        "TCP_KEEPIDLE",
 		Option:      unix.TCP_KEEPIDLE,
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      1,
 		MaxVal:      32767,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
+		Unit:        UnitSeconds,
 		Description: "Start keepalives after this period",
 	},
 	"TCP_KEEPINTVL": {
@@ -92,6 +757,10 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      1,
 		MaxVal:      32767,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
+		Unit:        UnitSeconds,
 		Description: "Interval between keepalives",
 	},
 	"TCP_KEEPCNT": {
@@ -100,22 +769,33 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      1,
 		MaxVal:      32767,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
 		Description: "Number of keepalives before death",
 	},
 	"TCP_USER_TIMEOUT": {
 		Name:        "TCP_USER_TIMEOUT",
 		Option:      unix.TCP_USER_TIMEOUT,
 		Level:       unix.IPPROTO_TCP,
-		MinVal:      1,
-		MaxVal:      0xFFFFFFFF,
+		MinVal:      0,
+		MaxVal:      math.MaxInt32,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.6.37",
+		Unit:        UnitMilliseconds,
+		Names:       map[int]string{0: "default"},
 		Description: "Time to wait for peer response",
 	},
 	"TCP_NODELAY": {
 		Name:        "TCP_NODELAY",
 		Option:      unix.TCP_NODELAY,
 		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
 		MinVal:      0,
 		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
 		Description: "Disable Nagle's algorithm",
 	},
 	"TCP_MAXSEG": {
@@ -124,14 +804,21 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      536,
 		MaxVal:      65535,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		Unit:        UnitBytes,
 		Description: "Maximum segment size",
 	},
 	"TCP_CORK": {
 		Name:        "TCP_CORK",
 		Option:      unix.TCP_CORK,
 		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
 		MinVal:      0,
 		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.2",
 		Description: "Control sending of partial frames",
 	},
 	"TCP_SYNCNT": {
@@ -140,6 +827,9 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      1,
 		MaxVal:      255,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
 		Description: "Number of SYN retransmits",
 	},
 	"TCP_LINGER2": {
@@ -148,6 +838,11 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      -1,
 		MaxVal:      32767,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
+		Unit:        UnitSeconds,
+		Names:       map[int]string{-1: "off", 0: "default"},
 		Description: "Lifetime of orphaned FIN-WAIT-2 state",
 	},
 	"TCP_DEFER_ACCEPT": {
@@ -156,6 +851,10 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      0,
 		MaxVal:      32767,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
+		Unit:        UnitSeconds,
 		Description: "Wake up listener only when data arrives",
 	},
 	"TCP_WINDOW_CLAMP": {
@@ -164,63 +863,127 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      0,
 		MaxVal:      1073725440,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4",
+		Unit:        UnitBytes,
 		Description: "Set maximum window size",
 	},
 	"TCP_INFO": {
 		Name:        "TCP_INFO",
 		Option:      unix.TCP_INFO,
 		Level:       unix.IPPROTO_TCP,
+		Kind:        KindStruct,
+		Struct:      tcpInfoType,
 		MinVal:      0,
 		MaxVal:      0,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		Volatile:    true,
+		MinKernel:   "2.4",
 		Description: "Information about this socket",
 	},
 	"TCP_QUICKACK": {
 		Name:        "TCP_QUICKACK",
 		Option:      unix.TCP_QUICKACK,
 		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
 		MinVal:      0,
 		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.4.4",
 		Description: "Enable quick ACK",
 	},
 	"TCP_CONGESTION": {
 		Name:        "TCP_CONGESTION",
 		Option:      unix.TCP_CONGESTION,
 		Level:       unix.IPPROTO_TCP,
+		Kind:        KindString,
 		MinVal:      0,
 		MaxVal:      0,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.6.13",
 		Description: "Get/Set congestion control algorithm",
 	},
-	"TCP_REPAIR": {
-		Name:        "TCP_REPAIR",
-		Option:      unix.TCP_REPAIR,
+	"TCP_CC_INFO": {
+		Name:        "TCP_CC_INFO",
+		Option:      unix.TCP_CC_INFO,
 		Level:       unix.IPPROTO_TCP,
-		MinVal:      0,
-		MaxVal:      1,
-		Description: "TCP repair mode",
+		Kind:        KindStruct,
+		Struct:      ccInfoType,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		Volatile:    true,
+		MinKernel:   "4.1",
+		Description: "State of the congestion control algorithm",
+	},
+	"TCP_REPAIR": {
+		Name:         "TCP_REPAIR",
+		Option:       unix.TCP_REPAIR,
+		Level:        unix.IPPROTO_TCP,
+		MinVal:       -1,
+		MaxVal:       1,
+		Types:        tcpTypes,
+		Protocols:    tcpProtocols,
+		MinKernel:    "3.5",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Names:        map[int]string{-1: "off-no-wp", 0: "off", 1: "on"},
+		Description:  "TCP repair mode",
 	},
 	"TCP_REPAIR_QUEUE": {
-		Name:        "TCP_REPAIR_QUEUE",
-		Option:      unix.TCP_REPAIR_QUEUE,
-		Level:       unix.IPPROTO_TCP,
-		MinVal:      0,
-		MaxVal:      3,
-		Description: "Repair queue (0: NONE, 1: RECV, 2: SEND)",
+		Name:         "TCP_REPAIR_QUEUE",
+		Option:       unix.TCP_REPAIR_QUEUE,
+		Level:        unix.IPPROTO_TCP,
+		MinVal:       0,
+		MaxVal:       2,
+		Types:        tcpTypes,
+		Protocols:    tcpProtocols,
+		MinKernel:    "3.5",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Names:        map[int]string{0: "none", 1: "recv", 2: "send"},
+		Description:  "Queue addressed in repair mode",
 	},
 	"TCP_QUEUE_SEQ": {
-		Name:        "TCP_QUEUE_SEQ",
-		Option:      unix.TCP_QUEUE_SEQ,
-		Level:       unix.IPPROTO_TCP,
-		MinVal:      0,
-		MaxVal:      0,
-		Description: "Set/get queue sequence",
+		Name:         "TCP_QUEUE_SEQ",
+		Option:       unix.TCP_QUEUE_SEQ,
+		Level:        unix.IPPROTO_TCP,
+		Kind:         KindUint32,
+		MinVal:       0,
+		MaxVal:       0,
+		Types:        tcpTypes,
+		Protocols:    tcpProtocols,
+		Volatile:     true,
+		MinKernel:    "3.5",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Set/get queue sequence",
 	},
 	"TCP_REPAIR_OPTIONS": {
-		Name:        "TCP_REPAIR_OPTIONS",
-		Option:      unix.TCP_REPAIR_OPTIONS,
-		Level:       unix.IPPROTO_TCP,
-		MinVal:      0,
-		MaxVal:      0,
-		Description: "Repair options",
+		Name:         "TCP_REPAIR_OPTIONS",
+		Option:       unix.TCP_REPAIR_OPTIONS,
+		Level:        unix.IPPROTO_TCP,
+		Kind:         KindStruct,
+		Struct:       repairOptionsType,
+		Types:        tcpTypes,
+		Protocols:    tcpProtocols,
+		MinKernel:    "3.5",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		WriteOnly:    true,
+		Description:  "Negotiated options of a connection in repair mode, e.g. mss=1460,wscale=7/7,sack,ts",
+	},
+	"TCP_REPAIR_WINDOW": {
+		Name:         "TCP_REPAIR_WINDOW",
+		Option:       unix.TCP_REPAIR_WINDOW,
+		Level:        unix.IPPROTO_TCP,
+		Kind:         KindStruct,
+		Struct:       repairWindowType,
+		Types:        tcpTypes,
+		Protocols:    tcpProtocols,
+		Volatile:     true,
+		MinKernel:    "4.8",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Description:  "Send and receive window of a connection in repair mode",
 	},
 	"TCP_FASTOPEN": {
 		Name:        "TCP_FASTOPEN",
@@ -228,15 +991,233 @@ var OptionsMap = map[string]SocketOption{
 		Level:       unix.IPPROTO_TCP,
 		MinVal:      0,
 		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "3.7",
 		Description: "Enable TCP Fast Open",
 	},
 	"TCP_TIMESTAMP": {
 		Name:        "TCP_TIMESTAMP",
 		Option:      unix.TCP_TIMESTAMP,
 		Level:       unix.IPPROTO_TCP,
+		Kind:        KindUint32,
 		MinVal:      0,
 		MaxVal:      0,
-		Unsigned:    true,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		Volatile:    true,
+		MinKernel:   "3.9",
 		Description: "Initial TCP timestamp value",
 	},
+	"TCP_NOTSENT_LOWAT": {
+		Name:        "TCP_NOTSENT_LOWAT",
+		Option:      unix.TCP_NOTSENT_LOWAT,
+		Level:       unix.IPPROTO_TCP,
+		MinVal:      0,
+		MaxVal:      math.MaxInt32,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "3.12",
+		Unit:        UnitBytes,
+		Names:       map[int]string{0: "default"},
+		Description: "Unsent bytes above which the socket is not writable",
+	},
+	"TCP_THIN_LINEAR_TIMEOUTS": {
+		Name:        "TCP_THIN_LINEAR_TIMEOUTS",
+		Option:      unix.TCP_THIN_LINEAR_TIMEOUTS,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.6.34",
+		Description: "Linear timeouts for thin streams",
+	},
+	"TCP_THIN_DUPACK": {
+		Name:        "TCP_THIN_DUPACK",
+		Option:      unix.TCP_THIN_DUPACK,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "2.6.34",
+		Description: "Fast retransmit on first dupack for thin streams (ignored since 4.18)",
+	},
+	"TCP_TX_DELAY": {
+		Name:         "TCP_TX_DELAY",
+		Option:       unix.TCP_TX_DELAY,
+		Level:        unix.IPPROTO_TCP,
+		MinVal:       0,
+		MaxVal:       math.MaxInt32,
+		Types:        tcpTypes,
+		Protocols:    tcpProtocols,
+		MinKernel:    "5.8",
+		Capabilities: []int{unix.CAP_NET_ADMIN},
+		Unit:         UnitMicroseconds,
+		Names:        map[int]string{0: "off"},
+		Description:  "Delay added to sent packets, for testing",
+	},
+	"TCP_ULP": {
+		Name:        "TCP_ULP",
+		Option:      unix.TCP_ULP,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindString,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "4.13",
+		Description: "Upper layer protocol such as tls (cannot be removed)",
+	},
+	"TCP_SAVE_SYN": {
+		Name:        "TCP_SAVE_SYN",
+		Option:      unix.TCP_SAVE_SYN,
+		Level:       unix.IPPROTO_TCP,
+		MinVal:      0,
+		MaxVal:      2,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "4.2",
+		Names:       map[int]string{0: "off", 1: "on", 2: "with-mac"},
+		Description: "Save the SYN of accepted connections for TCP_SAVED_SYN",
+	},
+	"TCP_SAVED_SYN": {
+		Name:          "TCP_SAVED_SYN",
+		Option:        unix.TCP_SAVED_SYN,
+		Level:         unix.IPPROTO_TCP,
+		Kind:          KindStruct,
+		Struct:        savedSYNType,
+		Types:         tcpTypes,
+		Protocols:     tcpProtocols,
+		ReadOnly:      true,
+		Volatile:      true,
+		ClearedOnRead: true,
+		MinKernel:     "4.2",
+		Description:   "IP and TCP headers of the SYN, discarded when read",
+	},
+	"TCP_FASTOPEN_CONNECT": {
+		Name:        "TCP_FASTOPEN_CONNECT",
+		Option:      unix.TCP_FASTOPEN_CONNECT,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "4.11",
+		Description: "Send data in the SYN on connect (set before connect)",
+	},
+	"TCP_FASTOPEN_NO_COOKIE": {
+		Name:        "TCP_FASTOPEN_NO_COOKIE",
+		Option:      unix.TCP_FASTOPEN_NO_COOKIE,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "4.19",
+		Description: "Fast Open without a cookie",
+	},
+	"TCP_INQ": {
+		Name:        "TCP_INQ",
+		Option:      unix.TCP_INQ,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "4.18",
+		Description: "Report bytes left to read in a control message",
+	},
+	"TCP_CM_INQ": {
+		Name:        "TCP_CM_INQ",
+		Option:      unix.TCP_CM_INQ,
+		Level:       unix.IPPROTO_TCP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       tcpTypes,
+		Protocols:   tcpProtocols,
+		MinKernel:   "4.18",
+		Description: "Alias of TCP_INQ, named after its control message",
+	},
+	"TCP_ZEROCOPY_RECEIVE": {
+		Name:          "TCP_ZEROCOPY_RECEIVE",
+		Option:        unix.TCP_ZEROCOPY_RECEIVE,
+		Level:         unix.IPPROTO_TCP,
+		Kind:          KindStruct,
+		Struct:        zeroCopyType,
+		Types:         tcpTypes,
+		Protocols:     tcpProtocols,
+		ReadOnly:      true,
+		Volatile:      true,
+		ClearedOnRead: true,
+		MinKernel:     "5.11",
+		Description:   "Zerocopy receive status, clears SO_ERROR when read",
+	},
+	"UDP_CORK": {
+		Name:        "UDP_CORK",
+		Option:      unix.UDP_CORK,
+		Level:       unix.IPPROTO_UDP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       udpTypes,
+		Protocols:   udpProtocols,
+		MinKernel:   "2.5.44",
+		Description: "Accumulate output into a single datagram",
+	},
+	"UDP_SEGMENT": {
+		Name:        "UDP_SEGMENT",
+		Option:      unix.UDP_SEGMENT,
+		Level:       unix.IPPROTO_UDP,
+		MinVal:      0,
+		MaxVal:      65535,
+		Types:       udpTypes,
+		Protocols:   udpProtocols,
+		MinKernel:   "4.18",
+		Unit:        UnitBytes,
+		Names:       map[int]string{0: "off"},
+		Description: "GSO segment size for sent datagrams (0: off)",
+	},
+	"UDP_GRO": {
+		Name:        "UDP_GRO",
+		Option:      unix.UDP_GRO,
+		Level:       unix.IPPROTO_UDP,
+		Kind:        KindBool,
+		MinVal:      0,
+		MaxVal:      1,
+		Types:       udpTypes,
+		Protocols:   udpProtocols,
+		MinKernel:   "5.0",
+		Description: "Receive coalesced datagrams (GRO)",
+	},
+	"UDPLITE_SEND_CSCOV": {
+		Name:        "UDPLITE_SEND_CSCOV",
+		Option:      udpliteSendCsCov,
+		Level:       solUDPLite,
+		MinVal:      0,
+		MaxVal:      65535,
+		Types:       udpTypes,
+		Protocols:   []int{unix.IPPROTO_UDPLITE},
+		MinKernel:   "2.6.20",
+		Unit:        UnitBytes,
+		Names:       map[int]string{0: "full"},
+		Description: "Checksum coverage of sent datagrams (0: full)",
+	},
+	"UDPLITE_RECV_CSCOV": {
+		Name:        "UDPLITE_RECV_CSCOV",
+		Option:      udpliteRecvCsCov,
+		Level:       solUDPLite,
+		MinVal:      0,
+		MaxVal:      65535,
+		Types:       udpTypes,
+		Protocols:   []int{unix.IPPROTO_UDPLITE},
+		MinKernel:   "2.6.20",
+		Unit:        UnitBytes,
+		Description: "Minimum checksum coverage of received datagrams",
+	},
 }
@@ -1,10 +1,14 @@
 package sockopt
 
 import (
+	"encoding/json"
+	"errors"
 	"net"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -81,8 +85,8 @@ func TestSetGetOption(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if val != 1 {
-		t.Fatalf("expected 1 got %d", val)
+	if val != true {
+		t.Fatalf("expected true got %v", val)
 	}
 }
 
@@ -126,3 +130,221 @@ func TestSetOptionOutOfRange(t *testing.T) {
 		t.Fatal("expected range validation error")
 	}
 }
+
+func TestOptionAppliesTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		sockType int
+		protocol int
+		want     bool
+	}{
+		{"TCP_NODELAY", unix.SOCK_STREAM, unix.IPPROTO_TCP, true},
+		{"TCP_NODELAY", unix.SOCK_DGRAM, unix.IPPROTO_UDP, false},
+		{"TCP_NODELAY", unix.SOCK_STREAM, 0, false},
+		{"UDP_CORK", unix.SOCK_DGRAM, unix.IPPROTO_UDP, true},
+		{"UDP_CORK", unix.SOCK_DGRAM, unix.IPPROTO_UDPLITE, true},
+		{"UDPLITE_SEND_CSCOV", unix.SOCK_DGRAM, unix.IPPROTO_UDP, false},
+	}
+	for _, tt := range tests {
+		if got := OptionsMap[tt.name].AppliesTo(tt.sockType, tt.protocol); got != tt.want {
+			t.Errorf("%s on %s: got %v want %v", tt.name, KindName(tt.sockType, tt.protocol), got, tt.want)
+		}
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	c, cleanup := makeSocket(t)
+	defer cleanup()
+
+	fd, err := fdFromConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  any
+	}{
+		{"TCP_NODELAY", "true", true},
+		{"TCP_CONGESTION", "reno", "reno"},
+		{"SO_LINGER", "1,0", Linger{OnOff: true, Linger: 0}},
+		{"SO_LINGER", "off", Linger{}},
+		{"SO_RCVTIMEO", "1.5s", Duration(1500 * time.Millisecond)},
+		{"TCP_KEEPIDLE", "60", 60},
+	}
+	for _, tt := range tests {
+		so := OptionsMap[tt.name]
+		val, err := so.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := so.Set(fd, val); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := so.Get(fd)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %#v want %#v", tt.name, got, tt.want)
+		}
+
+		// values survive a JSON round trip as used by snapshots
+		b, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := so.Unmarshal(b)
+		if err != nil || back != tt.want {
+			t.Errorf("%s: unmarshal %s: got %#v, %v", tt.name, b, back, err)
+		}
+	}
+
+	if _, err := OptionsMap["TCP_INFO"].Unmarshal([]byte("{}")); err == nil || OptionsMap["TCP_INFO"].Writable() {
+		t.Error("expected TCP_INFO to be read-only")
+	}
+
+	info, err := OptionsMap["TCP_INFO"].Get(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti, ok := info.(TCPInfo)
+	if !ok || ti.State != unix.BPF_TCP_ESTABLISHED || ti.SndMSS == 0 {
+		t.Fatalf("unexpected TCP_INFO value %#v", info)
+	}
+}
+
+func TestDecodeTCPInfoShort(t *testing.T) {
+	// A 2.6-era kernel returns tcp_info up to tcpi_total_retrans.
+	b := make([]byte, 104)
+	b[0] = 1            // state
+	b[6] = 0x7 | 0x9<<4 // snd_wscale 7, rcv_wscale 9
+	b[68] = 0xe8        // rtt 1000us
+	b[69] = 0x03
+
+	ti := DecodeTCPInfo(b)
+	fields := ti.Fields()
+	last := fields[len(fields)-1]
+	if last.Name != "total_retrans" {
+		t.Fatalf("expected fields up to total_retrans, last is %s", last.Name)
+	}
+
+	got := make(map[string]string)
+	for _, f := range fields {
+		got[f.Name] = f.FormatValue()
+	}
+	want := map[string]string{"state": "ESTABLISHED", "snd_wscale": "7", "rcv_wscale": "9", "rtt": "1ms"}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s: got %q want %q", name, got[name], v)
+		}
+	}
+
+	js, err := json.Marshal(ti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"rtt":1000`) || strings.Contains(string(js), "pacing_rate") {
+		t.Fatalf("unexpected JSON %s", js)
+	}
+}
+
+func TestParseInvalidValues(t *testing.T) {
+	for name, input := range map[string]string{
+		"TCP_NODELAY":   "maybe",
+		"TCP_KEEPIDLE":  "soon",
+		"TCP_TIMESTAMP": "-1",
+		"SO_RCVTIMEO":   "10",
+		"SO_LINGER":     "on,forever",
+	} {
+		if _, err := OptionsMap[name].Parse(input); err == nil {
+			t.Errorf("%s: expected error for %q", name, input)
+		}
+	}
+}
+
+func TestParseUnitsAndNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+	}{
+		{"TCP_NODELAY", "on", true},
+		{"TCP_NODELAY", "Off", false},
+		{"TCP_NODELAY", "yes", true},
+		{"TCP_KEEPIDLE", "2h", 7200},
+		{"TCP_KEEPIDLE", "90s", 90},
+		{"TCP_KEEPIDLE", "75", 75},
+		{"TCP_LINGER2", "1m", 60},
+		{"TCP_LINGER2", "off", -1},
+		{"TCP_USER_TIMEOUT", "30s", 30000},
+		{"TCP_USER_TIMEOUT", "default", 0},
+		{"TCP_WINDOW_CLAMP", "64KiB", 65536},
+		{"TCP_WINDOW_CLAMP", "1.5k", 1536},
+		{"TCP_WINDOW_CLAMP", "4MB", 4000000},
+		{"TCP_REPAIR_QUEUE", "RECV", 1},
+		{"SO_LINGER", "on,30s", Linger{OnOff: true, Linger: 30}},
+		{"SO_MAX_PACING_RATE", "100mbit", 12500000},
+		{"SO_MAX_PACING_RATE", "unlimited", -1},
+		{"SO_BUSY_POLL", "1ms", 1000},
+		{"SO_MARK", "0x10", uint32(16)},
+		{"IP_TOS", "ef", 0xb8},
+		{"IP_TOS", "AF41,ECT(0)", 0x8a},
+		{"IP_TOS", "cs1, ce", 0x23},
+		{"IP_TOS", "0x10", 16},
+		{"IPV6_TCLASS", "default", -1},
+		{"IP_MTU_DISCOVER", "probe", 3},
+		{"IPV6_UNICAST_HOPS", "default", -1},
+	}
+	for _, tt := range tests {
+		got, err := OptionsMap[tt.name].Parse(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %q: got %#v, %v, want %#v", tt.name, tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name, input, syntax string
+	}{
+		{"TCP_NODELAY", "maybe", "expected on, off"},
+		{"TCP_KEEPIDLE", "soon", "expected seconds or a duration such as 90s or 2h"},
+		{"TCP_KEEPIDLE", "1500ms", "not a whole number of seconds"},
+		{"TCP_WINDOW_CLAMP", "lots", "expected bytes or a size"},
+		{"TCP_REPAIR_QUEUE", "both", "expected none, recv, send or an integer"},
+		{"IP_TOS", "AF44", "or a DSCP name such as EF"},
+		{"IP_TOS", "ef,ecn", "or a DSCP name such as EF"},
+	} {
+		_, err := OptionsMap[tt.name].Parse(tt.input)
+		if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), tt.syntax) {
+			t.Errorf("%s %q: got %v, want %q", tt.name, tt.input, err, tt.syntax)
+		}
+	}
+}
+
+func TestFormatUnitsAndNames(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"TCP_KEEPIDLE", 7200, "2h"},
+		{"TCP_KEEPINTVL", 90, "1m30s"},
+		{"TCP_USER_TIMEOUT", 1500, "1.5s"},
+		{"TCP_LINGER2", -1, "off"},
+		{"TCP_WINDOW_CLAMP", 4 << 20, "4MiB"},
+		{"TCP_MAXSEG", 1448, "1448"},
+		{"TCP_REPAIR_QUEUE", 2, "send"},
+		{"TCP_KEEPCNT", 9, "9"},
+		{"IP_TOS", 0, "0x00 (CS0)"},
+		{"IP_TOS", 0xb8, "0xb8 (EF)"},
+		{"IPV6_TCLASS", 0x8a, "0x8a (AF41, ECT(0))"},
+		{"IP_TOS", 0x17, "0x17 (DSCP 5, CE)"},
+		{"IP_MTU", 1500, "1500"},
+		{"IP_MTU_DISCOVER", 2, "do"},
+	} {
+		if got := OptionsMap[tt.name].Format(tt.value); got != tt.want {
+			t.Errorf("%s %v: got %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package sockopt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Values of Access.
+const (
+	AccessAuto   = ""
+	AccessPidfd  = "pidfd"
+	AccessPtrace = "ptrace"
+)
+
+// Access selects how Open reaches the socket of another process. With
+// AccessPidfd the descriptor is duplicated with pidfd_getfd, which requires
+// Linux 5.6. With AccessPtrace sox attaches to the process and injects
+// getsockopt and setsockopt calls into it; this works on older kernels but
+// stops the process for the duration of every call. AccessAuto uses pidfd and
+// falls back to ptrace when pidfd_getfd is not implemented.
+var Access = AccessAuto
+
+var (
+	// ErrUnableToAttach is returned when sox cannot attach to a process with
+	// ptrace. The error wraps the errno returned by ptrace.
+	ErrUnableToAttach = errors.New("unable to attach to pid")
+	// ErrPtraceUnsupported is returned for processes the ptrace backend cannot
+	// inject calls into.
+	ErrPtraceUnsupported = errors.New("ptrace access not supported")
+)
+
+// scratchSize is the size of the memory mapped in the process for the
+// arguments of injected calls. It holds a length word and the option value.
+const scratchSize = 4096
+
+// ptraceConn injects socket calls into the process owning the socket. All
+// ptrace requests are made from one locked OS thread, as the kernel requires.
+type ptraceConn struct {
+	pid, fd int
+	calls   chan func()
+	// t is set while the process is attached.
+	t *tracee
+}
+
+// tracee is a process stopped for injection. Everything it changes in the
+// process is recorded so that detach can undo it.
+type tracee struct {
+	pid     int
+	threads []int
+	// signals arrived while the threads were stopped and are delivered again
+	// on detach.
+	signals map[int][]int
+	exited  bool
+
+	saved    regs
+	haveRegs bool
+	pc       uintptr
+	text     []byte
+	patched  bool
+	scratch  uintptr
+}
+
+func openPtrace(pid, fd int) (*ptraceConn, error) {
+	if !ptraceSupported {
+		return nil, fmt.Errorf("%w on %s", ErrPtraceUnsupported, runtime.GOARCH)
+	}
+	if err := checkTracee(pid); err != nil {
+		return nil, err
+	}
+
+	c := &ptraceConn{pid: pid, fd: fd, calls: make(chan func())}
+	go c.serve()
+	// Attach once so that permission problems surface in Open.
+	if err := c.session(func() error { return nil }); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkTracee refuses processes whose calls cannot be injected safely.
+func checkTracee(pid int) error {
+	proc := "/proc/" + strconv.Itoa(pid)
+	if f, err := os.Open(proc + "/exe"); err == nil {
+		ident := make([]byte, 5)
+		_, err := f.Read(ident)
+		f.Close()
+		if err == nil && string(ident[:4]) == "\x7fELF" && ident[4] != 2 {
+			return fmt.Errorf("%w: process %d is not a 64-bit process", ErrPtraceUnsupported, pid)
+		}
+	}
+	if b, err := os.ReadFile(proc + "/status"); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if v, ok := strings.CutPrefix(line, "Seccomp:"); ok && strings.TrimSpace(v) == "2" {
+				return fmt.Errorf("%w: process %d runs under a seccomp filter, which may kill it for injected calls", ErrPtraceUnsupported, pid)
+			}
+		}
+	}
+	return nil
+}
+
+// serve runs ptrace requests on a dedicated thread. The thread exits with
+// the goroutine since it stays locked.
+func (c *ptraceConn) serve() {
+	runtime.LockOSThread()
+	for f := range c.calls {
+		f()
+	}
+}
+
+// do runs f on the tracing thread.
+func (c *ptraceConn) do(f func() error) error {
+	done := make(chan error)
+	c.calls <- func() { done <- f() }
+	return <-done
+}
+
+func (c *ptraceConn) session(fn func() error) error {
+	if c.t != nil {
+		return fn()
+	}
+	if err := c.do(func() (err error) {
+		c.t, err = attach(c.pid)
+		return err
+	}); err != nil {
+		return err
+	}
+	err := fn()
+	if dErr := c.do(c.t.detach); dErr != nil && err == nil {
+		err = dErr
+	}
+	c.t = nil
+	return err
+}
+
+// call runs fn on the tracing thread with the process attached.
+func (c *ptraceConn) call(fn func(t *tracee) error) error {
+	return c.session(func() error {
+		return c.do(func() error { return fn(c.t) })
+	})
+}
+
+func (c *ptraceConn) getsockopt(level, opt int, buf []byte) (int, error) {
+	if len(buf) > scratchSize-8 {
+		return 0, unix.EINVAL
+	}
+	var n int
+	err := c.call(func(t *tracee) error {
+		// optlen, padding and the buffer, which carries the request of
+		// options such as TCP_RECV_ZEROCOPY
+		in := binary.NativeEndian.AppendUint32(nil, uint32(len(buf)))
+		in = append(append(in, 0, 0, 0, 0), buf...)
+		if _, err := unix.PtracePokeData(t.pid, t.scratch, in); err != nil {
+			return err
+		}
+		if _, err := t.inject(unix.SYS_GETSOCKOPT, uintptr(c.fd), uintptr(level), uintptr(opt), t.scratch+8, t.scratch); err != nil {
+			return err
+		}
+		l := make([]byte, 4)
+		if _, err := unix.PtracePeekData(t.pid, t.scratch, l); err != nil {
+			return err
+		}
+		n = min(int(binary.NativeEndian.Uint32(l)), len(buf))
+		if n == 0 {
+			return nil
+		}
+		_, err := unix.PtracePeekData(t.pid, t.scratch+8, buf[:n])
+		return err
+	})
+	return n, err
+}
+
+func (c *ptraceConn) setsockopt(level, opt int, val []byte) error {
+	if len(val) > scratchSize-8 {
+		return unix.EINVAL
+	}
+	return c.call(func(t *tracee) error {
+		if len(val) > 0 {
+			if _, err := unix.PtracePokeData(t.pid, t.scratch+8, val); err != nil {
+				return err
+			}
+		}
+		_, err := t.inject(unix.SYS_SETSOCKOPT, uintptr(c.fd), uintptr(level), uintptr(opt), t.scratch+8, uintptr(len(val)))
+		return err
+	})
+}
+
+func (c *ptraceConn) ioctl(req uint) (int, error) {
+	var n int
+	err := c.call(func(t *tracee) error {
+		if _, err := t.inject(unix.SYS_IOCTL, uintptr(c.fd), uintptr(req), t.scratch); err != nil {
+			return err
+		}
+		b := make([]byte, 4)
+		if _, err := unix.PtracePeekData(t.pid, t.scratch, b); err != nil {
+			return err
+		}
+		n = int(int32(binary.NativeEndian.Uint32(b)))
+		return nil
+	})
+	return n, err
+}
+
+func (c *ptraceConn) shutdown(how int) error {
+	return c.call(func(t *tracee) error {
+		_, err := t.inject(unix.SYS_SHUTDOWN, uintptr(c.fd), uintptr(how))
+		return err
+	})
+}
+
+func (c *ptraceConn) peek(buf []byte) (int, error) {
+	if len(buf) > scratchSize {
+		return 0, unix.EMSGSIZE
+	}
+	var n int
+	err := c.call(func(t *tracee) error {
+		r, err := t.inject(unix.SYS_RECVFROM, uintptr(c.fd), t.scratch, uintptr(len(buf)), unix.MSG_PEEK|unix.MSG_DONTWAIT, 0, 0)
+		if err != nil {
+			return err
+		}
+		n = int(r)
+		if n == 0 {
+			return nil
+		}
+		_, err = unix.PtracePeekData(t.pid, t.scratch, buf[:n])
+		return err
+	})
+	return n, err
+}
+
+func (c *ptraceConn) name() string {
+	var sa []byte
+	err := c.call(func(t *tracee) error {
+		l := binary.NativeEndian.AppendUint32(nil, unix.SizeofSockaddrAny)
+		if _, err := unix.PtracePokeData(t.pid, t.scratch, l); err != nil {
+			return err
+		}
+		if _, err := t.inject(unix.SYS_GETSOCKNAME, uintptr(c.fd), t.scratch+8, t.scratch); err != nil {
+			return err
+		}
+		if _, err := unix.PtracePeekData(t.pid, t.scratch, l); err != nil {
+			return err
+		}
+		sa = make([]byte, min(binary.NativeEndian.Uint32(l), unix.SizeofSockaddrAny))
+		if len(sa) == 0 {
+			return nil
+		}
+		_, err := unix.PtracePeekData(t.pid, t.scratch+8, sa)
+		return err
+	})
+	if err != nil {
+		return ""
+	}
+	return rawSockaddrName(sa)
+}
+
+// rawSockaddrName formats an IPv4 or IPv6 sockaddr like GetSocketName.
+func rawSockaddrName(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	switch binary.NativeEndian.Uint16(b) {
+	case unix.AF_INET:
+		if len(b) < unix.SizeofSockaddrInet4 {
+			return ""
+		}
+		return formatSockaddr(&unix.SockaddrInet4{
+			Port: int(binary.BigEndian.Uint16(b[2:4])),
+			Addr: [4]byte(b[4:8]),
+		})
+	case unix.AF_INET6:
+		if len(b) < unix.SizeofSockaddrInet6 {
+			return ""
+		}
+		return formatSockaddr(&unix.SockaddrInet6{
+			Port:   int(binary.BigEndian.Uint16(b[2:4])),
+			Addr:   [16]byte(b[8:24]),
+			ZoneId: binary.NativeEndian.Uint32(b[24:28]),
+		})
+	}
+	return ""
+}
+
+func (c *ptraceConn) close() error {
+	var err error
+	if c.t != nil {
+		err = c.do(c.t.detach)
+		c.t = nil
+	}
+	close(c.calls)
+	return err
+}
+
+// attach stops all threads of process pid and prepares its main thread for
+// injected calls. On failure everything done so far is undone.
+func attach(pid int) (*tracee, error) {
+	t := &tracee{pid: pid, signals: make(map[int][]int)}
+	if err := t.seize(); err != nil {
+		t.detach()
+		return nil, fmt.Errorf("%w %d: %w%s", ErrUnableToAttach, pid, err, pidFdHint(err, 0))
+	}
+	if err := t.prepare(); err != nil {
+		t.detach()
+		return nil, fmt.Errorf("%w %d: %w", ErrUnableToAttach, pid, err)
+	}
+	return t, nil
+}
+
+// seize attaches to and stops every thread. Threads started meanwhile are
+// picked up by listing the threads again until no new one appears.
+func (t *tracee) seize() error {
+	for {
+		tids, err := threads(t.pid)
+		if err != nil {
+			return err
+		}
+		added := false
+		for _, tid := range tids {
+			if slices.Contains(t.threads, tid) {
+				continue
+			}
+			if err := unix.PtraceSeize(tid); err != nil {
+				if errors.Is(err, unix.ESRCH) && tid != t.pid {
+					continue // the thread has exited
+				}
+				return err
+			}
+			t.threads = append(t.threads, tid)
+			added = true
+			if err := unix.PtraceInterrupt(tid); err != nil {
+				return err
+			}
+			if err := t.waitStop(tid); err != nil {
+				return err
+			}
+		}
+		if !added {
+			return nil
+		}
+	}
+}
+
+// waitStop waits until a seized thread stops. A signal arriving first stops
+// the thread as well and is kept for detach.
+func (t *tracee) waitStop(tid int) error {
+	var ws unix.WaitStatus
+	if _, err := unix.Wait4(tid, &ws, unix.WALL, nil); err != nil {
+		return err
+	}
+	switch {
+	case ws.Exited() || ws.Signaled():
+		if tid == t.pid {
+			t.exited = true
+			return ErrProcessExited
+		}
+		t.threads = slices.DeleteFunc(t.threads, func(id int) bool { return id == tid })
+	case ws.Stopped() && !isEventStop(ws):
+		t.signals[tid] = append(t.signals[tid], int(ws.StopSignal()))
+	}
+	return nil
+}
+
+func isEventStop(ws unix.WaitStatus) bool {
+	return uint32(ws)>>16 == unix.PTRACE_EVENT_STOP
+}
+
+// prepare saves the registers of the main thread, writes the syscall and
+// trap instructions to its text and maps scratch memory.
+func (t *tracee) prepare() error {
+	if err := getRegs(t.pid, &t.saved); err != nil {
+		return err
+	}
+	t.haveRegs = true
+
+	t.pc = regsPC(&t.saved) + injectOffset
+	t.text = make([]byte, len(trapInsn))
+	if _, err := unix.PtracePeekText(t.pid, t.pc, t.text); err != nil {
+		return err
+	}
+	if _, err := unix.PtracePokeText(t.pid, t.pc, trapInsn); err != nil {
+		return err
+	}
+	t.patched = true
+
+	addr, err := t.inject(unix.SYS_MMAP, 0, scratchSize, unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS, ^uintptr(0), 0)
+	if err != nil {
+		return fmt.Errorf("unable to map scratch memory: %w", err)
+	}
+	t.scratch = addr
+	return nil
+}
+
+// inject runs a syscall in the main thread and returns its result.
+func (t *tracee) inject(nr uintptr, args ...uintptr) (uintptr, error) {
+	r := t.saved
+	var a [6]uintptr
+	copy(a[:], args)
+	setSyscall(&r, t.pc, nr, a)
+	if err := setRegs(t.pid, &r); err != nil {
+		return 0, err
+	}
+
+	for {
+		if err := unix.PtraceCont(t.pid, 0); err != nil {
+			return 0, err
+		}
+		var ws unix.WaitStatus
+		if _, err := unix.Wait4(t.pid, &ws, unix.WALL, nil); err != nil {
+			return 0, err
+		}
+		if ws.Exited() || ws.Signaled() {
+			t.exited = true
+			return 0, ErrProcessExited
+		}
+		if !ws.Stopped() || isEventStop(ws) {
+			continue
+		}
+		if ws.StopSignal() == unix.SIGTRAP {
+			break
+		}
+		// Another signal arrived during the call. It is suppressed now and
+		// delivered on detach.
+		t.signals[t.pid] = append(t.signals[t.pid], int(ws.StopSignal()))
+	}
+
+	if err := getRegs(t.pid, &r); err != nil {
+		return 0, err
+	}
+	ret := syscallResult(&r)
+	if errno := -int(ret); errno > 0 && errno < 4096 {
+		return 0, unix.Errno(errno)
+	}
+	return ret, nil
+}
+
+// detach unmaps the scratch memory, restores the text and registers of the
+// main thread and resumes all threads with the signals that arrived while
+// they were stopped. It undoes as much as possible on errors.
+func (t *tracee) detach() error {
+	var errs []error
+	if !t.exited {
+		if t.scratch != 0 {
+			if _, err := t.inject(unix.SYS_MUNMAP, t.scratch, scratchSize); err != nil {
+				errs = append(errs, fmt.Errorf("unable to unmap scratch memory: %w", err))
+			}
+			t.scratch = 0
+		}
+		if t.patched && !t.exited {
+			if _, err := unix.PtracePokeText(t.pid, t.pc, t.text); err != nil {
+				errs = append(errs, fmt.Errorf("unable to restore text: %w", err))
+			}
+			t.patched = false
+		}
+		if t.haveRegs && !t.exited {
+			if err := setRegs(t.pid, &t.saved); err != nil {
+				errs = append(errs, fmt.Errorf("unable to restore registers: %w", err))
+			}
+		}
+	}
+
+	for _, tid := range t.threads {
+		pending := t.signals[tid]
+		sig := 0
+		if len(pending) > 0 {
+			sig = pending[0]
+		}
+		_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_DETACH, uintptr(tid), 0, uintptr(sig), 0, 0)
+		if errno != 0 && errno != unix.ESRCH {
+			errs = append(errs, fmt.Errorf("unable to detach from thread %d: %w", tid, errno))
+		}
+		for _, s := range slices.Compact(slices.Clone(pending[min(1, len(pending)):])) {
+			unix.Tgkill(t.pid, tid, unix.Signal(s))
+		}
+	}
+	t.threads = nil
+	return errors.Join(errs...)
+}
+
+// threads lists the thread ids of a process, the main thread first.
+func threads(pid int) ([]int, error) {
+	entries, err := os.ReadDir("/proc/" + strconv.Itoa(pid) + "/task")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, unix.ESRCH
+		}
+		return nil, err
+	}
+	tids := []int{pid}
+	for _, e := range entries {
+		if tid, err := strconv.Atoi(e.Name()); err == nil && tid != pid {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
@@ -0,0 +1,40 @@
+package sockopt
+
+import "golang.org/x/sys/unix"
+
+const ptraceSupported = true
+
+type regs = unix.PtraceRegs
+
+// trapInsn is syscall followed by int3, padded to a word.
+var trapInsn = []byte{0x0f, 0x05, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc, 0xcc}
+
+// injectOffset is added to the program counter to get the address the
+// instructions are written to.
+const injectOffset = 0
+
+func getRegs(tid int, r *regs) error {
+	return unix.PtraceGetRegs(tid, r)
+}
+
+func setRegs(tid int, r *regs) error {
+	return unix.PtraceSetRegs(tid, r)
+}
+
+func regsPC(r *regs) uintptr {
+	return uintptr(r.Rip)
+}
+
+// setSyscall prepares r to run syscall nr at pc. orig_rax is cleared so that
+// the kernel does not restart a syscall the thread was stopped in.
+func setSyscall(r *regs, pc, nr uintptr, args [6]uintptr) {
+	r.Rip = uint64(pc)
+	r.Rax = uint64(nr)
+	r.Orig_rax = ^uint64(0)
+	r.Rdi, r.Rsi, r.Rdx = uint64(args[0]), uint64(args[1]), uint64(args[2])
+	r.R10, r.R8, r.R9 = uint64(args[3]), uint64(args[4]), uint64(args[5])
+}
+
+func syscallResult(r *regs) uintptr {
+	return uintptr(r.Rax)
+}
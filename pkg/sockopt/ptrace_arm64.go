@@ -0,0 +1,44 @@
+package sockopt
+
+import "golang.org/x/sys/unix"
+
+const ptraceSupported = true
+
+type regs = unix.PtraceRegsArm64
+
+// ntPrstatus selects the general purpose registers in PTRACE_GETREGSET.
+const ntPrstatus = 1
+
+// trapInsn is svc #0 followed by brk #0.
+var trapInsn = []byte{0x01, 0x00, 0x00, 0xd4, 0x00, 0x00, 0x20, 0xd4}
+
+// injectOffset is added to the program counter to get the address the
+// instructions are written to. A thread stopped in a syscall has its program
+// counter rewound to the svc instruction, and the kernel rewrites x8 for
+// ERESTART_RESTARTBLOCK when the thread resumes there, so the instructions
+// are placed after it.
+const injectOffset = 8
+
+func getRegs(tid int, r *regs) error {
+	return unix.PtraceGetRegSetArm64(tid, ntPrstatus, r)
+}
+
+func setRegs(tid int, r *regs) error {
+	return unix.PtraceSetRegSetArm64(tid, ntPrstatus, r)
+}
+
+func regsPC(r *regs) uintptr {
+	return uintptr(r.Pc)
+}
+
+func setSyscall(r *regs, pc, nr uintptr, args [6]uintptr) {
+	r.Pc = uint64(pc)
+	r.Regs[8] = uint64(nr)
+	for i, a := range args {
+		r.Regs[i] = uint64(a)
+	}
+}
+
+func syscallResult(r *regs) uintptr {
+	return uintptr(r.Regs[0])
+}
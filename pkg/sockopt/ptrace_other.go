@@ -0,0 +1,21 @@
+//go:build !amd64 && !arm64
+
+package sockopt
+
+const ptraceSupported = false
+
+type regs struct{}
+
+var trapInsn []byte
+
+const injectOffset = 0
+
+func getRegs(tid int, r *regs) error { return ErrPtraceUnsupported }
+
+func setRegs(tid int, r *regs) error { return ErrPtraceUnsupported }
+
+func regsPC(r *regs) uintptr { return 0 }
+
+func setSyscall(r *regs, pc, nr uintptr, args [6]uintptr) {}
+
+func syscallResult(r *regs) uintptr { return 0 }
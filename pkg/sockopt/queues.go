@@ -0,0 +1,160 @@
+package sockopt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// MemInfo is the value of SO_MEMINFO, the SK_MEMINFO_* counters of a socket.
+// All counters are bytes except Drops.
+type MemInfo struct {
+	RmemAlloc  int `json:"rmem_alloc" yaml:"rmem_alloc"`
+	Rcvbuf     int `json:"rcvbuf" yaml:"rcvbuf"`
+	WmemAlloc  int `json:"wmem_alloc" yaml:"wmem_alloc"`
+	Sndbuf     int `json:"sndbuf" yaml:"sndbuf"`
+	FwdAlloc   int `json:"fwd_alloc" yaml:"fwd_alloc"`
+	WmemQueued int `json:"wmem_queued" yaml:"wmem_queued"`
+	Optmem     int `json:"optmem" yaml:"optmem"`
+	Backlog    int `json:"backlog" yaml:"backlog"`
+	Drops      int `json:"drops" yaml:"drops"`
+}
+
+// String summarises the counters on a single line for list output.
+func (m MemInfo) String() string {
+	return fmt.Sprintf("rmem=%s/%s wmem=%s/%s queued=%s drops=%d", formatSize(m.RmemAlloc), formatSize(m.Rcvbuf),
+		formatSize(m.WmemAlloc), formatSize(m.Sndbuf), formatSize(m.WmemQueued), m.Drops)
+}
+
+// memInfoType describes SO_MEMINFO. The buffer leaves room for counters
+// added by newer kernels, which are ignored.
+var memInfoType = &StructType{
+	Size: 64,
+	Decode: func(b []byte) (any, error) {
+		var v [9]int
+		if len(b) < len(v)*4 {
+			return nil, fmt.Errorf("short meminfo of %d bytes", len(b))
+		}
+		for i := range v {
+			v[i] = int(binary.NativeEndian.Uint32(b[i*4:]))
+		}
+		return MemInfo{v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7], v[8]}, nil
+	},
+}
+
+// Queues reports how much data and memory sits in the queues of a socket.
+// Counters the socket does not support are nil: SIOCINQ, SIOCOUTQ and
+// SIOCOUTQNSD depend on the protocol, AcceptQueue and AcceptBacklog are only
+// known for TCP listeners and MemInfo needs Linux 4.12.
+type Queues struct {
+	// Inq is the result of SIOCINQ: bytes received but not read, or the
+	// size of the next datagram.
+	Inq *int `json:"inq,omitempty" yaml:"inq,omitempty"`
+	// Outq is the result of SIOCOUTQ: bytes not yet acknowledged by the
+	// peer, or not yet sent for datagram sockets.
+	Outq *int `json:"outq,omitempty" yaml:"outq,omitempty"`
+	// OutqNSD is the result of SIOCOUTQNSD: bytes not yet sent.
+	OutqNSD *int `json:"outq_nsd,omitempty" yaml:"outq_nsd,omitempty"`
+	// AcceptQueue is the number of connections waiting for accept and
+	// AcceptBacklog the limit set by listen.
+	AcceptQueue   *int     `json:"accept_queue,omitempty" yaml:"accept_queue,omitempty"`
+	AcceptBacklog *int     `json:"accept_backlog,omitempty" yaml:"accept_backlog,omitempty"`
+	MemInfo       *MemInfo `json:"meminfo,omitempty" yaml:"meminfo,omitempty"`
+}
+
+// QueueField is a single counter of Queues.
+type QueueField struct {
+	Name        string
+	Value       int
+	Bytes       bool
+	Description string
+}
+
+// FormatValue renders the counter for table output.
+func (f QueueField) FormatValue() string {
+	if f.Bytes {
+		return formatBytes(uint64(f.Value))
+	}
+	return strconv.Itoa(f.Value)
+}
+
+// Fields returns the counters that are known in a fixed order.
+func (q Queues) Fields() []QueueField {
+	var fields []QueueField
+	add := func(name string, v *int, bytes bool, desc string) {
+		if v != nil {
+			fields = append(fields, QueueField{Name: name, Value: *v, Bytes: bytes, Description: desc})
+		}
+	}
+	add("inq", q.Inq, true, "Received, not yet read (next datagram for UDP)")
+	add("outq", q.Outq, true, "Not yet acknowledged (not yet sent for UDP)")
+	add("outq_nsd", q.OutqNSD, true, "Written, not sent yet")
+	add("accept_queue", q.AcceptQueue, false, "Connections waiting for accept")
+	add("accept_backlog", q.AcceptBacklog, false, "Accept queue limit set by listen")
+	if m := q.MemInfo; m != nil {
+		add("rmem_alloc", &m.RmemAlloc, true, "Receive queue memory")
+		add("rcvbuf", &m.Rcvbuf, true, "Receive buffer limit (SO_RCVBUF)")
+		add("wmem_alloc", &m.WmemAlloc, true, "Sent data held below the socket, e.g. in qdiscs")
+		add("sndbuf", &m.Sndbuf, true, "Send buffer limit (SO_SNDBUF)")
+		add("fwd_alloc", &m.FwdAlloc, true, "Memory reserved ahead of use")
+		add("wmem_queued", &m.WmemQueued, true, "Send queue memory, sent or not")
+		add("optmem", &m.Optmem, true, "Option and ancillary data memory")
+		add("backlog", &m.Backlog, true, "Received while the socket was locked")
+		add("drops", &m.Drops, false, "Packets dropped by the socket")
+	}
+	return fields
+}
+
+// Queues reads the queue counters of the socket with SO_MEMINFO, the
+// SIOCINQ, SIOCOUTQ and SIOCOUTQNSD ioctls and, for TCP listeners, tcp_info.
+// An error is returned only if none of them could be read.
+func (s *Socket) Queues() (Queues, error) {
+	var q Queues
+	var errs []string
+	err := s.session(func() error {
+		for _, ioc := range []struct {
+			name string
+			req  uint
+			v    **int
+		}{
+			{"SIOCINQ", unix.SIOCINQ, &q.Inq},
+			{"SIOCOUTQ", unix.SIOCOUTQ, &q.Outq},
+			{"SIOCOUTQNSD", unix.SIOCOUTQNSD, &q.OutqNSD},
+		} {
+			n, err := s.conn.ioctl(ioc.req)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", ioc.name, err))
+				continue
+			}
+			*ioc.v = &n
+		}
+
+		if v, err := s.Get("SO_MEMINFO"); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			m := v.(MemInfo)
+			q.MemInfo = &m
+		}
+
+		if listening, err := s.Get("SO_ACCEPTCONN"); err == nil && listening == true {
+			if v, err := s.Get("TCP_INFO"); err == nil {
+				// tcp_info of a listener reports sk_ack_backlog as unacked
+				// and sk_max_ack_backlog as sacked
+				ti := v.(TCPInfo)
+				queue, backlog := int(ti.Unacked), int(ti.Sacked)
+				q.AcceptQueue, q.AcceptBacklog = &queue, &backlog
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return q, err
+	}
+	if len(q.Fields()) == 0 {
+		return q, fmt.Errorf("unable to read socket queues: %s", strings.Join(errs, "; "))
+	}
+	return q, nil
+}
@@ -0,0 +1,502 @@
+package sockopt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Queues addressed by TCP_REPAIR_QUEUE, from linux/tcp.h.
+const (
+	tcpNoQueue   = 0
+	tcpRecvQueue = 1
+	tcpSendQueue = 2
+)
+
+// TCPI_OPT_* flags of tcp_info, see tcpiOptions.
+const (
+	tcpiOptTimestamps = 1 << 0
+	tcpiOptSACK       = 1 << 1
+	tcpiOptWscale     = 1 << 2
+)
+
+// RepairOptions are the TCP options negotiated in the handshake. A socket in
+// repair mode cannot negotiate them and is given them with
+// TCP_REPAIR_OPTIONS instead. The window scale shifts are only used if
+// WindowScaling is set.
+type RepairOptions struct {
+	MSS           int  `json:"mss" yaml:"mss"`
+	WindowScaling bool `json:"window_scaling" yaml:"window_scaling"`
+	SndWscale     int  `json:"snd_wscale" yaml:"snd_wscale"`
+	RcvWscale     int  `json:"rcv_wscale" yaml:"rcv_wscale"`
+	SACK          bool `json:"sack" yaml:"sack"`
+	Timestamps    bool `json:"timestamps" yaml:"timestamps"`
+}
+
+// String renders the options in the syntax accepted by Parse, e.g.
+// "mss=1460,wscale=7/7,sack,ts".
+func (o RepairOptions) String() string {
+	parts := []string{"mss=" + strconv.Itoa(o.MSS)}
+	if o.WindowScaling {
+		parts = append(parts, fmt.Sprintf("wscale=%d/%d", o.SndWscale, o.RcvWscale))
+	}
+	if o.SACK {
+		parts = append(parts, "sack")
+	}
+	if o.Timestamps {
+		parts = append(parts, "ts")
+	}
+	return strings.Join(parts, ",")
+}
+
+// repairOptionsType describes TCP_REPAIR_OPTIONS, an array of struct
+// tcp_repair_opt that can only be set.
+var repairOptionsType = &StructType{
+	Encode: func(v any) ([]byte, error) {
+		o, ok := v.(RepairOptions)
+		if !ok {
+			return nil, fmt.Errorf("%w: TCP_REPAIR_OPTIONS expects repair options, got %T", ErrInvalidValue, v)
+		}
+		var b []byte
+		add := func(code, val uint32) {
+			b = binary.NativeEndian.AppendUint32(b, code)
+			b = binary.NativeEndian.AppendUint32(b, val)
+		}
+		if o.MSS > 0 {
+			add(unix.TCPOPT_MAXSEG, uint32(o.MSS))
+		}
+		if o.WindowScaling {
+			add(unix.TCPOPT_WINDOW, uint32(o.SndWscale)|uint32(o.RcvWscale)<<16)
+		}
+		if o.SACK {
+			add(unix.TCPOPT_SACK_PERMITTED, 0)
+		}
+		if o.Timestamps {
+			add(unix.TCPOPT_TIMESTAMP, 0)
+		}
+		return b, nil
+	},
+	Parse: func(s string) (any, error) {
+		var o RepairOptions
+		for _, part := range strings.Split(s, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			var err error
+			switch key {
+			case "mss":
+				o.MSS, err = strconv.Atoi(val)
+			case "wscale":
+				snd, rcv, _ := strings.Cut(val, "/")
+				if o.SndWscale, err = strconv.Atoi(snd); err == nil {
+					o.RcvWscale, err = strconv.Atoi(rcv)
+				}
+				o.WindowScaling = true
+			case "sack":
+				o.SACK = true
+			case "ts":
+				o.Timestamps = true
+			default:
+				err = errors.New("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid repair option %q, expected mss=<bytes>, wscale=<snd>/<rcv>, sack or ts", part)
+			}
+		}
+		return o, nil
+	},
+	New: func() any { return new(RepairOptions) },
+}
+
+// RepairWindow is the value of TCP_REPAIR_WINDOW, the send and receive
+// window state of a socket in repair mode.
+type RepairWindow struct {
+	SndWl1    uint32 `json:"snd_wl1" yaml:"snd_wl1"`
+	SndWnd    uint32 `json:"snd_wnd" yaml:"snd_wnd"`
+	MaxWindow uint32 `json:"max_window" yaml:"max_window"`
+	RcvWnd    uint32 `json:"rcv_wnd" yaml:"rcv_wnd"`
+	RcvWup    uint32 `json:"rcv_wup" yaml:"rcv_wup"`
+}
+
+// String renders the window in the syntax accepted by Parse.
+func (w RepairWindow) String() string {
+	return fmt.Sprintf("snd_wl1=%d,snd_wnd=%d,max_window=%d,rcv_wnd=%d,rcv_wup=%d",
+		w.SndWl1, w.SndWnd, w.MaxWindow, w.RcvWnd, w.RcvWup)
+}
+
+// fields returns pointers to the fields in the order of struct
+// tcp_repair_window.
+func (w *RepairWindow) fields() []*uint32 {
+	return []*uint32{&w.SndWl1, &w.SndWnd, &w.MaxWindow, &w.RcvWnd, &w.RcvWup}
+}
+
+// repairWindowType describes TCP_REPAIR_WINDOW. It can only be read and set
+// in repair mode.
+var repairWindowType = &StructType{
+	Size:   20,
+	Decode: decodeRepairWindow,
+	get: func(so SocketOption, c conn) (any, error) {
+		// outside repair mode the kernel answers EPERM, which would be
+		// reported as missing privileges
+		if on, err := getsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_REPAIR); err == nil && on == 0 {
+			return nil, unix.EINVAL
+		}
+		b, err := getsockoptBytes(c, so.Level, so.Option, 20)
+		if err != nil {
+			return nil, err
+		}
+		return decodeRepairWindow(b)
+	},
+	Encode: func(v any) ([]byte, error) {
+		w, ok := v.(RepairWindow)
+		if !ok {
+			return nil, fmt.Errorf("%w: TCP_REPAIR_WINDOW expects a repair window, got %T", ErrInvalidValue, v)
+		}
+		var b []byte
+		for _, f := range w.fields() {
+			b = binary.NativeEndian.AppendUint32(b, *f)
+		}
+		return b, nil
+	},
+	Parse: func(s string) (any, error) {
+		var w RepairWindow
+		names := []string{"snd_wl1", "snd_wnd", "max_window", "rcv_wnd", "rcv_wup"}
+		fields := w.fields()
+		seen := 0
+		for _, part := range strings.Split(s, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			i := slices.Index(names, key)
+			n, err := strconv.ParseUint(val, 0, 32)
+			if i < 0 || err != nil {
+				return nil, fmt.Errorf("invalid repair window field %q", part)
+			}
+			*fields[i] = uint32(n)
+			seen++
+		}
+		if seen != len(names) {
+			return nil, fmt.Errorf("invalid repair window %q, expected %s", s, strings.Join(names, "=<n>,")+"=<n>")
+		}
+		return w, nil
+	},
+	New: func() any { return new(RepairWindow) },
+}
+
+func decodeRepairWindow(b []byte) (any, error) {
+	var w RepairWindow
+	if len(b) < 20 {
+		return nil, fmt.Errorf("short tcp_repair_window of %d bytes", len(b))
+	}
+	for i, f := range w.fields() {
+		*f = binary.NativeEndian.Uint32(b[i*4:])
+	}
+	return w, nil
+}
+
+// TCPCheckpoint is the state of an established TCP connection read in repair
+// mode, from which RestoreTCP recreates the connection.
+type TCPCheckpoint struct {
+	Local  string `json:"local" yaml:"local"`
+	Remote string `json:"remote" yaml:"remote"`
+	// SendSeq is the sequence number after the last byte written and
+	// RecvSeq the next sequence number expected from the peer.
+	SendSeq uint32 `json:"send_seq" yaml:"send_seq"`
+	RecvSeq uint32 `json:"recv_seq" yaml:"recv_seq"`
+	// SendQueue holds the data written but not acknowledged. Its last
+	// Unsent bytes were never sent.
+	SendQueue Bytes `json:"send_queue" yaml:"send_queue"`
+	Unsent    int   `json:"unsent" yaml:"unsent"`
+	// RecvQueue holds the data received but not read.
+	RecvQueue Bytes         `json:"recv_queue" yaml:"recv_queue"`
+	Options   RepairOptions `json:"options" yaml:"options"`
+	// Window is nil on kernels before 4.8, which lack TCP_REPAIR_WINDOW.
+	Window    *RepairWindow `json:"window,omitempty" yaml:"window,omitempty"`
+	Timestamp uint32        `json:"timestamp" yaml:"timestamp"`
+}
+
+// CheckpointTCP reads the state of an established TCP connection. The
+// socket is put into repair mode meanwhile, in which it neither sends nor
+// acknowledges data. Unless stop is set it leaves repair mode afterwards and
+// the connection carries on. With stop the socket stays in repair mode, so
+// the connection can be restored elsewhere with RestoreTCP: the owning
+// process gets errors on the socket, and closing it sends neither FIN nor
+// RST.
+//
+// Repair mode requires CAP_NET_ADMIN. With the ptrace backend the queues
+// can only be read up to 4 KiB.
+func (s *Socket) CheckpointTCP(stop bool) (TCPCheckpoint, error) {
+	var cp TCPCheckpoint
+	err := s.session(func() error {
+		v, err := s.Get("TCP_INFO")
+		if err != nil {
+			return err
+		}
+		ti := v.(TCPInfo)
+		if tcpStateName(ti.State) != "ESTABLISHED" {
+			return fmt.Errorf("only established connections can be checkpointed, socket is %s", tcpStateName(ti.State))
+		}
+		cp.Options = RepairOptions{
+			WindowScaling: ti.Options&tcpiOptWscale != 0,
+			SACK:          ti.Options&tcpiOptSACK != 0,
+			Timestamps:    ti.Options&tcpiOptTimestamps != 0,
+		}
+		if cp.Options.WindowScaling {
+			cp.Options.SndWscale, cp.Options.RcvWscale = int(ti.WScale&0xf), int(ti.WScale>>4)
+		}
+
+		// Leaving repair mode clears SO_REUSEADDR, so it is set again.
+		reuse, err := s.Get("SO_REUSEADDR")
+		if err != nil {
+			return err
+		}
+		if err := s.Set("TCP_REPAIR", unix.TCP_REPAIR_ON); err != nil {
+			return fmt.Errorf("unable to enter repair mode: %w", err)
+		}
+		err = s.checkpoint(&cp)
+		if err == nil && stop {
+			return nil
+		}
+		if e := s.Set("TCP_REPAIR", unix.TCP_REPAIR_OFF); e != nil {
+			return errors.Join(err, fmt.Errorf("unable to leave repair mode: %w", e))
+		}
+		if reuse == true {
+			if e := s.Set("SO_REUSEADDR", true); e != nil {
+				return errors.Join(err, e)
+			}
+		}
+		return err
+	})
+	return cp, err
+}
+
+// checkpoint reads the state of a socket in repair mode.
+func (s *Socket) checkpoint(cp *TCPCheckpoint) error {
+	cp.Local = s.conn.name()
+	// SO_PEERNAME refuses buffers larger than the address
+	size := unix.SizeofSockaddrInet4
+	if s.domain == unix.AF_INET6 {
+		size = unix.SizeofSockaddrInet6
+	}
+	peer, err := getsockoptBytes(s.conn, unix.SOL_SOCKET, unix.SO_PEERNAME, size)
+	if err != nil {
+		return fmt.Errorf("unable to get peer address: %w", err)
+	}
+	cp.Remote = rawSockaddrName(peer)
+
+	// tcp_maxseg reports the MSS clamp negotiated with the peer in repair
+	// mode
+	mss, err := getsockoptInt(s.conn, unix.IPPROTO_TCP, unix.TCP_MAXSEG)
+	if err != nil {
+		return fmt.Errorf("unable to get TCP_MAXSEG: %w", err)
+	}
+	cp.Options.MSS = mss
+
+	var queued, unsent, inq int
+	for _, ioc := range []struct {
+		name string
+		req  uint
+		v    *int
+	}{
+		{"SIOCOUTQ", unix.SIOCOUTQ, &queued},
+		{"SIOCOUTQNSD", unix.SIOCOUTQNSD, &unsent},
+		{"SIOCINQ", unix.SIOCINQ, &inq},
+	} {
+		if *ioc.v, err = s.conn.ioctl(ioc.req); err != nil {
+			return fmt.Errorf("unable to get %s: %w", ioc.name, err)
+		}
+	}
+	cp.Unsent = unsent
+
+	for _, q := range []struct {
+		name  string
+		queue int
+		seq   *uint32
+		data  *Bytes
+		size  int
+	}{
+		{"send", tcpSendQueue, &cp.SendSeq, &cp.SendQueue, queued},
+		{"receive", tcpRecvQueue, &cp.RecvSeq, &cp.RecvQueue, inq},
+	} {
+		if err := s.Set("TCP_REPAIR_QUEUE", q.queue); err != nil {
+			return err
+		}
+		v, err := s.Get("TCP_QUEUE_SEQ")
+		if err != nil {
+			return err
+		}
+		*q.seq = v.(uint32)
+		*q.data = Bytes{}
+		if q.size == 0 {
+			continue
+		}
+		buf := make([]byte, q.size)
+		n, err := s.conn.peek(buf)
+		if err != nil {
+			return fmt.Errorf("unable to read %s queue: %w", q.name, err)
+		}
+		if n != q.size {
+			return fmt.Errorf("unable to read %s queue: got %d of %d bytes", q.name, n, q.size)
+		}
+		*q.data = buf
+	}
+	if err := s.Set("TCP_REPAIR_QUEUE", tcpNoQueue); err != nil {
+		return err
+	}
+
+	if v, err := s.Get("TCP_REPAIR_WINDOW"); err == nil {
+		w := v.(RepairWindow)
+		cp.Window = &w
+	} else if !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	v, err := s.Get("TCP_TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	cp.Timestamp = v.(uint32)
+	return nil
+}
+
+// RestoreTCP creates a socket in repair mode and reinstates the connection
+// of a checkpoint in it, so that it continues where the checkpoint was
+// taken. The connection must no longer exist in sox's network namespace,
+// since two sockets cannot share its addresses; take the checkpoint with
+// stop and close the original socket first, or restore it in another
+// namespace. The returned socket has left repair mode.
+func RestoreTCP(cp TCPCheckpoint) (*Socket, error) {
+	local, err := netip.ParseAddrPort(cp.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local address %q: %w", cp.Local, err)
+	}
+	remote, err := netip.ParseAddrPort(cp.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote address %q: %w", cp.Remote, err)
+	}
+	if cp.Unsent < 0 || cp.Unsent > len(cp.SendQueue) {
+		return nil, fmt.Errorf("invalid checkpoint: %d unsent bytes in a send queue of %d", cp.Unsent, len(cp.SendQueue))
+	}
+
+	domain := unix.AF_INET6
+	if local.Addr().Is4() {
+		domain = unix.AF_INET
+	}
+	fd, err := unix.Socket(domain, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, unix.IPPROTO_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create socket: %w", err)
+	}
+	s := NewSocket(fd)
+	if err := s.restore(cp, local, remote); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// restore reinstates cp in a new socket, in the order CRIU uses: the queue
+// sequence numbers before connect, the negotiated options after it, then
+// the queues and the window.
+func (s *Socket) restore(cp TCPCheckpoint, local, remote netip.AddrPort) error {
+	if err := s.Set("TCP_REPAIR", unix.TCP_REPAIR_ON); err != nil {
+		return fmt.Errorf("unable to enter repair mode: %w", err)
+	}
+	for _, q := range []struct {
+		queue int
+		seq   uint32
+	}{
+		{tcpRecvQueue, cp.RecvSeq - uint32(len(cp.RecvQueue))},
+		{tcpSendQueue, cp.SendSeq - uint32(len(cp.SendQueue))},
+	} {
+		if err := s.Set("TCP_REPAIR_QUEUE", q.queue); err != nil {
+			return err
+		}
+		if err := s.Set("TCP_QUEUE_SEQ", q.seq); err != nil {
+			return err
+		}
+	}
+
+	// in repair mode connect does not send a SYN and establishes the
+	// connection at once
+	if err := unix.Bind(s.fd, sockaddr(local)); err != nil {
+		return fmt.Errorf("unable to bind %s: %w", local, err)
+	}
+	if err := unix.Connect(s.fd, sockaddr(remote)); err != nil {
+		return fmt.Errorf("unable to connect %s: %w", remote, err)
+	}
+	if err := s.Set("TCP_REPAIR_OPTIONS", cp.Options); err != nil {
+		return err
+	}
+	if cp.Options.Timestamps {
+		if err := s.Set("TCP_TIMESTAMP", cp.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	// The receive queue is filled as if the data had arrived, and the sent
+	// part of the send queue as if it had been sent and not acknowledged.
+	sent := len(cp.SendQueue) - cp.Unsent
+	for _, q := range []struct {
+		name  string
+		queue int
+		data  []byte
+	}{
+		{"receive", tcpRecvQueue, cp.RecvQueue},
+		{"send", tcpSendQueue, cp.SendQueue[:sent]},
+	} {
+		if err := s.Set("TCP_REPAIR_QUEUE", q.queue); err != nil {
+			return err
+		}
+		if err := writeAll(s.fd, q.data); err != nil {
+			return fmt.Errorf("unable to restore %s queue: %w", q.name, err)
+		}
+	}
+	if cp.Window != nil {
+		if err := s.Set("TCP_REPAIR_WINDOW", *cp.Window); err != nil {
+			return err
+		}
+	}
+
+	// leaving repair mode sends a window probe, which makes the peer
+	// acknowledge and resynchronises both sides
+	if err := s.Set("TCP_REPAIR", unix.TCP_REPAIR_OFF); err != nil {
+		return fmt.Errorf("unable to leave repair mode: %w", err)
+	}
+	if err := writeAll(s.fd, cp.SendQueue[sent:]); err != nil {
+		return fmt.Errorf("unable to send unsent data: %w", err)
+	}
+	return nil
+}
+
+// sockaddr converts an address for bind and connect.
+func sockaddr(ap netip.AddrPort) unix.Sockaddr {
+	if ap.Addr().Is4() {
+		return &unix.SockaddrInet4{Port: int(ap.Port()), Addr: ap.Addr().As4()}
+	}
+	sa := &unix.SockaddrInet6{Port: int(ap.Port()), Addr: ap.Addr().As16()}
+	if zone := ap.Addr().Zone(); zone != "" {
+		if ifi, err := net.InterfaceByName(zone); err == nil {
+			sa.ZoneId = uint32(ifi.Index)
+		} else if n, err := strconv.ParseUint(zone, 10, 32); err == nil {
+			sa.ZoneId = uint32(n)
+		}
+	}
+	return sa
+}
+
+// writeAll writes b to a blocking descriptor.
+func writeAll(fd int, b []byte) error {
+	for len(b) > 0 {
+		n, err := unix.Write(fd, b)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
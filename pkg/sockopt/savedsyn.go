@@ -0,0 +1,204 @@
+package sockopt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SavedSYN is the SYN a listener saved with TCP_SAVE_SYN, read from the
+// accepted socket with TCP_SAVED_SYN. Raw holds the bytes returned by the
+// kernel; the other fields are decoded from its IP and TCP headers and are
+// left zero if the headers cannot be decoded.
+type SavedSYN struct {
+	Src     string   `json:"src,omitempty" yaml:"src,omitempty"`
+	Dst     string   `json:"dst,omitempty" yaml:"dst,omitempty"`
+	TTL     int      `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	TOS     int      `json:"tos,omitempty" yaml:"tos,omitempty"`
+	Flags   []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+	Seq     uint32   `json:"seq,omitempty" yaml:"seq,omitempty"`
+	Window  int      `json:"window,omitempty" yaml:"window,omitempty"`
+	Options []string `json:"options,omitempty" yaml:"options,omitempty"`
+	Raw     Bytes    `json:"raw" yaml:"raw"`
+}
+
+// String renders the SYN like tcpdump, e.g. "10.0.0.1:40000 > 10.0.0.2:80
+// ttl 64 tos 0x00 (CS0) flags SYN seq 1 win 64240 options mss 1460,...".
+func (s SavedSYN) String() string {
+	switch {
+	case len(s.Raw) == 0:
+		return "none"
+	case s.Src == "":
+		return "undecoded " + s.Raw.String()
+	}
+	return fmt.Sprintf("%s > %s ttl %d tos %s flags %s seq %d win %d options %s",
+		s.Src, s.Dst, s.TTL, formatTOS(s.TOS), strings.Join(s.Flags, ","), s.Seq, s.Window, strings.Join(s.Options, ","))
+}
+
+// savedSYNType describes TCP_SAVED_SYN. The buffer fits the largest IPv4 and
+// TCP headers after an Ethernet header, and IPv6 without extension headers.
+var savedSYNType = &StructType{
+	Size: 512,
+	Decode: func(b []byte) (any, error) {
+		return DecodeSavedSYN(b), nil
+	},
+}
+
+// tcpFlagNames are the TCP header flags from the most significant bit.
+var tcpFlagNames = []string{"CWR", "ECE", "URG", "ACK", "PSH", "RST", "SYN", "FIN"}
+
+// DecodeSavedSYN decodes the headers saved with TCP_SAVE_SYN. With
+// TCP_SAVE_SYN set to 2 they start with the Ethernet header, which is
+// skipped. Reading the option discards the SYN, so undecodable headers are
+// returned raw rather than as an error.
+func DecodeSavedSYN(b []byte) SavedSYN {
+	syn := SavedSYN{Raw: Bytes(b)}
+	ip := b
+	if len(ip) >= 14 && ip[0]>>4 != 4 && ip[0]>>4 != 6 {
+		if t := binary.BigEndian.Uint16(ip[12:14]); t == 0x0800 || t == 0x86dd {
+			ip = ip[14:]
+		}
+	}
+
+	var src, dst netip.Addr
+	var tcp []byte
+	switch {
+	case len(ip) >= 20 && ip[0]>>4 == 4:
+		ihl := int(ip[0]&0xf) * 4
+		if ihl < 20 || len(ip) < ihl || ip[9] != 6 {
+			return syn
+		}
+		syn.TOS, syn.TTL = int(ip[1]), int(ip[8])
+		src, dst = netip.AddrFrom4([4]byte(ip[12:16])), netip.AddrFrom4([4]byte(ip[16:20]))
+		tcp = ip[ihl:]
+	case len(ip) >= 40 && ip[0]>>4 == 6:
+		// extension headers are not decoded
+		if ip[6] != 6 {
+			return syn
+		}
+		syn.TOS, syn.TTL = int(binary.BigEndian.Uint16(ip[0:2])>>4&0xff), int(ip[7])
+		src, dst = netip.AddrFrom16([16]byte(ip[8:24])), netip.AddrFrom16([16]byte(ip[24:40]))
+		tcp = ip[40:]
+	default:
+		return syn
+	}
+
+	if len(tcp) < 20 {
+		return syn
+	}
+	off := int(tcp[12]>>4) * 4
+	if off < 20 || len(tcp) < off {
+		return syn
+	}
+	syn.Src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(tcp[0:2])).String()
+	syn.Dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(tcp[2:4])).String()
+	syn.Seq = binary.BigEndian.Uint32(tcp[4:8])
+	syn.Window = int(binary.BigEndian.Uint16(tcp[14:16]))
+	if tcp[12]&1 != 0 {
+		syn.Flags = append(syn.Flags, "AE")
+	}
+	for i, name := range tcpFlagNames {
+		if tcp[13]&(0x80>>i) != 0 {
+			syn.Flags = append(syn.Flags, name)
+		}
+	}
+	syn.Options = decodeTCPOptions(tcp[20:off])
+	return syn
+}
+
+// decodeTCPOptions renders the options of a TCP header in tcpdump's style.
+func decodeTCPOptions(b []byte) []string {
+	opts := []string{}
+	for len(b) > 0 {
+		kind := b[0]
+		if kind == 0 {
+			opts = append(opts, "eol")
+			break
+		}
+		if kind == 1 {
+			opts = append(opts, "nop")
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || int(b[1]) < 2 || int(b[1]) > len(b) {
+			opts = append(opts, fmt.Sprintf("bad opt %d", kind))
+			break
+		}
+		data := b[2:b[1]]
+		b = b[b[1]:]
+		switch {
+		case kind == 2 && len(data) == 2:
+			opts = append(opts, fmt.Sprintf("mss %d", binary.BigEndian.Uint16(data)))
+		case kind == 3 && len(data) == 1:
+			opts = append(opts, fmt.Sprintf("wscale %d", data[0]))
+		case kind == 4 && len(data) == 0:
+			opts = append(opts, "sackOK")
+		case kind == 8 && len(data) == 8:
+			opts = append(opts, fmt.Sprintf("TS val %d ecr %d",
+				binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])))
+		case kind == 34:
+			opts = append(opts, "tfo "+Bytes(data).String())
+		case kind == 30:
+			opts = append(opts, "mptcp")
+		case kind == 19:
+			opts = append(opts, "md5")
+		case kind == 29:
+			opts = append(opts, "tcp-ao")
+		default:
+			opts = append(opts, fmt.Sprintf("opt-%d %s", kind, Bytes(data)))
+		}
+	}
+	return opts
+}
+
+// ZeroCopyStatus is what TCP_ZEROCOPY_RECEIVE reports for a request that
+// maps no pages: the bytes in the receive queue and the leading bytes that
+// must be read with recv before pages can be mapped. Err is the pending
+// socket error, which the call clears.
+type ZeroCopyStatus struct {
+	Inq          int `json:"inq" yaml:"inq"`
+	RecvSkipHint int `json:"recv_skip_hint" yaml:"recv_skip_hint"`
+	Err          int `json:"err" yaml:"err"`
+}
+
+func (z ZeroCopyStatus) String() string {
+	s := fmt.Sprintf("inq %s, recv_skip_hint %s", formatSize(z.Inq), formatSize(z.RecvSkipHint))
+	if z.Err != 0 {
+		s += ", err " + OptionsMap["SO_ERROR"].Format(z.Err)
+	}
+	return s
+}
+
+// zeroCopyType describes TCP_ZEROCOPY_RECEIVE. The buffer is a zeroed struct
+// tcp_zerocopy_receive up to err, so nothing is mapped or copied. Without an
+// address to map pages to, the kernel only answers while less than a page is
+// queued; before 5.11 it always looked for a mapping and failed with EINVAL.
+var zeroCopyType = &StructType{
+	Size:   24,
+	Decode: decodeZeroCopy,
+	get: func(so SocketOption, c conn) (any, error) {
+		b, err := getsockoptBytes(c, so.Level, so.Option, 24)
+		if errors.Is(err, unix.EINVAL) {
+			return nil, fmt.Errorf("%w: a page or more is queued, which TCP_ZEROCOPY_RECEIVE only reports by mapping it", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return decodeZeroCopy(b)
+	},
+}
+
+func decodeZeroCopy(b []byte) (any, error) {
+	if len(b) < 24 {
+		return nil, fmt.Errorf("short tcp_zerocopy_receive of %d bytes", len(b))
+	}
+	return ZeroCopyStatus{
+		RecvSkipHint: int(binary.NativeEndian.Uint32(b[12:16])),
+		Inq:          int(binary.NativeEndian.Uint32(b[16:20])),
+		Err:          int(int32(binary.NativeEndian.Uint32(b[20:24]))),
+	}, nil
+}
@@ -0,0 +1,314 @@
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// ErrUnknownOption is returned for option names missing from OptionsMap.
+	ErrUnknownOption = errors.New("unsupported socket option")
+	// ErrNotApplicable is returned when an option does not apply to the
+	// socket's type and protocol.
+	ErrNotApplicable = errors.New("option does not apply to socket")
+	// ErrInvalidValue is returned when a value cannot be parsed or is out of
+	// the option's range.
+	ErrInvalidValue = errors.New("invalid option value")
+	// ErrSocketHandleClosed is returned by the methods of a closed Socket.
+	ErrSocketHandleClosed = errors.New("socket handle is closed")
+	// ErrUnsupported is returned for options the running kernel is too old
+	// for or does not implement.
+	ErrUnsupported = errors.New("option not supported by kernel")
+	// ErrForbidden is returned when sox lacks the privileges an option
+	// requires.
+	ErrForbidden = errors.New("operation not permitted")
+	// ErrWriteOnly is returned when reading an option that can only be set.
+	ErrWriteOnly = errors.New("option is write-only")
+	// ErrReadOnly is returned when setting an option that can only be read.
+	ErrReadOnly = errors.New("option is read-only")
+)
+
+// Socket is a handle to a socket of another process. Usually it holds a
+// duplicate of the process's descriptor, which keeps the socket alive until
+// Close. With the ptrace backend the calls are made inside the process
+// instead, see Access.
+type Socket struct {
+	fd       int
+	conn     conn
+	sockType int
+	protocol int
+	domain   int
+	kindErr  error
+}
+
+// Change records the value of an option before and after Socket.Update.
+type Change struct {
+	Option string
+	Old    any
+	New    any
+}
+
+// Open returns a handle to descriptor fd of process pid using the backend
+// selected by Access.
+func Open(pid, fd int) (*Socket, error) {
+	switch Access {
+	case AccessPidfd, AccessAuto:
+		socketFd, err := GetSocketFd(pid, fd)
+		if err == nil {
+			return NewSocket(socketFd), nil
+		}
+		if Access == AccessPidfd || !errors.Is(err, unix.ENOSYS) {
+			return nil, err
+		}
+	case AccessPtrace:
+	default:
+		return nil, fmt.Errorf("unknown access %q, expected pidfd or ptrace", Access)
+	}
+
+	c, err := openPtrace(pid, fd)
+	if err != nil {
+		return nil, err
+	}
+	return newSocket(-1, c), nil
+}
+
+// NewSocket wraps a socket descriptor owned by the caller. Close closes it.
+func NewSocket(fd int) *Socket {
+	return newSocket(fd, fdConn(fd))
+}
+
+func newSocket(fd int, c conn) *Socket {
+	s := &Socket{fd: fd, conn: c}
+	s.sockType, s.protocol, s.domain, s.kindErr = socketKind(c)
+	return s
+}
+
+// Fd returns the duplicated descriptor. It is valid until Close and -1 for
+// sockets accessed with ptrace.
+func (s *Socket) Fd() int {
+	return s.fd
+}
+
+// Kind returns the SO_TYPE and SO_PROTOCOL of the socket.
+func (s *Socket) Kind() (sockType, protocol int, err error) {
+	return s.sockType, s.protocol, s.kindErr
+}
+
+// Domain returns the SO_DOMAIN address family of the socket.
+func (s *Socket) Domain() (int, error) {
+	return s.domain, s.kindErr
+}
+
+// Name returns the local address of the socket, see GetSocketName.
+func (s *Socket) Name() string {
+	if s.conn == nil {
+		return ""
+	}
+	return s.conn.name()
+}
+
+// PeerName returns the remote address of a connected IPv4 or IPv6 socket,
+// formatted like Name, or an empty string.
+func (s *Socket) PeerName() string {
+	if s.conn == nil {
+		return ""
+	}
+	// SO_PEERNAME refuses buffers larger than the address
+	size := unix.SizeofSockaddrInet4
+	if s.domain == unix.AF_INET6 {
+		size = unix.SizeofSockaddrInet6
+	}
+	peer, err := getsockoptBytes(s.conn, unix.SOL_SOCKET, unix.SO_PEERNAME, size)
+	if err != nil {
+		return ""
+	}
+	return rawSockaddrName(peer)
+}
+
+// Option looks up an option by name and checks that it applies to the
+// socket. An IP option that only exists for the other address family is
+// replaced by its Variant, so IP_TOS returns IPV6_TCLASS on an IPv6 socket.
+// Sockets whose kind cannot be determined are not checked.
+func (s *Socket) Option(name string) (SocketOption, error) {
+	so, ok := OptionsMap[name]
+	if !ok {
+		return SocketOption{}, fmt.Errorf("%w %s", ErrUnknownOption, name)
+	}
+	if s.applies(so) {
+		return so, nil
+	}
+	if v, ok := OptionsMap[so.Variant]; ok && s.applies(v) {
+		return v, nil
+	}
+	return SocketOption{}, fmt.Errorf("%w: %s does not apply to %s %s sockets",
+		ErrNotApplicable, name, DomainName(s.domain), KindName(s.sockType, s.protocol))
+}
+
+// applies reports whether so applies to the socket as it is, without
+// substituting a variant.
+func (s *Socket) applies(so SocketOption) bool {
+	return s.kindErr != nil || so.AppliesTo(s.sockType, s.protocol) && so.AppliesToDomain(s.domain)
+}
+
+// Get returns the typed value of an option, see ValueKind.
+func (s *Socket) Get(name string) (any, error) {
+	if s.conn == nil {
+		return nil, ErrSocketHandleClosed
+	}
+	so, err := s.Option(name)
+	if err != nil {
+		return nil, err
+	}
+	if so.WriteOnly {
+		return nil, fmt.Errorf("%w: %s cannot be read back", ErrWriteOnly, name)
+	}
+	if err := so.supported(); err != nil {
+		return nil, err
+	}
+	val, err := so.get(s.conn)
+	if err != nil {
+		return nil, so.classify(err)
+	}
+	return val, nil
+}
+
+// Set changes an option. The value is either of the option's kind or a
+// string, which is parsed like command line input. Options the running
+// kernel is too old for or that need capabilities sox does not have are
+// refused before setsockopt is called.
+func (s *Socket) Set(name string, value any) error {
+	if s.conn == nil {
+		return ErrSocketHandleClosed
+	}
+	so, err := s.Option(name)
+	if err != nil {
+		return err
+	}
+	if !so.Writable() {
+		return fmt.Errorf("%w: %s", ErrReadOnly, name)
+	}
+	if str, ok := value.(string); ok {
+		if value, err = so.Parse(str); err != nil {
+			return err
+		}
+	}
+	if err := so.supported(); err != nil {
+		return err
+	}
+	if err := so.permitted(); err != nil {
+		return err
+	}
+	if err := so.set(s.conn, value); err != nil {
+		return so.classify(err)
+	}
+	return nil
+}
+
+// Update sets an option like Set and returns its value before and after the
+// change. Write-only options are read back with their ReadAs option; both
+// values are nil for those without one.
+func (s *Socket) Update(name string, value any) (Change, error) {
+	read := name
+	if so, ok := OptionsMap[name]; ok && so.WriteOnly {
+		if so.ReadAs == "" {
+			return Change{Option: name}, s.Set(name, value)
+		}
+		read = so.ReadAs
+	}
+	var change Change
+	err := s.session(func() error {
+		old, err := s.Get(read)
+		if err != nil {
+			return err
+		}
+		if err := s.Set(name, value); err != nil {
+			return err
+		}
+		val, err := s.Get(read)
+		if err != nil {
+			return fmt.Errorf("unable to get socket option %s after value was set: %w", name, err)
+		}
+		change = Change{Option: name, Old: old, New: val}
+		return nil
+	})
+	return change, err
+}
+
+// List returns the values of all options that apply to the socket in the
+// order of OptionsList. Options that cannot be read have no value and their
+// Status and Error explain why: the kernel does not support them, sox lacks
+// privileges, they are write-only, or they are unavailable in the socket's
+// current state.
+func (s *Socket) List() ([]OptionRow, error) {
+	if s.conn == nil {
+		return nil, ErrSocketHandleClosed
+	}
+
+	rows := []OptionRow{}
+	err := s.session(func() error {
+		rows = s.list()
+		return nil
+	})
+	return rows, err
+}
+
+func (s *Socket) list() []OptionRow {
+	rows := []OptionRow{}
+	for _, name := range OptionsList {
+		so := OptionsMap[name]
+		if !s.applies(so) {
+			continue
+		}
+		row := OptionRow{Name: so.Name, Description: so.Description}
+		if so.ClearedOnRead {
+			row.Status = StatusNotRead
+			rows = append(rows, row)
+			continue
+		}
+		switch val, err := s.Get(name); {
+		case errors.Is(err, ErrWriteOnly):
+			row.Status = StatusWriteOnly
+		case errors.Is(err, ErrUnsupported):
+			row.Status, row.Error = StatusUnsupported, err.Error()
+		case errors.Is(err, ErrForbidden):
+			row.Status, row.Error = StatusForbidden, err.Error()
+		case err != nil:
+			row.Status, row.Error = StatusUnavailable, err.Error()
+		default:
+			row.Value = val
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Shutdown calls shutdown(2) with unix.SHUT_RD, SHUT_WR or SHUT_RDWR. Unlike
+// closing the duplicated descriptor it acts on the connection itself, so the
+// owning process sees EOF or EPIPE on its own descriptor.
+func (s *Socket) Shutdown(how int) error {
+	if s.conn == nil {
+		return ErrSocketHandleClosed
+	}
+	return s.conn.shutdown(how)
+}
+
+// session runs fn with the socket prepared for several calls. With ptrace the
+// process is stopped once instead of for every call.
+func (s *Socket) session(fn func() error) error {
+	if s.conn == nil {
+		return ErrSocketHandleClosed
+	}
+	return s.conn.session(fn)
+}
+
+// Close closes the duplicated descriptor.
+func (s *Socket) Close() error {
+	if s.conn == nil {
+		return ErrSocketHandleClosed
+	}
+	err := s.conn.close()
+	s.conn, s.fd = nil, -1
+	return err
+}
@@ -1,11 +1,24 @@
 package sockopt
 
 import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"os"
+	"os/exec"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // helper to get fd from net.Conn
@@ -74,7 +87,7 @@ func TestGetSocketName(t *testing.T) {
 	}
 }
 
-func TestSetAndGetSocketOptionWrappers(t *testing.T) {
+func TestSocketHandle(t *testing.T) {
 	c, cleanup := makeSocket(t)
 	defer cleanup()
 
@@ -83,8 +96,807 @@ func TestSetAndGetSocketOptionWrappers(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// ensure option can be set and read via wrappers
-	SetSocketOption(os.Getpid(), fd, "TCP_NODELAY", 1, "table")
-	GetSocketOption(os.Getpid(), fd, "TCP_NODELAY", "table")
-	ListSocketOptions(os.Getpid(), fd, "table")
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set("TCP_NODELAY", true); err != nil {
+		t.Fatal(err)
+	}
+	change, err := s.Update("TCP_NODELAY", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != (Change{Option: "TCP_NODELAY", Old: true, New: false}) {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if v, err := s.Get("TCP_NODELAY"); err != nil || v != false {
+		t.Fatalf("unexpected value %v, %v", v, err)
+	}
+	if s.Name() != c.LocalAddr().String() {
+		t.Fatalf("unexpected name %s", s.Name())
+	}
+
+	rows, err := s.List()
+	if err != nil || len(rows) == 0 {
+		t.Fatalf("no options listed: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, r := range rows {
+		statuses[r.Name] = r.Status
+	}
+	if statuses["TCP_REPAIR_OPTIONS"] != StatusWriteOnly {
+		t.Errorf("TCP_REPAIR_OPTIONS: got status %q", statuses["TCP_REPAIR_OPTIONS"])
+	}
+	// TCP_REPAIR_QUEUE cannot be read outside repair mode
+	if statuses["TCP_REPAIR_QUEUE"] != StatusUnavailable {
+		t.Errorf("TCP_REPAIR_QUEUE: got status %q", statuses["TCP_REPAIR_QUEUE"])
+	}
+	if statuses["TCP_NODELAY"] != "" {
+		t.Errorf("TCP_NODELAY: got status %q", statuses["TCP_NODELAY"])
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value any
+		want  error
+	}{
+		{"TCP_NOPE", 1, ErrUnknownOption},
+		{"UDP_CORK", true, ErrNotApplicable},
+		{"TCP_KEEPIDLE", "soon", ErrInvalidValue},
+		{"TCP_KEEPIDLE", 0, ErrInvalidValue},
+		{"SO_RCVTIMEO", 5, ErrInvalidValue},
+	} {
+		if err := s.Set(tc.name, tc.value); !errors.Is(err, tc.want) {
+			t.Errorf("Set(%s, %v): got %v, want %v", tc.name, tc.value, err, tc.want)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("TCP_NODELAY"); !errors.Is(err, ErrSocketHandleClosed) {
+		t.Fatalf("expected ErrSocketHandleClosed, got %v", err)
+	}
+}
+
+func TestSocketLevelOptions(t *testing.T) {
+	c, cleanup := makeSocket(t)
+	defer cleanup()
+	fd, err := fdFromConn2(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	change, err := s.Update("SO_RCVBUF", "16KiB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	so := OptionsMap["SO_RCVBUF"]
+	if change.New != 32<<10 || so.Requested(change.New) != 16<<10 {
+		t.Fatalf("unexpected buffer size %v", change.New)
+	}
+	if note := so.BufferNote(16<<10, change.New); !strings.Contains(note, "twice") {
+		t.Fatalf("unexpected note %q", note)
+	}
+
+	for name, want := range map[string]string{"SO_TYPE": "stream", "SO_PROTOCOL": "tcp", "SO_DOMAIN": "inet", "SO_ACCEPTCONN": "false"} {
+		v, err := s.Get(name)
+		if err != nil || OptionsMap[name].Format(v) != want {
+			t.Errorf("%s: got %v, %v, want %s", name, v, err, want)
+		}
+		if err := s.Set(name, "1"); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+
+	rows, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if r.Name == "SO_ERROR" && r.Status != StatusNotRead {
+			t.Fatalf("SO_ERROR was read by List: %+v", r)
+		}
+	}
+	if v, err := s.Get("SO_ERROR"); err != nil || OptionsMap["SO_ERROR"].Format(v) != "none" {
+		t.Fatalf("unexpected SO_ERROR %v, %v", v, err)
+	}
+	if got := OptionsMap["SO_ERROR"].Format(int(unix.ECONNREFUSED)); got != "ECONNREFUSED (connection refused)" {
+		t.Fatalf("unexpected SO_ERROR format %q", got)
+	}
+}
+
+func TestGetSocketNameIPv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback unavailable")
+	}
+	defer l.Close()
+
+	c, err := net.Dial("tcp6", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fd, err := fdFromConn2(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := GetSocketName(fd); name != c.LocalAddr().String() {
+		t.Fatalf("got %s want %s", name, c.LocalAddr())
+	}
+}
+
+func TestIPOptionVariants(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		addr := "127.0.0.1:0"
+		if network == "tcp6" {
+			addr = "[::1]:0"
+		}
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			t.Skipf("%s loopback unavailable", network)
+		}
+		defer l.Close()
+		c, err := net.Dial(network, l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		fd, err := fdFromConn2(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := Open(os.Getpid(), fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		// Read the MTU first: setting the traffic class drops the cached
+		// route it comes from until the next send.
+		if v, err := s.Get("IP_MTU"); err != nil || v.(int) < 1280 {
+			t.Fatalf("%s: unexpected MTU %v, %v", network, v, err)
+		}
+
+		// IP_TOS and IPV6_TCLASS name the same option on either family.
+		for _, name := range []string{"IP_TOS", "IPV6_TCLASS"} {
+			change, err := s.Update(name, "AF41")
+			if err != nil || change.New != 0x88 {
+				t.Fatalf("%s %s: got %+v, %v", network, name, change, err)
+			}
+		}
+		so, err := s.Option("IP_TTL")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]string{"tcp4": "IP_TTL", "tcp6": "IPV6_UNICAST_HOPS"}[network]; so.Name != want {
+			t.Fatalf("%s: IP_TTL resolved to %s, want %s", network, so.Name, want)
+		}
+
+		_, err = s.Get("IPV6_V6ONLY")
+		if (network == "tcp4") != errors.Is(err, ErrNotApplicable) {
+			t.Fatalf("%s: IPV6_V6ONLY: %v", network, err)
+		}
+		rows, err := s.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rows {
+			if so := OptionsMap[r.Name]; so.Domains != nil && !so.AppliesToDomain(map[string]int{"tcp4": unix.AF_INET, "tcp6": unix.AF_INET6}[network]) {
+				t.Errorf("%s: List includes %s", network, r.Name)
+			}
+		}
+	}
+}
+
+func TestSavedSYN(t *testing.T) {
+	lc := net.ListenConfig{Control: func(network, address string, rc syscall.RawConn) error {
+		var err error
+		rc.Control(func(fd uintptr) {
+			err = OptionsMap["TCP_SAVE_SYN"].Set(int(fd), 1)
+		})
+		return err
+	}}
+	l, err := lc.Listen(context.Background(), "tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("TCP_SAVE_SYN unavailable: %v", err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	fd, err := fdFromConn2(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	v, err := s.Get("TCP_SAVED_SYN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syn := v.(SavedSYN)
+	if syn.Src != c.LocalAddr().String() || syn.Dst != l.Addr().String() || !slices.Contains(syn.Flags, "SYN") ||
+		!slices.ContainsFunc(syn.Options, func(o string) bool { return strings.HasPrefix(o, "mss ") }) {
+		t.Fatalf("unexpected saved SYN %v", syn)
+	}
+	if v, err := s.Get("TCP_SAVED_SYN"); err != nil || v.(SavedSYN).String() != "none" {
+		t.Fatalf("saved SYN not discarded: %v, %v", v, err)
+	}
+	if err := s.Set("TCP_SAVED_SYN", "00"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := OptionsMap["TCP_ZEROCOPY_RECEIVE"].supported(); err != nil {
+		if _, err := s.Get("TCP_ZEROCOPY_RECEIVE"); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("expected ErrUnsupported, got %v", err)
+		}
+		return
+	}
+	if v, err := s.Get("TCP_ZEROCOPY_RECEIVE"); err != nil || v.(ZeroCopyStatus).Inq != 5 {
+		t.Fatalf("unexpected zerocopy status %v, %v", v, err)
+	}
+	// the status is only reported while less than a page is queued
+	if _, err := c.Write(make([]byte, 2*os.Getpagesize())); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := s.Get("TCP_ZEROCOPY_RECEIVE"); !errors.Is(err, unix.EINVAL) || !strings.Contains(err.Error(), "page or more") {
+		t.Fatalf("expected explained EINVAL, got %v", err)
+	}
+}
+
+func TestDecodeSavedSYNWithMAC(t *testing.T) {
+	mac := make([]byte, 14)
+	mac[12], mac[13] = 0x86, 0xdd
+	ip6 := make([]byte, 40)
+	ip6[0], ip6[1], ip6[6], ip6[7] = 0x6b, 0x80, 6, 64
+	ip6[23], ip6[39] = 1, 2
+	tcp := []byte{0x9c, 0x40, 0, 80, 0, 0, 0, 1, 0, 0, 0, 0, 0x60, 0xc2, 0xff, 0xff, 0, 0, 0, 0,
+		2, 4, 0x05, 0xa0}
+	syn := DecodeSavedSYN(append(append(mac, ip6...), tcp...))
+	want := "[::1]:40000 > [::2]:80 ttl 64 tos 0xb8 (EF) flags CWR,ECE,SYN seq 1 win 65535 options mss 1440"
+	if got := syn.String(); got != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	if got := DecodeSavedSYN([]byte{1, 2, 3}).String(); got != "undecoded 010203" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestCCInfo(t *testing.T) {
+	c, cleanup := makeSocket(t)
+	defer cleanup()
+	fd, err := fdFromConn2(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Set("TCP_CONGESTION", "cubic"); err != nil {
+		t.Skipf("cubic unavailable: %v", err)
+	}
+	if v, err := s.Get("TCP_CC_INFO"); err != nil || v.(CCInfo).String() != "cubic" {
+		t.Fatalf("unexpected cubic info %v, %v", v, err)
+	}
+	if err := s.Set("TCP_CONGESTION", "bbr"); err != nil {
+		t.Skipf("bbr unavailable: %v", err)
+	}
+	v, err := s.Get("TCP_CC_INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range v.(CCInfo).Fields {
+		names = append(names, f.Name)
+	}
+	if want := []string{"bw", "min_rtt", "pacing_gain", "cwnd_gain"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got fields %v, want %v", names, want)
+	}
+}
+
+func TestDecodeCCInfo(t *testing.T) {
+	le := binary.NativeEndian
+	dctcp := le.AppendUint16(le.AppendUint16(nil, 1), 0)
+	dctcp = le.AppendUint32(le.AppendUint32(le.AppendUint32(dctcp, 512), 3000), 64<<10)
+	info := DecodeCCInfo("dctcp", dctcp)
+	if got, want := info.String(), "dctcp enabled=1 ce_state=0 alpha=0.500 ab_ecn=2.9 KiB ab_tot=64.0 KiB"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	b, err := json.Marshal(info)
+	if err != nil || string(b) != `{"algorithm":"dctcp","enabled":1,"ce_state":0,"alpha":512,"ab_ecn":3000,"ab_tot":65536}` {
+		t.Fatalf("unexpected JSON %s, %v", b, err)
+	}
+
+	bbr := le.AppendUint32(le.AppendUint32(nil, 1250000), 0)
+	bbr = le.AppendUint32(le.AppendUint32(le.AppendUint32(bbr, 1500), 739), 512)
+	if got, want := DecodeCCInfo("bbr", bbr).String(), "bbr bw=10 Mbit/s min_rtt=1.5ms pacing_gain=2.89 cwnd_gain=2"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := DecodeCCInfo("vegas", le.AppendUint32(le.AppendUint32(le.AppendUint32(le.AppendUint32(nil, 1), 4), 900), 800)).String(); got != "vegas enabled=1 rttcnt=4 rtt=900µs minrtt=800µs" {
+		t.Fatalf("unexpected vegas info %q", got)
+	}
+	if got := DecodeCCInfo("hybla", []byte{1, 2}).String(); got != "hybla raw=0102" {
+		t.Fatalf("unexpected raw info %q", got)
+	}
+}
+
+func TestQueues(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	raw, err := l.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lfd int
+	raw.Control(func(fd uintptr) { lfd = int(fd) })
+	ls, err := Open(os.Getpid(), lfd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+	// the handshake completes in the kernel before accept is called
+	time.Sleep(50 * time.Millisecond)
+	q, err := ls.Queues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.AcceptQueue == nil || *q.AcceptQueue != 1 || q.AcceptBacklog == nil || *q.AcceptBacklog < 1 || q.Inq != nil {
+		t.Fatalf("unexpected listener queues %+v", q)
+	}
+
+	a, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	fd, err := fdFromConn2(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	q, err = s.Queues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Inq == nil || *q.Inq != 5 || q.OutqNSD == nil || q.AcceptQueue != nil || q.MemInfo == nil || q.MemInfo.RmemAlloc == 0 {
+		t.Fatalf("unexpected queues %+v", q)
+	}
+	if f := q.Fields(); f[0].Name != "inq" || f[0].FormatValue() != "5 B" {
+		t.Fatalf("unexpected fields %+v", f)
+	}
+}
+
+func TestCheckpointTCP(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	fd, err := fdFromConn2(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// without stop the connection carries on
+	if _, err := s.CheckpointTCP(false); errors.Is(err, ErrForbidden) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get("SO_REUSEADDR"); err != nil || v != true {
+		t.Fatalf("SO_REUSEADDR not kept: %v %v", v, err)
+	}
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cp, err := s.CheckpointTCP(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cp.RecvQueue) != "hello" || len(cp.SendQueue) != 0 || cp.Local != a.LocalAddr().String() ||
+		cp.Remote != c.LocalAddr().String() || cp.Options.MSS == 0 || cp.Window == nil {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+	b, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded TCPCheckpoint
+	if err := json.Unmarshal(b, &loaded); err != nil || !reflect.DeepEqual(loaded, cp) {
+		t.Fatalf("checkpoint does not survive JSON: %+v %v", loaded, err)
+	}
+
+	// in repair mode the original socket closes without FIN or RST
+	s.Close()
+	a.Close()
+	r, err := RestoreTCP(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	buf := make([]byte, 16)
+	unix.SetsockoptTimeval(r.Fd(), unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 5})
+	if n, err := unix.Read(r.Fd(), buf); err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("restored receive queue: %q %v", buf[:n], err)
+	}
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := unix.Read(r.Fd(), buf); err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("read on restored connection: %q %v", buf[:n], err)
+	}
+	if _, err := unix.Write(r.Fd(), []byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Fatalf("peer read from restored connection: %q %v", buf[:n], err)
+	}
+
+	if _, err := RestoreTCP(TCPCheckpoint{Local: "bad"}); err == nil {
+		t.Fatal("expected error for invalid checkpoint")
+	}
+}
+
+func TestRepairValues(t *testing.T) {
+	so := OptionsMap["TCP_REPAIR_OPTIONS"]
+	v, err := so.Parse("mss=1460,wscale=7/9,sack,ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RepairOptions{MSS: 1460, WindowScaling: true, SndWscale: 7, RcvWscale: 9, SACK: true, Timestamps: true}
+	if v != want || so.Format(v) != "mss=1460,wscale=7/9,sack,ts" {
+		t.Fatalf("got %+v %q", v, so.Format(v))
+	}
+	b, _ := so.Struct.Encode(v)
+	if len(b) != 32 || binary.NativeEndian.Uint32(b[8:]) != unix.TCPOPT_WINDOW || binary.NativeEndian.Uint32(b[12:]) != 7|9<<16 {
+		t.Fatalf("unexpected tcp_repair_opt array %x", b)
+	}
+	if _, err := so.Parse("mss=1460,bogus"); err == nil {
+		t.Fatal("expected error for unknown repair option")
+	}
+
+	so = OptionsMap["TCP_REPAIR_WINDOW"]
+	w := RepairWindow{SndWl1: 1, SndWnd: 2, MaxWindow: 3, RcvWnd: 4, RcvWup: 5}
+	if v, err := so.Parse(w.String()); err != nil || v != w {
+		t.Fatalf("window round trip: %+v %v", v, err)
+	}
+	b, _ = so.Struct.Encode(w)
+	if v, err := so.Struct.Decode(b); err != nil || v != w {
+		t.Fatalf("window encoding: %+v %v", v, err)
+	}
+	if _, err := so.Parse("snd_wl1=1"); err == nil {
+		t.Fatal("expected error for incomplete window")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	c, cleanup := makeSocket(t)
+	defer cleanup()
+	fd, err := fdFromConn2(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWatcher(os.Getpid(), fd, []string{"NO_SUCH_OPTION"}); err == nil {
+		t.Fatal("expected error for unknown name")
+	}
+
+	w, err := NewWatcher(os.Getpid(), fd, []string{"TCP_NODELAY", "bytes_acked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	first, err := w.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Values) != 2 || first.Values[1].Delta != nil {
+		t.Fatalf("unexpected first sample %+v", first.Values)
+	}
+
+	if _, err := c.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	second, err := w.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	acked := second.Values[1]
+	if !acked.Changed || acked.Delta == nil || *acked.Delta != 1000 || acked.DeltaString() != "+1000 B" {
+		t.Fatalf("unexpected bytes_acked %+v", acked)
+	}
+	if second.Values[0].Changed {
+		t.Fatal("TCP_NODELAY reported as changed")
+	}
+
+	c.Close()
+	if _, err := w.Sample(); !errors.Is(err, ErrSocketClosed) {
+		t.Fatalf("expected ErrSocketClosed, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := []OptionRow{
+		{Name: "SO_LINGER", Value: Linger{OnOff: true, Linger: 5}},
+		{Name: "TCP_KEEPIDLE", Value: 30},
+		{Name: "TCP_NODELAY", Value: true},
+		{Name: "TCP_TIMESTAMP", Value: uint32(1)},
+	}
+	b, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ParseRows(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(old, saved, true); len(d) != 0 {
+		t.Fatalf("saved rows differ from original: %+v", d)
+	}
+
+	new := []OptionRow{
+		{Name: "SO_LINGER", Value: Linger{}},
+		{Name: "TCP_KEEPIDLE", Value: 30},
+		{Name: "TCP_TIMESTAMP", Value: uint32(2)},
+		{Name: "UDP_CORK", Value: false},
+	}
+	got := Diff(saved, new, false)
+	want := []OptionDiff{
+		{Name: "SO_LINGER", Old: Linger{OnOff: true, Linger: 5}, New: Linger{}},
+		{Name: "TCP_NODELAY", Old: true},
+		{Name: "UDP_CORK", New: false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := Diff(saved, new, true); len(got) != 4 || got[2].Name != "TCP_TIMESTAMP" {
+		t.Fatalf("volatile option not compared: %+v", got)
+	}
+
+	if _, err := ParseRows([]byte(`[{"name": "TCP_KEEPIDLE", "value": "x"}]`)); err == nil {
+		t.Fatal("expected error for invalid value")
+	}
+}
+
+func TestParseKernelVersion(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want KernelVersion
+	}{
+		{"6.1.0-18-amd64", KernelVersion{6, 1, 0}},
+		{"5.15.153.1-microsoft-standard-WSL2", KernelVersion{5, 15, 153}},
+		{"3.5", KernelVersion{3, 5, 0}},
+		{"4.18rc1", KernelVersion{4, 18, 0}},
+		{"2.6.37", KernelVersion{2, 6, 37}},
+	} {
+		got, err := ParseKernelVersion(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseKernelVersion(%q) = %v, %v; want %v", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", "linux", ".5"} {
+		if _, err := ParseKernelVersion(in); err == nil {
+			t.Errorf("ParseKernelVersion(%q): expected error", in)
+		}
+	}
+
+	if !(KernelVersion{4, 18, 0}).Less(KernelVersion{5, 0, 0}) ||
+		!(KernelVersion{2, 6, 20}).Less(KernelVersion{2, 6, 37}) ||
+		(KernelVersion{3, 5, 0}).Less(KernelVersion{3, 5, 0}) {
+		t.Fatal("unexpected ordering")
+	}
+}
+
+func TestKernelMetadata(t *testing.T) {
+	for _, name := range OptionsList {
+		so := OptionsMap[name]
+		if so.MinKernel == "" {
+			continue
+		}
+		if _, err := ParseKernelVersion(so.MinKernel); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	c, cleanup := makeSocket(t)
+	defer cleanup()
+	fd, err := fdFromConn2(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(os.Getpid(), fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	so := OptionsMap["TCP_NODELAY"]
+	defer func() { OptionsMap["TCP_NODELAY"] = so }()
+	future := so
+	future.MinKernel = "99.0"
+	OptionsMap["TCP_NODELAY"] = future
+
+	err = s.Set("TCP_NODELAY", true)
+	if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), "requires Linux 99.0 or later") {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+	if _, err := s.Get("TCP_NODELAY"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+// TestMain turns the test binary into a helper process holding a listener
+// when SOX_TEST_LISTENER is set, so that ptrace can attach to a process other
+// than the test itself.
+func TestMain(m *testing.M) {
+	if os.Getenv("SOX_TEST_LISTENER") != "" {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			os.Exit(1)
+		}
+		f, err := l.(*net.TCPListener).File()
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Println(f.Fd())
+		// keep a few threads busy in timed waits
+		for i := 0; i < 4; i++ {
+			go func() {
+				for {
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}
+		select {}
+	}
+	os.Exit(m.Run())
+}
+
+func TestPtraceAccess(t *testing.T) {
+	if !ptraceSupported {
+		t.Skip("ptrace access not supported on this architecture")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "SOX_TEST_LISTENER=1")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(a string) { Access = a }(Access)
+	Access = AccessPtrace
+	s, err := Open(cmd.Process.Pid, fd)
+	if errors.Is(err, unix.EPERM) {
+		t.Skipf("ptrace not permitted: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Fd() != -1 {
+		t.Errorf("unexpected fd %d", s.Fd())
+	}
+	if _, protocol, err := s.Kind(); err != nil || protocol != unix.IPPROTO_TCP {
+		t.Fatalf("unexpected kind %d, %v", protocol, err)
+	}
+	if !strings.HasPrefix(s.Name(), "127.0.0.1:") {
+		t.Errorf("unexpected name %q", s.Name())
+	}
+	change, err := s.Update("TCP_KEEPIDLE", 33)
+	if err != nil || change.New != 33 {
+		t.Fatalf("unexpected change %+v, %v", change, err)
+	}
+	if v, err := s.Get("TCP_CONGESTION"); err != nil || v == "" {
+		t.Fatalf("unexpected congestion control %v, %v", v, err)
+	}
+	rows, err := s.List()
+	if err != nil || len(rows) == 0 {
+		t.Fatalf("no options listed: %v", err)
+	}
+
+	// the value is visible through a duplicated descriptor, too
+	Access = AccessPidfd
+	d, err := Open(cmd.Process.Pid, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if v, err := d.Get("TCP_KEEPIDLE"); err != nil || v != 33 {
+		t.Fatalf("unexpected value %v, %v", v, err)
+	}
+
+	// the helper keeps running after the injected calls
+	time.Sleep(50 * time.Millisecond)
+	if err := cmd.Process.Signal(unix.Signal(0)); err != nil {
+		t.Fatalf("helper died: %v", err)
+	}
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(cmd.Process.Pid) + "/status")
+	if err != nil || !strings.Contains(string(b), "TracerPid:\t0") {
+		t.Fatalf("helper still traced: %v", err)
+	}
 }
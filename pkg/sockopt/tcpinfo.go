@@ -0,0 +1,301 @@
+package sockopt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TCPInfo mirrors struct tcp_info from linux/tcp.h. The layout matches the
+// kernel's, so fields beyond Length were not returned by the running kernel
+// and are left zero. The name tag is the kernel field name without the tcpi_
+// prefix and the unit tag selects how the field is rendered in tables.
+type TCPInfo struct {
+	State       uint8 `name:"state" unit:"state"`
+	CAState     uint8 `name:"ca_state" unit:"ca_state"`
+	Retransmits uint8 `name:"retransmits"`
+	Probes      uint8 `name:"probes"`
+	Backoff     uint8 `name:"backoff"`
+	Options     uint8 `name:"options" unit:"options"`
+	// WScale packs snd_wscale (low nibble) and rcv_wscale (high nibble).
+	WScale uint8 `name:"wscale"`
+	// Flags packs delivery_rate_app_limited (bit 0) and
+	// fastopen_client_fail (bits 1-2).
+	Flags uint8 `name:"flags"`
+
+	RTO    uint32 `name:"rto" unit:"us"`
+	ATO    uint32 `name:"ato" unit:"us"`
+	SndMSS uint32 `name:"snd_mss" unit:"size"`
+	RcvMSS uint32 `name:"rcv_mss" unit:"size"`
+
+	Unacked uint32 `name:"unacked"`
+	Sacked  uint32 `name:"sacked"`
+	Lost    uint32 `name:"lost"`
+	Retrans uint32 `name:"retrans"`
+	Fackets uint32 `name:"fackets"`
+
+	LastDataSent uint32 `name:"last_data_sent" unit:"ms"`
+	LastAckSent  uint32 `name:"last_ack_sent" unit:"ms"`
+	LastDataRecv uint32 `name:"last_data_recv" unit:"ms"`
+	LastAckRecv  uint32 `name:"last_ack_recv" unit:"ms"`
+
+	PMTU        uint32 `name:"pmtu" unit:"size"`
+	RcvSsthresh uint32 `name:"rcv_ssthresh" unit:"bytes"`
+	RTT         uint32 `name:"rtt" unit:"us"`
+	RTTVar      uint32 `name:"rttvar" unit:"us"`
+	SndSsthresh uint32 `name:"snd_ssthresh"`
+	SndCwnd     uint32 `name:"snd_cwnd"`
+	AdvMSS      uint32 `name:"advmss" unit:"size"`
+	Reordering  uint32 `name:"reordering"`
+
+	RcvRTT   uint32 `name:"rcv_rtt" unit:"us"`
+	RcvSpace uint32 `name:"rcv_space" unit:"bytes"`
+
+	TotalRetrans uint32 `name:"total_retrans"`
+
+	PacingRate    uint64 `name:"pacing_rate" unit:"rate"`
+	MaxPacingRate uint64 `name:"max_pacing_rate" unit:"rate"`
+	BytesAcked    uint64 `name:"bytes_acked" unit:"bytes"`
+	BytesReceived uint64 `name:"bytes_received" unit:"bytes"`
+	SegsOut       uint32 `name:"segs_out"`
+	SegsIn        uint32 `name:"segs_in"`
+
+	NotsentBytes uint32 `name:"notsent_bytes" unit:"bytes"`
+	MinRTT       uint32 `name:"min_rtt" unit:"us"`
+	DataSegsIn   uint32 `name:"data_segs_in"`
+	DataSegsOut  uint32 `name:"data_segs_out"`
+
+	DeliveryRate uint64 `name:"delivery_rate" unit:"rate"`
+
+	BusyTime      uint64 `name:"busy_time" unit:"us"`
+	RwndLimited   uint64 `name:"rwnd_limited" unit:"us"`
+	SndbufLimited uint64 `name:"sndbuf_limited" unit:"us"`
+
+	Delivered   uint32 `name:"delivered"`
+	DeliveredCE uint32 `name:"delivered_ce"`
+
+	BytesSent    uint64 `name:"bytes_sent" unit:"bytes"`
+	BytesRetrans uint64 `name:"bytes_retrans" unit:"bytes"`
+	DSACKDups    uint32 `name:"dsack_dups"`
+	ReordSeen    uint32 `name:"reord_seen"`
+
+	RcvOOOPack uint32 `name:"rcv_ooopack"`
+
+	SndWnd uint32 `name:"snd_wnd" unit:"bytes"`
+	RcvWnd uint32 `name:"rcv_wnd" unit:"bytes"`
+
+	Rehash uint32 `name:"rehash"`
+
+	TotalRTO           uint16 `name:"total_rto"`
+	TotalRTORecoveries uint16 `name:"total_rto_recoveries"`
+	TotalRTOTime       uint32 `name:"total_rto_time" unit:"ms"`
+
+	// Length is the number of bytes returned by the kernel.
+	Length int `name:"-"`
+}
+
+// sizeofTCPInfo is the size of the kernel struct mirrored by TCPInfo.
+var sizeofTCPInfo = int(unsafe.Offsetof(TCPInfo{}.Length))
+
+// TCPInfoField is a single decoded tcp_info or TCP_CC_INFO field.
+type TCPInfoField struct {
+	Name  string
+	Value uint64
+	Unit  string
+}
+
+// tcpInfoType describes TCP_INFO. The buffer is larger than the struct known
+// to sox so that newer kernels are not truncated by the kernel itself.
+var tcpInfoType = &StructType{
+	Size: 512,
+	Decode: func(b []byte) (any, error) {
+		return DecodeTCPInfo(b), nil
+	},
+}
+
+// DecodeTCPInfo decodes a tcp_info of any length. Fields not covered by b are
+// left zero and are not reported by Fields.
+func DecodeTCPInfo(b []byte) TCPInfo {
+	var ti TCPInfo
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&ti)), sizeofTCPInfo)
+	ti.Length = copy(raw, b)
+	return ti
+}
+
+// Fields returns the fields returned by the kernel in struct order. The
+// packed wscale and flags bytes are split into the kernel's bitfields.
+func (ti TCPInfo) Fields() []TCPInfoField {
+	v := reflect.ValueOf(ti)
+	t := v.Type()
+
+	var fields []TCPInfoField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("name")
+		if name == "-" || int(f.Offset+f.Type.Size()) > ti.Length {
+			continue
+		}
+		val := v.Field(i).Uint()
+
+		switch name {
+		case "wscale":
+			fields = append(fields,
+				TCPInfoField{Name: "snd_wscale", Value: val & 0x0f},
+				TCPInfoField{Name: "rcv_wscale", Value: val >> 4})
+		case "flags":
+			fields = append(fields,
+				TCPInfoField{Name: "delivery_rate_app_limited", Value: val & 0x01},
+				TCPInfoField{Name: "fastopen_client_fail", Value: (val >> 1) & 0x03})
+		default:
+			fields = append(fields, TCPInfoField{Name: name, Value: val, Unit: f.Tag.Get("unit")})
+		}
+	}
+	return fields
+}
+
+// String summarises the connection on a single line for list output.
+func (ti TCPInfo) String() string {
+	if ti.Length == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s rtt=%s cwnd=%d retrans=%d", tcpStateName(ti.State),
+		time.Duration(ti.RTT)*time.Microsecond, ti.SndCwnd, ti.TotalRetrans)
+}
+
+// MarshalJSON encodes the fields returned by the kernel as raw numbers in
+// struct order.
+func (ti TCPInfo) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range ti.Fields() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.Name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatUint(f.Value, 10))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalYAML encodes the fields returned by the kernel as raw numbers in
+// struct order.
+func (ti TCPInfo) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range ti.Fields() {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: f.Name},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatUint(f.Value, 10)})
+	}
+	return node, nil
+}
+
+// FormatValue renders a field with its unit for table output.
+func (f TCPInfoField) FormatValue() string {
+	switch f.Unit {
+	case "us":
+		return (time.Duration(f.Value) * time.Microsecond).String()
+	case "ms":
+		return (time.Duration(f.Value) * time.Millisecond).String()
+	case "size":
+		return strconv.FormatUint(f.Value, 10) + " B"
+	case "bytes":
+		return formatBytes(f.Value)
+	case "rate":
+		if f.Value == math.MaxUint64 {
+			return "unlimited"
+		}
+		return formatRate(f.Value)
+	case "state":
+		return tcpStateName(uint8(f.Value))
+	case "ca_state":
+		if int(f.Value) < len(caStates) {
+			return caStates[f.Value]
+		}
+	case "options":
+		return formatTCPIOptions(uint8(f.Value))
+	case "gain":
+		// BBR gains are fixed point with 8 fractional bits
+		return strconv.FormatFloat(float64(f.Value)/256, 'g', 3, 64)
+	case "alpha":
+		// DCTCP's alpha is a fraction of 1024
+		return strconv.FormatFloat(float64(f.Value)/1024, 'f', 3, 64)
+	}
+	return strconv.FormatUint(f.Value, 10)
+}
+
+var tcpStates = []string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+	12: "NEW_SYN_RECV",
+}
+
+func tcpStateName(state uint8) string {
+	if int(state) < len(tcpStates) && tcpStates[state] != "" {
+		return tcpStates[state]
+	}
+	return strconv.Itoa(int(state))
+}
+
+var caStates = []string{"Open", "Disorder", "CWR", "Recovery", "Loss"}
+
+// tcpiOptions lists the TCPI_OPT_* flags.
+var tcpiOptions = []string{"ts", "sack", "wscale", "ecn", "ecn_seen", "syn_data", "usec_ts"}
+
+func formatTCPIOptions(opts uint8) string {
+	var names []string
+	for i, name := range tcpiOptions {
+		if opts&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatRate renders a rate given in bytes per second as bits per second.
+func formatRate(bytesPerSec uint64) string {
+	bits := float64(bytesPerSec) * 8
+	for _, unit := range []string{"bit/s", "Kbit/s", "Mbit/s", "Gbit/s"} {
+		if bits < 1000 || unit == "Gbit/s" {
+			return fmt.Sprintf("%.4g %s", bits, unit)
+		}
+		bits /= 1000
+	}
+	return ""
+}
@@ -0,0 +1,303 @@
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Unit is the unit an integer option is measured in by the kernel. Values
+// are always stored in the native unit; the unit only affects how input is
+// parsed and values are formatted.
+type Unit int
+
+const (
+	// UnitNone is a plain count or number.
+	UnitNone Unit = iota
+	// UnitSeconds accepts durations such as 90s or 2h.
+	UnitSeconds
+	// UnitMilliseconds accepts durations such as 500ms or 30s.
+	UnitMilliseconds
+	// UnitBytes accepts sizes such as 64KiB or 4MiB.
+	UnitBytes
+	// UnitMicroseconds accepts durations such as 50us or 1ms.
+	UnitMicroseconds
+	// UnitRate is bytes per second and accepts rates such as 100mbit.
+	// Values are unsigned 32-bit ints in an int.
+	UnitRate
+	// UnitErrno is an errno value, shown by name. It is only read.
+	UnitErrno
+	// UnitTOS is a traffic class byte, shown and accepted as a DSCP name
+	// such as EF or AF41 with an optional ECN codepoint, e.g. AF41,ECT(0).
+	UnitTOS
+)
+
+var unitSizes = map[Unit]time.Duration{
+	UnitSeconds:      time.Second,
+	UnitMilliseconds: time.Millisecond,
+	UnitMicroseconds: time.Microsecond,
+}
+
+var unitNames = map[Unit]string{
+	UnitSeconds:      "seconds",
+	UnitMilliseconds: "milliseconds",
+	UnitMicroseconds: "microseconds",
+}
+
+// rateSuffixes are the accepted rate suffixes in bits per second, like tc.
+var rateSuffixes = []struct {
+	suffix string
+	factor float64
+}{
+	{"gbit", 1e9}, {"mbit", 1e6}, {"kbit", 1e3}, {"bit", 1},
+}
+
+// sizeSuffixes are the accepted size suffixes, matched case-insensitively.
+// K, M and G are binary like the kernel's memparse.
+var sizeSuffixes = []struct {
+	suffix string
+	factor int
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// syntax describes the input accepted for an integer option.
+func (so SocketOption) syntax() string {
+	var s string
+	switch so.Unit {
+	case UnitSeconds:
+		s = "seconds or a duration such as 90s or 2h"
+	case UnitMilliseconds:
+		s = "milliseconds or a duration such as 500ms or 30s"
+	case UnitMicroseconds:
+		s = "microseconds or a duration such as 50us or 1ms"
+	case UnitRate:
+		s = "bytes per second or a rate such as 100mbit or 1gbit"
+	case UnitBytes:
+		s = "bytes or a size such as 64KiB or 4MiB"
+	case UnitTOS:
+		s = "a number such as 0xb8 or a DSCP name such as EF, AF41 or CS1, optionally followed by ,ECT(0), ,ECT(1) or ,CE"
+	default:
+		s = "an integer"
+	}
+	if len(so.Names) > 0 {
+		s = strings.Join(so.names(), ", ") + " or " + s
+	}
+	return "expected " + s
+}
+
+// names returns the value names of the option in value order.
+func (so SocketOption) names() []string {
+	values := make([]int, 0, len(so.Names))
+	for v := range so.Names {
+		values = append(values, v)
+	}
+	slices.Sort(values)
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = so.Names[v]
+	}
+	return names
+}
+
+// parseInt converts input for an integer option: one of its names, a number
+// in the native unit or, for options with a unit, a duration or size.
+func (so SocketOption) parseInt(s string) (int, error) {
+	for v, name := range so.Names {
+		if strings.EqualFold(s, name) {
+			return v, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+
+	switch so.Unit {
+	case UnitSeconds, UnitMilliseconds, UnitMicroseconds:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			break
+		}
+		unit := unitSizes[so.Unit]
+		if d%unit != 0 {
+			return 0, fmt.Errorf("%s is not a whole number of %s", d, unitNames[so.Unit])
+		}
+		return int(d / unit), nil
+	case UnitBytes:
+		if n, ok := parseSize(s); ok {
+			return n, nil
+		}
+	case UnitRate:
+		if n, ok := parseRate(s); ok {
+			return n, nil
+		}
+	case UnitTOS:
+		if n, ok := parseTOS(s); ok {
+			return n, nil
+		}
+	}
+	return 0, errors.New(so.syntax())
+}
+
+// parseSize parses a number with an optional size suffix, e.g. 4MiB or 1.5M.
+func parseSize(s string) (int, bool) {
+	for _, ss := range sizeSuffixes {
+		if len(s) <= len(ss.suffix) || !strings.EqualFold(s[len(s)-len(ss.suffix):], ss.suffix) {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-len(ss.suffix)]), 64)
+		n := f * float64(ss.factor)
+		if err != nil || n < 0 || n > math.MaxInt32 || n != math.Trunc(n) {
+			return 0, false
+		}
+		return int(n), true
+	}
+	return 0, false
+}
+
+// parseRate parses a rate in bits per second with a suffix such as 100mbit
+// into bytes per second. Rates above 2^31-1 bytes per second are returned as
+// the negative int that getsockopt yields for them.
+func parseRate(s string) (int, bool) {
+	for _, rs := range rateSuffixes {
+		num, ok := strings.CutSuffix(strings.TrimSuffix(strings.ToLower(s), "/s"), rs.suffix)
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		n := f * rs.factor / 8
+		if err != nil || n < 0 || n > math.MaxUint32 || n != math.Trunc(n) {
+			return 0, false
+		}
+		return int(int32(uint32(n))), true
+	}
+	return 0, false
+}
+
+// formatInt renders an integer option value with its name or unit.
+func (so SocketOption) formatInt(n int) string {
+	if name, ok := so.Names[n]; ok {
+		return name
+	}
+	switch so.Unit {
+	case UnitSeconds, UnitMilliseconds, UnitMicroseconds:
+		return formatDuration(time.Duration(n) * unitSizes[so.Unit])
+	case UnitBytes:
+		return formatSize(n)
+	case UnitRate:
+		return formatRate(uint64(uint32(n)))
+	case UnitErrno:
+		return unix.ErrnoName(unix.Errno(n)) + " (" + unix.Errno(n).Error() + ")"
+	case UnitTOS:
+		return formatTOS(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// formatDuration drops the zero minutes and seconds time.Duration prints,
+// e.g. 2h instead of 2h0m0s.
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// formatSize renders sizes that are a whole number of KiB, MiB or GiB with
+// the suffix and other sizes as bytes.
+func formatSize(n int) string {
+	for _, ss := range []struct {
+		suffix string
+		factor int
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n != 0 && n%ss.factor == 0 {
+			return strconv.Itoa(n/ss.factor) + ss.suffix
+		}
+	}
+	return strconv.Itoa(n)
+}
+
+// dscpNames are the DSCP names of RFC 4594 and RFC 8622, indexed by the
+// upper six bits of the traffic class byte.
+var dscpNames = map[int]string{
+	0: "CS0", 8: "CS1", 16: "CS2", 24: "CS3", 32: "CS4", 40: "CS5", 48: "CS6", 56: "CS7",
+	10: "AF11", 12: "AF12", 14: "AF13",
+	18: "AF21", 20: "AF22", 22: "AF23",
+	26: "AF31", 28: "AF32", 30: "AF33",
+	34: "AF41", 36: "AF42", 38: "AF43",
+	44: "VA", 46: "EF", 1: "LE",
+}
+
+// ecnNames are the ECN codepoints of RFC 3168 in the lower two bits.
+var ecnNames = []string{"Not-ECT", "ECT(1)", "ECT(0)", "CE"}
+
+// formatTOS renders a traffic class byte as hex with its DSCP name and,
+// when set, its ECN codepoint, e.g. "0xb8 (EF)" or "0x8a (AF41, ECT(0))".
+func formatTOS(n int) string {
+	if n < 0 || n > 0xff {
+		return strconv.Itoa(n)
+	}
+	name, ok := dscpNames[n>>2]
+	if !ok {
+		name = "DSCP " + strconv.Itoa(n>>2)
+	}
+	if ecn := n & 3; ecn != 0 {
+		name += ", " + ecnNames[ecn]
+	}
+	return fmt.Sprintf("0x%02x (%s)", n, name)
+}
+
+// parseTOS parses a hexadecimal or octal traffic class byte, or a DSCP name
+// with an optional ECN codepoint after a comma.
+func parseTOS(s string) (int, bool) {
+	if n, err := strconv.ParseInt(s, 0, 0); err == nil {
+		return int(n), true
+	}
+	dscp, ecn, _ := strings.Cut(s, ",")
+	n := -1
+	for v, name := range dscpNames {
+		if strings.EqualFold(strings.TrimSpace(dscp), name) {
+			n = v << 2
+		}
+	}
+	if n < 0 {
+		return 0, false
+	}
+	if ecn = strings.TrimSpace(ecn); ecn == "" {
+		return n, true
+	}
+	for v, name := range ecnNames {
+		if strings.EqualFold(ecn, name) || strings.EqualFold(ecn, strings.NewReplacer("(", "", ")", "").Replace(name)) {
+			return n | v, true
+		}
+	}
+	return 0, false
+}
+
+// parseBool accepts on/off and yes/no as well as the forms of
+// strconv.ParseBool.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "yes", "y":
+		return true, nil
+	case "off", "no", "n":
+		return false, nil
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b, nil
+	}
+	return false, errors.New("expected on, off, true, false, yes, no, 1 or 0")
+}
@@ -0,0 +1,381 @@
+package sockopt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ValueKind describes how the kernel stores an option value and thus how it
+// is read, written, formatted and parsed.
+type ValueKind int
+
+const (
+	// KindInt is a signed int, the default.
+	KindInt ValueKind = iota
+	// KindBool is an int used as a flag. Values are bool.
+	KindBool
+	// KindUint32 is an unsigned 32-bit int. Values are uint32.
+	KindUint32
+	// KindDuration is a struct timeval. Values are Duration.
+	KindDuration
+	// KindString is a NUL terminated string such as a congestion control
+	// algorithm name. Values are string.
+	KindString
+	// KindStruct is a C struct described by SocketOption.Struct.
+	KindStruct
+	// KindBytes is an opaque byte blob. Values are Bytes.
+	KindBytes
+)
+
+var kindNames = map[ValueKind]string{
+	KindInt:      "int",
+	KindBool:     "bool",
+	KindUint32:   "uint32",
+	KindDuration: "duration",
+	KindString:   "string",
+	KindStruct:   "struct",
+	KindBytes:    "bytes",
+}
+
+func (k ValueKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// StructType describes a struct-valued option.
+type StructType struct {
+	// Size is the buffer size passed to getsockopt.
+	Size int
+	// Decode converts the bytes returned by the kernel into a value.
+	Decode func(b []byte) (any, error)
+	// Encode converts a value into the bytes passed to setsockopt. It is nil
+	// for structs that can only be read.
+	Encode func(v any) ([]byte, error)
+	// Parse converts command line input into a value.
+	Parse func(s string) (any, error)
+	// New returns a pointer to a zero value that JSON values are decoded
+	// into. It is nil for structs that can only be read.
+	New func() any
+	// get replaces getsockopt and Decode for structs whose layout depends
+	// on other options of the socket, such as TCP_CC_INFO.
+	get func(so SocketOption, c conn) (any, error)
+}
+
+// Duration is an option value stored by the kernel as a struct timeval. It
+// is marshalled as a Go duration string such as "1.5s".
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	*d = Duration(v)
+	return err
+}
+
+// Bytes is an opaque option value. It is formatted and marshalled as hex.
+type Bytes []byte
+
+func (b Bytes) String() string { return hex.EncodeToString(b) }
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Bytes) MarshalText() ([]byte, error) { return []byte(b.String()), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *Bytes) UnmarshalText(text []byte) error {
+	v, err := hex.DecodeString(string(text))
+	*b = v
+	return err
+}
+
+// Linger is the value of SO_LINGER.
+type Linger struct {
+	OnOff  bool `json:"onoff" yaml:"onoff"`
+	Linger int  `json:"linger" yaml:"linger"`
+}
+
+func (l Linger) String() string {
+	if !l.OnOff {
+		return "off"
+	}
+	return fmt.Sprintf("on, %ds", l.Linger)
+}
+
+// kindCodec implements one value kind.
+type kindCodec struct {
+	get    func(so SocketOption, c conn) (any, error)
+	set    func(so SocketOption, c conn, v any) error
+	format func(so SocketOption, v any) string
+	parse  func(so SocketOption, s string) (any, error)
+	// new returns a pointer to a zero value of the kind, or nil if values
+	// of the option cannot be decoded.
+	new func(so SocketOption) any
+}
+
+var codecs = map[ValueKind]kindCodec{
+	KindInt: {
+		get: func(so SocketOption, c conn) (any, error) {
+			return getsockoptInt(c, so.Level, so.Option)
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			n, err := toInt(v)
+			if err != nil {
+				return err
+			}
+			if err := so.checkRange(n); err != nil {
+				return err
+			}
+			return setsockoptInt(c, so.Level, so.Option, n)
+		},
+		format: func(so SocketOption, v any) string {
+			if n, ok := v.(int); ok {
+				return so.formatInt(n)
+			}
+			return formatAny(so, v)
+		},
+		parse: func(so SocketOption, s string) (any, error) {
+			return so.parseInt(s)
+		},
+		new: func(so SocketOption) any { return new(int) },
+	},
+	KindBool: {
+		get: func(so SocketOption, c conn) (any, error) {
+			v, err := getsockoptInt(c, so.Level, so.Option)
+			return v != 0, err
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			n, err := toInt(v)
+			if err != nil {
+				return err
+			}
+			if err := so.checkRange(n); err != nil {
+				return err
+			}
+			return setsockoptInt(c, so.Level, so.Option, n)
+		},
+		format: formatAny,
+		parse: func(so SocketOption, s string) (any, error) {
+			return parseBool(s)
+		},
+		new: func(so SocketOption) any { return new(bool) },
+	},
+	KindUint32: {
+		get: func(so SocketOption, c conn) (any, error) {
+			v, err := getsockoptInt(c, so.Level, so.Option)
+			return uint32(v), err
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			n, err := toInt(v)
+			if err != nil {
+				return err
+			}
+			if n < 0 || n > math.MaxUint32 {
+				return fmt.Errorf("%w: %d out of range [0,%d] for %s", ErrInvalidValue, n, uint32(math.MaxUint32), so.Name)
+			}
+			if err := so.checkRange(n); err != nil {
+				return err
+			}
+			return setsockoptInt(c, so.Level, so.Option, int(int32(uint32(n))))
+		},
+		format: formatAny,
+		parse: func(so SocketOption, s string) (any, error) {
+			v, err := strconv.ParseUint(s, 0, 32)
+			return uint32(v), err
+		},
+		new: func(so SocketOption) any { return new(uint32) },
+	},
+	KindDuration: {
+		get: func(so SocketOption, c conn) (any, error) {
+			tv, err := getsockoptTimeval(c, so.Level, so.Option)
+			if err != nil {
+				return nil, err
+			}
+			return Duration(time.Duration(tv.Nano())), nil
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			var d time.Duration
+			switch v := v.(type) {
+			case Duration:
+				d = time.Duration(v)
+			case time.Duration:
+				d = v
+			default:
+				return fmt.Errorf("%w: %s expects a duration, got %T", ErrInvalidValue, so.Name, v)
+			}
+			if d < 0 {
+				return fmt.Errorf("%w: negative duration %s for %s", ErrInvalidValue, d, so.Name)
+			}
+			tv := unix.NsecToTimeval(d.Nanoseconds())
+			return setsockoptTimeval(c, so.Level, so.Option, tv)
+		},
+		format: formatAny,
+		parse: func(so SocketOption, s string) (any, error) {
+			d, err := time.ParseDuration(s)
+			return Duration(d), err
+		},
+		new: func(so SocketOption) any { return new(Duration) },
+	},
+	KindString: {
+		get: func(so SocketOption, c conn) (any, error) {
+			return getsockoptString(c, so.Level, so.Option)
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%w: %s expects a string, got %T", ErrInvalidValue, so.Name, v)
+			}
+			return c.setsockopt(so.Level, so.Option, []byte(s))
+		},
+		format: formatAny,
+		parse: func(so SocketOption, s string) (any, error) {
+			return s, nil
+		},
+		new: func(so SocketOption) any { return new(string) },
+	},
+	KindStruct: {
+		get: func(so SocketOption, c conn) (any, error) {
+			if so.Struct.get != nil {
+				return so.Struct.get(so, c)
+			}
+			b, err := getsockoptBytes(c, so.Level, so.Option, so.Struct.Size)
+			if err != nil {
+				return nil, err
+			}
+			return so.Struct.Decode(b)
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			if so.Struct.Encode == nil {
+				return fmt.Errorf("%s can only be read", so.Name)
+			}
+			b, err := so.Struct.Encode(v)
+			if err != nil {
+				return err
+			}
+			return c.setsockopt(so.Level, so.Option, b)
+		},
+		format: formatAny,
+		parse: func(so SocketOption, s string) (any, error) {
+			if so.Struct.Parse == nil {
+				return nil, fmt.Errorf("%s can only be read", so.Name)
+			}
+			return so.Struct.Parse(s)
+		},
+		new: func(so SocketOption) any {
+			if so.Struct.New == nil {
+				return nil
+			}
+			return so.Struct.New()
+		},
+	},
+	KindBytes: {
+		get: func(so SocketOption, c conn) (any, error) {
+			b, err := getsockoptBytes(c, so.Level, so.Option, so.Size)
+			return Bytes(b), err
+		},
+		set: func(so SocketOption, c conn, v any) error {
+			b, ok := v.(Bytes)
+			if !ok {
+				return fmt.Errorf("%w: %s expects bytes, got %T", ErrInvalidValue, so.Name, v)
+			}
+			return c.setsockopt(so.Level, so.Option, b)
+		},
+		format: formatAny,
+		parse: func(so SocketOption, s string) (any, error) {
+			b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+			return Bytes(b), err
+		},
+		new: func(so SocketOption) any { return new(Bytes) },
+	},
+}
+
+func formatAny(so SocketOption, v any) string {
+	return fmt.Sprint(v)
+}
+
+// toInt converts the numeric and boolean value types accepted by Set to int.
+// float64 is accepted for values decoded from JSON.
+func toInt(v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%w: %v is not an integer", ErrInvalidValue, v)
+		}
+		return int(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w: expected an integer, got %T", ErrInvalidValue, v)
+}
+
+// lingerType describes SO_LINGER.
+var lingerType = &StructType{
+	Size: int(unsafe.Sizeof(unix.Linger{})),
+	Decode: func(b []byte) (any, error) {
+		if len(b) < 8 {
+			return nil, fmt.Errorf("short linger value of %d bytes", len(b))
+		}
+		return Linger{
+			OnOff:  binary.NativeEndian.Uint32(b[0:4]) != 0,
+			Linger: int(int32(binary.NativeEndian.Uint32(b[4:8]))),
+		}, nil
+	},
+	Encode: func(v any) ([]byte, error) {
+		l, ok := v.(Linger)
+		if !ok {
+			return nil, fmt.Errorf("%w: SO_LINGER expects a linger value, got %T", ErrInvalidValue, v)
+		}
+		if l.Linger < 0 {
+			return nil, fmt.Errorf("%w: negative linger time %d", ErrInvalidValue, l.Linger)
+		}
+		var onoff uint32
+		if l.OnOff {
+			onoff = 1
+		}
+		b := binary.NativeEndian.AppendUint32(nil, onoff)
+		return binary.NativeEndian.AppendUint32(b, uint32(l.Linger)), nil
+	},
+	Parse: func(s string) (any, error) {
+		if s == "off" {
+			return Linger{}, nil
+		}
+		onoff, secs, ok := strings.Cut(s, ",")
+		if !ok {
+			onoff, secs = "1", s
+		}
+		on, err := parseBool(strings.TrimSpace(onoff))
+		if err != nil {
+			return nil, fmt.Errorf("invalid linger %q, expected off, <seconds> or <onoff>,<seconds>", s)
+		}
+		n, err := SocketOption{Unit: UnitSeconds}.parseInt(strings.TrimSpace(secs))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid linger %q, expected off, <seconds> or <onoff>,<seconds>", s)
+		}
+		return Linger{OnOff: on, Linger: n}, nil
+	},
+	New: func() any { return new(Linger) },
+}
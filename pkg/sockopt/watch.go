@@ -0,0 +1,295 @@
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oraoto/go-pidfd"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// ErrProcessExited is returned by Watcher.Sample once the watched process
+	// has exited.
+	ErrProcessExited = errors.New("process exited")
+	// ErrSocketClosed is returned by Watcher.Sample once the process has
+	// closed the watched descriptor or the connection is closed.
+	ErrSocketClosed = errors.New("socket closed")
+)
+
+// defaultWatchFields are the tcp_info fields watched when no names are given.
+var defaultWatchFields = []string{
+	"state", "ca_state", "rtt", "rttvar", "snd_cwnd", "total_retrans",
+	"bytes_acked", "bytes_received", "notsent_bytes",
+}
+
+// Watcher keeps a duplicate of a socket descriptor open and samples a set of
+// options and tcp_info fields from it.
+type Watcher struct {
+	pid, fd int
+	sock    *Socket
+	pidFd   pidfd.PidFd
+	inode   uint64
+
+	options []SocketOption
+	fields  []string
+	prev    map[string]SampleValue
+}
+
+// Sample holds the watched values read at one point in time.
+type Sample struct {
+	Time   time.Time
+	Values []SampleValue
+}
+
+// SampleValue is a watched option or tcp_info field.
+type SampleValue struct {
+	Name  string
+	Value any
+	// Changed is set when the value differs from the previous sample.
+	Changed bool
+	// Delta is the difference to the previous sample for numeric tcp_info
+	// fields. It is nil in the first sample.
+	Delta *int64
+	// unit is the tcp_info unit, empty for options.
+	unit string
+}
+
+// NewWatcher duplicates fd of process pid and prepares to sample the given
+// option names and tcp_info field names. With no names, all options that apply
+// to the socket and the main tcp_info fields of TCP sockets are watched. The
+// name TCP_INFO selects every tcp_info field.
+func NewWatcher(pid, fd int, names []string) (*Watcher, error) {
+	sock, err := Open(pid, fd)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{pid: pid, fd: fd, sock: sock, pidFd: -1}
+
+	if w.pidFd, err = pidfd.Open(pid, 0); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("%w %d: %w", ErrUnableToGetPidFd, pid, err)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(w.fdPath(), &st); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("unable to stat socket: %w", err)
+	}
+	w.inode = st.Ino
+
+	if err := sock.session(func() error { return w.selectNames(names) }); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// selectNames resolves the watched names into options and tcp_info fields.
+func (w *Watcher) selectNames(names []string) error {
+	_, _, kindErr := w.sock.Kind()
+	_, tcpErr := w.sock.Option("TCP_INFO")
+	isTCP := kindErr == nil && tcpErr == nil
+
+	if len(names) == 0 {
+		for _, name := range OptionsList {
+			so := OptionsMap[name]
+			if name == "TCP_INFO" || !w.sock.applies(so) {
+				continue
+			}
+			// Like list, skip options the socket cannot report in its
+			// current state, such as TCP_REPAIR_QUEUE outside repair mode.
+			if _, err := w.sock.Get(name); err == nil {
+				w.options = append(w.options, so)
+			}
+		}
+		if isTCP {
+			w.fields = defaultWatchFields
+		}
+		return nil
+	}
+
+	known := make(map[string]bool)
+	var all []string
+	for _, f := range (TCPInfo{Length: sizeofTCPInfo}).Fields() {
+		known[f.Name] = true
+		all = append(all, f.Name)
+	}
+
+	for _, name := range names {
+		switch _, ok := OptionsMap[name]; {
+		case name == "TCP_INFO":
+			if tcpErr != nil {
+				return tcpErr
+			}
+			w.fields = all
+		case ok:
+			so, err := w.sock.Option(name)
+			if err != nil {
+				return err
+			}
+			w.options = append(w.options, so)
+		case known[name]:
+			if !isTCP {
+				return fmt.Errorf("tcp_info field %s only applies to TCP sockets", name)
+			}
+			w.fields = append(w.fields, name)
+		default:
+			return fmt.Errorf("%w or tcp_info field %s", ErrUnknownOption, name)
+		}
+	}
+	return nil
+}
+
+// Sample reads the watched values. It returns ErrProcessExited or
+// ErrSocketClosed once there is nothing left to watch.
+func (w *Watcher) Sample() (Sample, error) {
+	if err := w.alive(); err != nil {
+		return Sample{}, err
+	}
+
+	s := Sample{Time: time.Now()}
+	var info any
+	err := w.sock.session(func() error {
+		for _, so := range w.options {
+			val, err := w.sock.Get(so.Name)
+			if err != nil {
+				return fmt.Errorf("unable to get socket option %s: %w", so.Name, err)
+			}
+			s.Values = append(s.Values, w.track(SampleValue{Name: so.Name, Value: val}))
+		}
+		if len(w.fields) == 0 {
+			return nil
+		}
+		var err error
+		if info, err = w.sock.Get("TCP_INFO"); err != nil {
+			return fmt.Errorf("unable to get socket option TCP_INFO: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Sample{}, err
+	}
+
+	if info != nil {
+		ti := info.(TCPInfo)
+		byName := make(map[string]TCPInfoField)
+		for _, f := range ti.Fields() {
+			byName[f.Name] = f
+		}
+		for _, name := range w.fields {
+			if f, ok := byName[name]; ok {
+				s.Values = append(s.Values, w.track(SampleValue{Name: f.Name, Value: f.Value, unit: f.Unit}))
+			}
+		}
+		if ti.State == unix.BPF_TCP_CLOSE {
+			return s, ErrSocketClosed
+		}
+	}
+	return s, nil
+}
+
+// alive checks that the process is still running and still holds the
+// watched socket in the same descriptor.
+func (w *Watcher) alive() error {
+	fds := []unix.PollFd{{Fd: int32(w.pidFd), Events: unix.POLLIN}}
+	if n, err := unix.Poll(fds, 0); err == nil && n > 0 {
+		return ErrProcessExited
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(w.fdPath(), &st); err != nil || st.Ino != w.inode {
+		return ErrSocketClosed
+	}
+	return nil
+}
+
+func (w *Watcher) fdPath() string {
+	return "/proc/" + strconv.Itoa(w.pid) + "/fd/" + strconv.Itoa(w.fd)
+}
+
+// track compares v with the previous sample and records it.
+func (w *Watcher) track(v SampleValue) SampleValue {
+	if w.prev == nil {
+		w.prev = make(map[string]SampleValue)
+	}
+	if p, ok := w.prev[v.Name]; ok {
+		v.Changed = fmt.Sprint(p.Value) != fmt.Sprint(v.Value)
+		if cur, ok := v.Value.(uint64); ok && countsDelta(v.unit) {
+			d := int64(cur - p.Value.(uint64))
+			v.Delta = &d
+		}
+	}
+	w.prev[v.Name] = v
+	return v
+}
+
+// countsDelta reports whether deltas are meaningful for a tcp_info unit.
+// States and option flags are not quantities.
+func countsDelta(unit string) bool {
+	switch unit {
+	case "state", "ca_state", "options":
+		return false
+	}
+	return true
+}
+
+// Close releases the duplicated socket descriptor and the pidfd.
+func (w *Watcher) Close() error {
+	err := w.sock.Close()
+	if w.pidFd >= 0 {
+		unix.Close(int(w.pidFd))
+	}
+	return err
+}
+
+// String renders the value with its unit for table output.
+func (v SampleValue) String() string {
+	if n, ok := v.Value.(uint64); ok {
+		return TCPInfoField{Name: v.Name, Value: n, Unit: v.unit}.FormatValue()
+	}
+	if so, ok := OptionsMap[v.Name]; ok {
+		return so.Format(v.Value)
+	}
+	return fmt.Sprint(v.Value)
+}
+
+// DeltaString renders the delta with the value's unit, e.g. "+1.5 KiB". It
+// returns an empty string for values without a delta or with a zero delta.
+func (v SampleValue) DeltaString() string {
+	if v.Delta == nil || *v.Delta == 0 {
+		return ""
+	}
+	d, sign := *v.Delta, "+"
+	if d < 0 {
+		d, sign = -d, "-"
+	}
+	return sign + TCPInfoField{Name: v.Name, Value: uint64(d), Unit: v.unit}.FormatValue()
+}
+
+// Record returns the sample as a map suitable for JSON and YAML streams:
+// values keep their raw types and only non-zero deltas are included.
+func (s Sample) Record() map[string]any {
+	values := make(map[string]any, len(s.Values))
+	delta := make(map[string]int64)
+	var changed []string
+	for _, v := range s.Values {
+		values[v.Name] = v.Value
+		if v.Changed {
+			changed = append(changed, v.Name)
+		}
+		if v.Delta != nil && *v.Delta != 0 {
+			delta[v.Name] = *v.Delta
+		}
+	}
+
+	rec := map[string]any{"time": s.Time.Format(time.RFC3339Nano), "values": values}
+	if len(changed) > 0 {
+		rec["changed"] = changed
+	}
+	if len(delta) > 0 {
+		rec["delta"] = delta
+	}
+	return rec
+}